@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Complaints from the GFT ({ERROR ...} sentences and unexpected restarts) are kept in an alerts list
+// rather than only scrolling past in the serial data list. One during a recording is critical, as the
+// recording may have to be repeated: it is also shown in a message window.
+const (
+	alertInfo = iota
+	alertWarning
+	alertCritical
+	maxAlerts = 500 // the oldest alerts are dropped beyond this
+)
+
+var alertSeverityNames = []string{"info", "WARNING", "CRITICAL"}
+
+type Alert struct {
+	hostTime time.Time
+	unixTime int64 // GPS time, 0 if not yet known
+	severity int
+	text     string
+	shown    bool // a critical alert has been shown in a message window
+}
+
+func (a Alert) line() string {
+	gpsTime := "no GPS time"
+	if a.unixTime != 0 {
+		gpsTime = time.Unix(a.unixTime, 0).UTC().Format(time.TimeOnly) + " UTC"
+	}
+	return fmt.Sprintf("%s (%s)  %-8s  %s", a.hostTime.Format(time.TimeOnly), gpsTime,
+		alertSeverityNames[a.severity], a.text)
+}
+
+type AlertList struct {
+	mu      sync.Mutex
+	alerts  []Alert
+	changes int // counts additions and clears, for the panel to know when to redraw
+}
+
+var alerts AlertList
+
+func (l *AlertList) add(alert Alert) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.alerts) >= maxAlerts {
+		l.alerts = l.alerts[1:]
+	}
+	l.alerts = append(l.alerts, alert)
+	l.changes++
+}
+
+// snapshot returns a copy of the alerts, oldest first, and the count of changes it reflects
+func (l *AlertList) snapshot() ([]Alert, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Alert(nil), l.alerts...), l.changes
+}
+
+// counts returns the number of alerts and of critical alerts
+func (l *AlertList) counts() (int, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	critical := 0
+	for _, alert := range l.alerts {
+		if alert.severity == alertCritical {
+			critical++
+		}
+	}
+	return len(l.alerts), critical
+}
+
+// unshownCritical returns the critical alerts not yet shown in a message window and marks them shown
+func (l *AlertList) unshownCritical() []Alert {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var unshown []Alert
+	for i := range l.alerts {
+		if l.alerts[i].severity == alertCritical && !l.alerts[i].shown {
+			l.alerts[i].shown = true
+			unshown = append(unshown, l.alerts[i])
+		}
+	}
+	return unshown
+}
+
+func (l *AlertList) clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.alerts = nil
+	l.changes++
+}
+
+// gftErrorSeverity classifies an {ERROR ...} sentence: critical during a recording, otherwise a warning
+func gftErrorSeverity(captureActive bool) int {
+	if captureActive {
+		return alertCritical
+	}
+	return alertWarning
+}
+
+// gftRestartSeverity classifies a [STARTING!] sentence. The first is the GFT starting up when the
+// port is opened; a later one is a restart (a reset or a power problem).
+func gftRestartSeverity(firstStart, captureActive bool) int {
+	switch {
+	case captureActive:
+		return alertCritical
+	case firstStart:
+		return alertInfo
+	}
+	return alertWarning
+}
+
+// raiseAlert adds an alert to the list and logs it. unixTime is the GPS time, 0 if it is not known.
+func raiseAlert(severity int, text string, hostTime time.Time, unixTime int64) {
+	alerts.add(Alert{hostTime: hostTime, unixTime: unixTime, severity: severity, text: text})
+	switch severity {
+	case alertCritical:
+		serialLog.Error("GFT alert", "severity", alertSeverityNames[severity], "alert", text)
+	case alertWarning:
+		serialLog.Warn("GFT alert", "severity", alertSeverityNames[severity], "alert", text)
+	default:
+		serialLog.Info("GFT alert", "severity", alertSeverityNames[severity], "alert", text)
+	}
+}
+
+// alertsButtonText is the text of the alerts button: the number of alerts and of critical ones
+func alertsButtonText() string {
+	total, critical := alerts.counts()
+	switch {
+	case critical > 0:
+		return fmt.Sprintf("Alerts (%d, %d critical)", total, critical)
+	case total > 0:
+		return fmt.Sprintf("Alerts (%d)", total)
+	}
+	return "Alerts"
+}
+
+// AlertsPanel is the open alerts window
+type AlertsPanel struct {
+	window  fyne.Window
+	list    *widget.List
+	shown   []Alert
+	changes int // of the alerts shown
+}
+
+func showAlertsPanel() {
+	if myWin.alertsPanel != nil {
+		myWin.alertsPanel.window.RequestFocus()
+		return
+	}
+	panel := &AlertsPanel{window: myWin.App.NewWindow("GFT alerts"), changes: -1}
+	panel.list = widget.NewList(
+		func() int { return len(panel.shown) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) { o.(*widget.Label).SetText(panel.shown[i].line()) },
+	)
+	clearButton := widget.NewButton("Clear", func() {
+		alerts.clear()
+		refreshAlerts()
+	})
+	panel.window.SetContent(container.NewBorder(nil, clearButton, nil, nil, panel.list))
+	panel.window.Resize(fyne.Size{Height: 400, Width: 900})
+	panel.window.SetOnClosed(func() { myWin.alertsPanel = nil })
+	myWin.alertsPanel = panel
+	refreshAlerts()
+	panel.window.CenterOnScreen()
+	panel.window.Show()
+}
+
+// refreshAlerts updates the alerts button and panel, and shows any new critical alert in a message window
+func refreshAlerts() {
+	if myWin.alertsButton != nil {
+		if text := alertsButtonText(); myWin.alertsButton.Text != text {
+			myWin.alertsButton.SetText(text)
+		}
+	}
+	if panel := myWin.alertsPanel; panel != nil {
+		if current, changes := alerts.snapshot(); changes != panel.changes {
+			panel.shown, panel.changes = current, changes
+			panel.list.Refresh()
+			panel.list.ScrollToBottom()
+		}
+	}
+	var lines []string
+	for _, alert := range alerts.unshownCritical() {
+		lines = append(lines, alert.line())
+	}
+	if lines != nil {
+		showMsg("GFT alert during recording", "\n"+strings.Join(lines, "\n")+"\n", 200, 800)
+	}
+}
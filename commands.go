@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The GFT answers a command with a response sentence ([CMD flash now] or [ ... ]), or with a response
+// embedded between [] and [] in the NMEA sentence it was sending at the time. Every command sent is
+// recorded with who issued it, so that its response can be given back to them.
+const (
+	originUI               = "ui"        // typed in the command entry or sent by a UI control
+	originServer           = "server"    // received by the control server from a client
+	originScheduler        = "scheduler" // sent by the recording schedule
+	commandResponseTimeout = 5 * time.Second
+)
+
+// A PendingCommand is a command that has been sent and not yet answered
+type PendingCommand struct {
+	id       int
+	cmd      string
+	origin   string
+	sent     time.Time
+	response chan string // receives the response, if one arrives
+}
+
+// await returns the response to the command, or false if none arrives within timeout
+func (p *PendingCommand) await(timeout time.Duration) (string, bool) {
+	select {
+	case response := <-p.response:
+		return response, true
+	case <-time.After(timeout):
+		return "", false
+	}
+}
+
+// CommandTracker holds the commands waiting for a response, oldest first. The GFT answers commands in
+// the order it receives them.
+type CommandTracker struct {
+	mu      sync.Mutex
+	nextID  int
+	pending []*PendingCommand
+}
+
+var commandTracker CommandTracker
+
+// issue records a command about to be sent to the GFT
+func (t *CommandTracker) issue(cmd, origin string, now time.Time) *PendingCommand {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.nextID++
+	p := &PendingCommand{id: t.nextID, cmd: cmd, origin: origin, sent: now, response: make(chan string, 1)}
+	t.pending = append(t.pending, p)
+	return p
+}
+
+// responseText is a response without its brackets and any CMD echo marker
+func responseText(response string) string {
+	text := strings.TrimSpace(strings.Trim(strings.TrimSpace(response), "[]"))
+	return strings.TrimSpace(strings.TrimPrefix(text, "CMD"))
+}
+
+// match finds the command that response answers, takes it off the pending list and gives it the
+// response: the oldest command waiting that response is a reply to (see isReplyTo). Commands that have
+// waited longer than commandResponseTimeout are dropped first. It returns nil if no command waiting
+// expects the response, which is then a line the GFT sent of its own accord.
+func (t *CommandTracker) match(response string, now time.Time) *PendingCommand {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	waiting := t.pending[:0]
+	for _, p := range t.pending {
+		if now.Sub(p.sent) > commandResponseTimeout {
+			serialLog.Debug("command no longer waiting for a response", "cmd", p.cmd, "origin", p.origin)
+			continue
+		}
+		waiting = append(waiting, p)
+	}
+	t.pending = waiting
+	if len(t.pending) == 0 {
+		return nil
+	}
+
+	found := slices.IndexFunc(t.pending, func(p *PendingCommand) bool { return isReplyTo(p.cmd, response) })
+	if found < 0 {
+		return nil
+	}
+	p := t.pending[found]
+	t.pending = append(t.pending[:found], t.pending[found+1:]...)
+	p.response <- response
+	return p
+}
+
+// waiting tells whether any command is waiting for a response
+func (t *CommandTracker) waiting() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pending) > 0
+}
+
+// cancel forgets a command that could not be sent
+func (t *CommandTracker) cancel(p *PendingCommand) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending = slices.DeleteFunc(t.pending, func(q *PendingCommand) bool { return q == p })
+}
+
+// reset forgets the commands waiting for a response: after a restart the GFT will not answer them
+func (t *CommandTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.pending {
+		serialLog.Warn("command not answered before the GFT restarted", "cmd", p.cmd, "origin", p.origin)
+	}
+	t.pending = nil
+}
+
+// routeCommandResponse gives a response received from the GFT to the command it answers. It returns false
+// if no command waiting expects it.
+func routeCommandResponse(response string, now time.Time) bool {
+	p := commandTracker.match(response, now)
+	if p == nil {
+		serialLog.Info("command response with no command waiting for it", "response", response)
+		return false
+	}
+	serialLog.Info("command response", "cmd", p.cmd, "origin", p.origin, "response", response,
+		"latency", now.Sub(p.sent))
+	return true
+}
+
+// What became of a command sent to the GFT
+const (
+	commandAccepted      = iota // the GFT echoed or answered it
+	commandRejected             // the GFT answered it with an error
+	commandChecksumError        // the GFT received it with a bad checksum every time it was sent
+	commandTimedOut             // the GFT did not answer it within commandResponseTimeout
+	commandNotSent              // there is no open serial port, or the write failed
+	commandUnexpected           // the GFT answered with something other than the reply to the command
+)
+
+// A command the GFT received with a bad checksum is sent again, up to this many times in all
+const maxCommandAttempts = 3
+
+var commandStatusNames = []string{"accepted", "rejected", "checksum error", "no response", "not sent",
+	"unexpected response"}
+
+// A CommandResult is what became of a command sent to the GFT
+type CommandResult struct {
+	cmd      string
+	status   int
+	response string // the GFT's response, if it answered
+	attempts int
+	latency  time.Duration // from the last time the command was sent to its response
+}
+
+func (r CommandResult) accepted() bool { return r.status == commandAccepted }
+
+func (r CommandResult) String() string {
+	text := fmt.Sprintf("GFT %s: %q", commandStatusNames[r.status], r.cmd)
+	if r.response != "" {
+		text += " " + r.response
+	}
+	if r.attempts > 1 {
+		text += fmt.Sprintf(" (sent %d times)", r.attempts)
+	}
+	return text
+}
+
+// serverReply is the reply to a control server client for the result of its command
+func (r CommandResult) serverReply() string {
+	if r.accepted() {
+		return strings.TrimSpace("OK " + r.response)
+	}
+	return r.String()
+}
+
+// commandName is a command without the value it sets: the CMD echo of a setting starts with it
+func commandName(cmd string) string {
+	cmd = strings.ToLower(strings.TrimSpace(cmd))
+	for _, setting := range deviceSettings {
+		if strings.HasPrefix(cmd, setting.query+" ") {
+			return setting.query
+		}
+	}
+	return cmd
+}
+
+// isReplyTo tells whether response is a reply to cmd: its CMD echo ([CMD flash level 45]), a value
+// ([ 45 ]) if cmd is a query, or a command error ({ERROR ...}), which does not say which command it is for
+func isReplyTo(cmd, response string) bool {
+	response = strings.TrimSpace(response)
+	switch {
+	case strings.HasPrefix(response, "{"):
+		return strings.Contains(strings.ToUpper(response), "ERROR") && isCommandError(response)
+	case strings.HasPrefix(strings.ToUpper(response), "[CMD"):
+		return strings.HasPrefix(strings.ToLower(responseText(response)), commandName(cmd))
+	case strings.HasPrefix(response, "["):
+		return slices.Contains(deviceQueries, strings.ToLower(strings.TrimSpace(cmd)))
+	}
+	return false
+}
+
+// responseStatus classifies the GFT's response to cmd
+func responseStatus(cmd, response string) int {
+	switch {
+	case !isReplyTo(cmd, response):
+		return commandUnexpected
+	case !strings.HasPrefix(strings.TrimSpace(response), "{"):
+		return commandAccepted
+	case strings.Contains(strings.ToLower(response), "checksum"):
+		return commandChecksumError
+	}
+	return commandRejected
+}
+
+// isCommandError tells whether an {ERROR ...} sentence is the GFT's answer to a command rather than a
+// complaint about the 1pps, the receiver or the LED
+func isCommandError(text string) bool {
+	text = strings.ToLower(text)
+	for _, word := range []string{"checksum", "command", "unknown", "invalid", "parameter"} {
+		if strings.Contains(text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeGFTCommand writes a command, with its checksum, to the GFT. It returns the command waiting for its
+// response, or nil if it could not be written.
+func writeGFTCommand(cmd, origin string) *PendingCommand {
+	_, checksum := calcChecksum(cmd)
+	line := fmt.Sprintf("%s*%02X\r\n", cmd, checksum)
+
+	myWin.spMutex.Lock()
+	defer myWin.spMutex.Unlock()
+	if myWin.serialPort == nil {
+		serialLog.Warn("command not sent: no open serial port", "cmd", strings.TrimSpace(line))
+		return nil
+	}
+	// The command is recorded before it is written, as the response may arrive at once
+	pending := commandTracker.issue(cmd, origin, time.Now())
+	_, err := myWin.serialPort.Write([]byte(line))
+	if err != nil {
+		serialLog.Error("command not sent to GFT", "cmd", strings.TrimSpace(line), "err", err)
+		commandTracker.cancel(pending)
+		return nil
+	}
+	serialLog.Info("command sent to GFT", "cmd", strings.TrimSpace(line), "origin", origin)
+	return pending
+}
+
+// sendGFTCommand sends a command to the GFT for origin and waits for its response, sending it again if the
+// GFT received it with a bad checksum. It blocks for up to commandResponseTimeout per attempt, so it must
+// not be called by the loop that reads the sentences the responses arrive in.
+func sendGFTCommand(cmd, origin string) CommandResult {
+	result := CommandResult{cmd: cmd}
+	for result.attempts < maxCommandAttempts {
+		result.attempts++
+		pending := writeGFTCommand(cmd, origin)
+		if pending == nil {
+			result.status = commandNotSent
+			return result
+		}
+		response, ok := pending.await(commandResponseTimeout)
+		if !ok {
+			result.status = commandTimedOut
+			return result
+		}
+		result.response, result.status, result.latency = response, responseStatus(cmd, response), time.Since(pending.sent)
+		if result.status != commandChecksumError {
+			return result
+		}
+		serialLog.Warn("GFT received the command with a bad checksum", "cmd", cmd, "attempt", result.attempts)
+	}
+	return result
+}
+
+// reportCommandResult reports what became of a command from the UI or the scheduler: a UI command has its
+// result shown in the serial data list. The scheduler's are logged, and one the GFT did not accept is an
+// alert: critical during a recording.
+func reportCommandResult(r CommandResult, origin string) {
+	if origin != originScheduler {
+		addToTextOutDisplay(r.String())
+		return
+	}
+	if r.accepted() {
+		schedulerLog.Info("GFT accepted", "cmd", r.cmd, "response", r.response, "latency", r.latency)
+		return
+	}
+	schedulerLog.Error("GFT did not accept", "cmd", r.cmd, "status", commandStatusNames[r.status],
+		"response", r.response, "attempts", r.attempts)
+	severity := alertWarning
+	if myWin.captureActive {
+		severity = alertCritical
+	}
+	raiseAlert(severity, r.String(), time.Now(), 0)
+}
+
+// A CommandQueue sends the commands of the UI and the scheduler to the GFT one at a time, in the order they
+// were given, each once the one before has been answered. A group of commands that depend on each other
+// (flash range then flash level) is abandoned at the first one the GFT does not accept.
+type CommandQueue struct {
+	mu      sync.Mutex
+	groups  []commandGroup
+	running bool // the goroutine sending the commands is running
+}
+
+type commandGroup struct {
+	cmds   []string
+	origin string
+}
+
+var commandQueue CommandQueue
+
+// send queues a group of commands and returns at once. What became of each is reported as it is known.
+func (q *CommandQueue) send(origin string, cmds ...string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.groups = append(q.groups, commandGroup{cmds: cmds, origin: origin})
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+}
+
+func (q *CommandQueue) run() {
+	for {
+		q.mu.Lock()
+		if len(q.groups) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		group := q.groups[0]
+		q.groups = q.groups[1:]
+		q.mu.Unlock()
+
+		for i, cmd := range group.cmds {
+			result := sendGFTCommand(cmd, group.origin)
+			reportCommandResult(result, group.origin)
+			if !result.accepted() && i < len(group.cmds)-1 {
+				serialLog.Warn("commands not sent", "cmds", group.cmds[i+1:], "after", cmd,
+					"status", commandStatusNames[result.status])
+				break
+			}
+		}
+	}
+}
+
+// idle tells whether every command queued has been sent and answered
+func (q *CommandQueue) idle() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return !q.running
+}
+
+// GoalpostCommands holds what became of the 'flash now' commands of the goalposts of a recording
+type GoalpostCommands struct {
+	mu      sync.Mutex
+	results map[int]CommandResult // by goalpost (1 or 2)
+}
+
+var goalpostCommands GoalpostCommands
+
+func (g *GoalpostCommands) reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.results = nil
+}
+
+func (g *GoalpostCommands) record(goalpost int, r CommandResult) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.results == nil {
+		g.results = make(map[int]CommandResult)
+	}
+	g.results[goalpost] = r
+}
+
+// result returns what became of the flash of goalpost, false if it is not known yet
+func (g *GoalpostCommands) result(goalpost int) (CommandResult, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	r, ok := g.results[goalpost]
+	return r, ok
+}
+
+// sendGoalpostFlash sends the 'flash now' of a goalpost and records whether the GFT accepted it. It is run
+// by the scheduler in its own goroutine.
+func sendGoalpostFlash(goalpost int) {
+	result := sendGFTCommand("flash now", originScheduler)
+	goalpostCommands.record(goalpost, result)
+	reportCommandResult(result, originScheduler)
+}
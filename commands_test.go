@@ -0,0 +1,213 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"go.bug.st/serial"
+	"testing"
+	"time"
+)
+
+func Test_commandTracker(t *testing.T) {
+	var tracker CommandTracker
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	level := tracker.issue("flash level 100", originUI, start)
+	flash := tracker.issue("flash now", originScheduler, start)
+	duration := tracker.issue("flash duration", originServer, start)
+
+	// An echo goes to its command, whatever the order
+	assert.Equal(t, flash, tracker.match("[CMD flash now]", start.Add(time.Second)))
+	response, ok := flash.await(time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, "[CMD flash now]", response)
+
+	// A value goes to the oldest query waiting, not to a command that sets a value
+	assert.Equal(t, duration, tracker.match("[ 5 ]", start.Add(time.Second)))
+	assert.Equal(t, "flash level 100", responseText("[CMD flash level 100]"))
+	// A line the GFT sends of its own accord is not taken as the reply to a command
+	assert.Nil(t, tracker.match("[CMD led off]", start.Add(time.Second)))
+	assert.Nil(t, tracker.match("[ 5 ]", start.Add(time.Second)))
+	assert.Equal(t, level, tracker.match("[CMD flash level 100]", start.Add(time.Second)))
+
+	// A command stops waiting after commandResponseTimeout
+	late := tracker.issue("version", originUI, start)
+	assert.Nil(t, tracker.match("[ v1.2 ]", start.Add(commandResponseTimeout+time.Second)))
+	_, ok = late.await(time.Millisecond)
+	assert.False(t, ok)
+
+	tracker.cancel(tracker.issue("led on", originUI, start))
+	tracker.issue("led off", originUI, start)
+	tracker.reset()
+	assert.Empty(t, tracker.pending)
+}
+
+func Test_applyCommandResponse(t *testing.T) {
+	savedTracker, savedAlerts, savedCapture := commandTracker.pending, alerts.alerts, myWin.captureActive
+	defer func() {
+		commandTracker.pending, alerts.alerts, myWin.captureActive = savedTracker, savedAlerts, savedCapture
+	}()
+	commandTracker.pending, alerts.alerts, myWin.captureActive = nil, nil, false
+
+	now := time.Now()
+	gpsInfo := GPSdata{hostTime: now, unixTime: 1709296496}
+	flash := commandTracker.issue("flash now", originScheduler, now)
+	line := nmeaLine(0x1234, "$GPDTM,W84,,0.0,N,0.0,E,0.0,W84")
+	inner := line[:len(line)-3]
+	s, err := decodeLine(gftLine(inner[:10] + "[][CMD flash now][]" + inner[10:]))
+	assert.Nil(t, err)
+	applySentence(s, &gpsInfo)
+	response, ok := flash.await(time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, "[CMD flash now]", response)
+
+	for _, text := range []string{"[STARTING!]", "{ERROR no 1pps}", "[STARTING!]"} {
+		s, err = decodeLine(gftLine(text))
+		assert.Nil(t, err)
+		applySentence(s, &gpsInfo)
+	}
+	myWin.captureActive = true
+	s, _ = decodeLine(gftLine("{ERROR flash failed}"))
+	applySentence(s, &gpsInfo)
+
+	list, _ := alerts.snapshot()
+	assert.Equal(t, 4, len(list))
+	assert.Equal(t, []int{alertInfo, alertWarning, alertWarning, alertCritical},
+		[]int{list[0].severity, list[1].severity, list[2].severity, list[3].severity})
+	assert.Equal(t, "GFT restarted", list[2].text)
+	assert.Equal(t, 2, gpsInfo.gftStarts)
+	assert.Equal(t, "Alerts (4, 1 critical)", alertsButtonText())
+	assert.Equal(t, 1, len(alerts.unshownCritical()))
+	assert.Empty(t, alerts.unshownCritical())
+	assert.Contains(t, list[3].line(), "(12:34:56 UTC)  CRITICAL  {ERROR flash failed}")
+}
+
+// fakeGFT is a serial port that answers each command written to it with the next of its answers
+type fakeGFT struct {
+	serial.Port
+	answers []string
+	written []string
+}
+
+func (f *fakeGFT) Write(p []byte) (int, error) {
+	f.written = append(f.written, string(p))
+	if len(f.answers) > 0 {
+		routeCommandResponse(f.answers[0], time.Now())
+		f.answers = f.answers[1:]
+	}
+	return len(p), nil
+}
+
+func Test_sendGFTCommand(t *testing.T) {
+	savedPort, savedTracker := myWin.serialPort, commandTracker.pending
+	defer func() { myWin.serialPort, commandTracker.pending = savedPort, savedTracker }()
+	commandTracker.pending = nil
+
+	myWin.serialPort = nil
+	assert.Equal(t, commandNotSent, sendGFTCommand("flash now", originUI).status)
+
+	port := &fakeGFT{answers: []string{"{ERROR bad checksum}", "[CMD flash duration 3]"}}
+	myWin.serialPort = port
+	result := sendGFTCommand("flash duration 3", originServer)
+	assert.True(t, result.accepted())
+	assert.Equal(t, 2, result.attempts)
+	assert.Equal(t, []string{"flash duration 3*5D\r\n", "flash duration 3*5D\r\n"}, port.written)
+	assert.Equal(t, "OK [CMD flash duration 3]", result.serverReply())
+
+	port.answers = []string{"{ERROR checksum}", "{ERROR checksum}", "{ERROR checksum}"}
+	result = sendGFTCommand("flash now", originScheduler)
+	assert.Equal(t, commandChecksumError, result.status)
+	assert.Equal(t, maxCommandAttempts, result.attempts)
+	assert.Equal(t, `GFT checksum error: "flash now" {ERROR checksum} (sent 3 times)`, result.serverReply())
+
+	port.answers = []string{"{ERROR unknown command}"}
+	assert.Equal(t, commandRejected, sendGFTCommand("flash sideways", originUI).status)
+	assert.Empty(t, commandTracker.pending)
+}
+
+func Test_commandErrors(t *testing.T) {
+	savedTracker, savedAlerts := commandTracker.pending, alerts.alerts
+	defer func() { commandTracker.pending, alerts.alerts = savedTracker, savedAlerts }()
+	commandTracker.pending, alerts.alerts = nil, nil
+
+	assert.Equal(t, commandAccepted, responseStatus("flash level", "[ 120 ]"))
+	assert.Equal(t, commandAccepted, responseStatus("flash level 120", "[CMD flash level 120]"))
+	assert.Equal(t, commandRejected, responseStatus("flash level 999", "{ERROR invalid parameter}"))
+	assert.Equal(t, commandChecksumError, responseStatus("flash now", "{ERROR bad checksum}"))
+	// A line that is not the reply to the command is not taken as accepting it
+	assert.Equal(t, commandUnexpected, responseStatus("flash now", "[CMD led on]"))
+	assert.Equal(t, commandUnexpected, responseStatus("flash now", "[ 120 ]"))
+	assert.Equal(t, commandUnexpected, responseStatus("flash now", "{MODE 1pps}"))
+	assert.True(t, isCommandError("{ERROR Invalid parameter}"))
+	assert.False(t, isCommandError("{ERROR no 1pps}"))
+
+	// An error answering a command goes to the command, not to the alerts
+	gpsInfo := GPSdata{hostTime: time.Now()}
+	level := commandTracker.issue("flash level 999", originUI, gpsInfo.hostTime)
+	s, _ := decodeLine(gftLine("{ERROR invalid parameter}"))
+	applySentence(s, &gpsInfo)
+	response, ok := level.await(time.Second)
+	assert.True(t, ok)
+	assert.Equal(t, "{ERROR invalid parameter}", response)
+	applySentence(s, &gpsInfo)
+	list, _ := alerts.snapshot()
+	assert.Equal(t, 1, len(list))
+
+	v := FlashValidation{passed: true}
+	v.checkFlashCommand(1, CommandResult{cmd: "flash now", response: "[CMD flash now]"}, true)
+	v.checkFlashCommand(2, CommandResult{cmd: "flash now", status: commandTimedOut}, true)
+	v.checkFlashCommand(2, CommandResult{}, false)
+	assert.True(t, v.passed)
+	assert.Equal(t, []string{
+		"ok:   goalpost 1: the GFT accepted its flash now [CMD flash now]",
+		`warn: goalpost 2: GFT no response: "flash now"`,
+		"warn: goalpost 2: no record of the GFT answering its flash now",
+	}, v.lines)
+}
+
+func Test_sendCommandToArduinoDoesNotWait(t *testing.T) {
+	savedPort, savedTracker := myWin.serialPort, commandTracker.pending
+	defer func() { myWin.serialPort, commandTracker.pending = savedPort, savedTracker }()
+	commandTracker.pending = nil
+
+	// The GFT never answers: the caller (the sentence loop or a UI callback) must not wait for it
+	myWin.serialPort = &fakeGFT{}
+	start := time.Now()
+	sendCommandToArduino("flash duration 3", originScheduler)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Answer it, so that it does not time out into an alert during a later test
+	assert.Eventually(t, commandTracker.waiting, time.Second, time.Millisecond)
+	routeCommandResponse("[CMD flash duration 3]", time.Now())
+}
+
+func Test_commandQueue(t *testing.T) {
+	savedPort, savedTracker := myWin.serialPort, commandTracker.pending
+	defer func() { myWin.serialPort, commandTracker.pending = savedPort, savedTracker }()
+	commandTracker.pending = nil
+
+	// The commands of a group are sent in order, each once the one before has been answered
+	port := &fakeGFT{answers: []string{"[CMD flash range 1]", "[CMD flash level 45]", "[CMD led on]"}}
+	myWin.serialPort = port
+	commandQueue.send(originUI, "flash range 1", "flash level 45", "led on")
+	assert.Eventually(t, commandQueue.idle, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"flash range 1*3E\r\n", "flash level 45*07\r\n", "led on*4C\r\n"}, port.written)
+
+	// The level is not sent if the range was not accepted
+	port.answers, port.written = []string{"{ERROR invalid parameter}"}, nil
+	commandQueue.send(originUI, "flash range 7", "flash level 45")
+	assert.Eventually(t, commandQueue.idle, time.Second, time.Millisecond)
+	assert.Equal(t, 1, len(port.written))
+}
+
+func Test_sendServerCommand(t *testing.T) {
+	savedPort, savedTracker := myWin.serialPort, commandTracker.pending
+	defer func() { myWin.serialPort, commandTracker.pending = savedPort, savedTracker }()
+	commandTracker.pending = nil
+
+	// A client gets a plain OK at once unless it asks to wait for the GFT
+	port := &fakeGFT{answers: []string{"[CMD flash now]", "{ERROR unknown command}"}}
+	myWin.serialPort = port
+	assert.Equal(t, "OK", sendServerCommand("flash now", false))
+	assert.Eventually(t, commandQueue.idle, time.Second, time.Millisecond)
+	assert.Equal(t, `GFT rejected: "flash now" {ERROR unknown command}`, sendServerCommand("flash now", true))
+	assert.Equal(t, 2, len(port.written))
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/widget"
+)
+
+// When the GFT starts ([STARTING!] after the port is opened) its configuration is read back with the
+// get form of its commands, rather than assumed from the app's preferences.
+const (
+	originDevice = "device" // sent to read the device configuration
+
+	// Firmware versions that the app is known to work with can be added to this file in the working
+	// directory, one per line
+	firmwareFile = "IotaGFT_firmware.txt"
+)
+
+// deviceQueries are the commands that read the GFT configuration, in the order they are sent
+var deviceQueries = []string{"version", "device", "status", "flash mode", "flash duration", "flash level", "flash range",
+	"pulse duration", "pulse interval"}
+
+// builtInFirmwareVersions are the GFT firmware versions listed on a "firmware versions: 1.04, 1.05" line of
+// cmd.txt (Help: commands). cmd.txt does not have the line yet, so until a version is added to it or to
+// firmwareFile the version read from the GFT is not checked.
+var builtInFirmwareVersions = documentedFirmwareVersions(cmdText)
+
+// documentedFirmwareVersions returns the versions listed on the firmware versions line of a command help text
+func documentedFirmwareVersions(text string) []string {
+	const prefix = "firmware versions:"
+	var versions []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < len(prefix) || !strings.EqualFold(line[:len(prefix)], prefix) {
+			continue
+		}
+		versions = append(versions, strings.FieldsFunc(line[len(prefix):], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})...)
+	}
+	return versions
+}
+
+// DeviceConfig is the GFT configuration as last read back
+type DeviceConfig struct {
+	mu      sync.Mutex
+	results map[string]CommandResult // by query
+	read    time.Time                // when the last query was answered
+	notes   []string                 // warnings about the configuration
+}
+
+var deviceConfig DeviceConfig
+
+func (d *DeviceConfig) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.results, d.read, d.notes = nil, time.Time{}, nil
+}
+
+func (d *DeviceConfig) set(query string, r CommandResult, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.results == nil {
+		d.results = make(map[string]CommandResult)
+	}
+	d.results[query] = r
+	d.read = now
+}
+
+func (d *DeviceConfig) addNote(note string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notes = append(d.notes, note)
+}
+
+// value returns the value the GFT gave for query, false if it has not answered it
+func (d *DeviceConfig) value(query string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r, ok := d.results[query]
+	if !ok || !r.accepted() {
+		return "", false
+	}
+	return queryValue(query, r.response), true
+}
+
+// text returns what is known of query for display: its value, or what became of the query
+func (d *DeviceConfig) text(query string) string {
+	d.mu.Lock()
+	r, ok := d.results[query]
+	d.mu.Unlock()
+	switch {
+	case !ok:
+		return "not read"
+	case !r.accepted():
+		return commandStatusNames[r.status]
+	}
+	return queryValue(query, r.response)
+}
+
+// queryValue is the value in the GFT's response to a query: the response without its brackets, CMD marker
+// and any repetition of the query
+func queryValue(query, response string) string {
+	text := responseText(response)
+	if len(text) >= len(query) && strings.EqualFold(text[:len(query)], query) {
+		text = text[len(query):]
+	}
+	return strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(text), ":="))
+}
+
+// loadFirmwareVersions returns the built-in firmware versions and those in the file at path. A missing file
+// is not an error.
+func loadFirmwareVersions(path string) ([]string, error) {
+	versions := slices.Clone(builtInFirmwareVersions)
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return versions, nil
+	}
+	if err != nil {
+		return versions, fmt.Errorf("loadFirmwareVersions(): %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			versions = append(versions, line)
+		}
+	}
+	return versions, scanner.Err()
+}
+
+// firmwareNote returns a warning if version is not one of the known versions, or an empty string. With no
+// known versions there is nothing to check against.
+func firmwareNote(version string, known []string) string {
+	if len(known) == 0 {
+		return ""
+	}
+	if slices.ContainsFunc(known, func(k string) bool { return strings.EqualFold(k, version) }) {
+		return ""
+	}
+	return fmt.Sprintf("GFT firmware version %q is not one this app knows: its commands may differ from "+
+		"Help: commands (add the version to %s once checked)", version, firmwareFile)
+}
+
+// ledNote returns a warning if the flash range and level read from the GFT are not those of the app's
+// LED intensity preference, or an empty string
+func ledNote(ledRange, level string, intensity float64) string {
+	wantRange, wantLevel := ledRangeAndLevel(intensity)
+	if ledRange == fmt.Sprint(wantRange) && level == fmt.Sprint(wantLevel) {
+		return ""
+	}
+	return fmt.Sprintf("GFT flash range %s level %s differ from the app's LED intensity (range %d level %d): "+
+		"they are sent when the LED on box is ticked or a recording is armed", ledRange, level, wantRange, wantLevel)
+}
+
+// queryDeviceConfig reads the configuration of the GFT, which has just started. It waits for each
+// response, so it is run in its own goroutine.
+func queryDeviceConfig() {
+	deviceConfig.reset()
+	for _, query := range deviceQueries {
+		result := sendGFTCommand(query, originDevice)
+		deviceConfig.set(query, result, time.Now())
+		if result.status == commandNotSent {
+			break
+		}
+		serialLog.Info("GFT configuration", "query", query, "status", commandStatusNames[result.status],
+			"value", deviceConfig.text(query))
+		refreshDevicePanel()
+	}
+
+	if version, ok := deviceConfig.value("version"); ok {
+		known, err := loadFirmwareVersions(filepath.Join(getWorkDir(), firmwareFile))
+		if err != nil {
+			serialLog.Warn("firmware versions file not read", "err", err)
+		}
+		if note := firmwareNote(version, known); note != "" {
+			deviceConfig.addNote(note)
+			raiseAlert(alertWarning, note, time.Now(), 0)
+		}
+	}
+	ledRange, rangeOK := deviceConfig.value("flash range")
+	level, levelOK := deviceConfig.value("flash level")
+	if rangeOK && levelOK {
+		intensity, err := strconv.ParseFloat(myWin.App.Preferences().StringWithFallback("LedIntensity", "0"), 64)
+		if err == nil {
+			if note := ledNote(ledRange, level, intensity); note != "" {
+				deviceConfig.addNote(note)
+				serialLog.Info("GFT LED setting", "note", note)
+			}
+		}
+	}
+	refreshDevicePanel()
+}
+
+// A DeviceSetting is a GFT configuration item that can be changed, with the values it accepts
+type DeviceSetting struct {
+	query   string
+	choices []string // the values accepted, or nil for a number
+	min     int
+	max     int // 0 if there is no maximum
+}
+
+// deviceSettings are the settings of cmd.txt, in deviceQueries order. The queries not listed (version,
+// device and status) can only be read.
+var deviceSettings = []DeviceSetting{
+	{query: "flash mode", choices: []string{"pps", "exp"}},
+	{query: "flash duration", min: 1},
+	{query: "flash level", min: 0, max: 255},
+	{query: "flash range", choices: []string{"0", "1", "2"}},
+	{query: "pulse duration", min: 1},
+	{query: "pulse interval", min: 1},
+}
+
+// deviceActions are the commands of cmd.txt that do something rather than set a value
+var deviceActions = []string{"flash now", "led on", "led off"}
+
+func deviceSetting(query string) (DeviceSetting, bool) {
+	i := slices.IndexFunc(deviceSettings, func(d DeviceSetting) bool { return d.query == query })
+	if i < 0 {
+		return DeviceSetting{}, false
+	}
+	return deviceSettings[i], true
+}
+
+// command returns the command that sets the setting to value, or an error if value is not accepted
+func (d DeviceSetting) command(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if d.choices != nil {
+		i := slices.IndexFunc(d.choices, func(c string) bool { return strings.EqualFold(c, value) })
+		if i < 0 {
+			return "", fmt.Errorf("%s must be one of %s", d.query, strings.Join(d.choices, ", "))
+		}
+		return d.query + " " + d.choices[i], nil
+	}
+	number, err := strconv.Atoi(value)
+	switch {
+	case err != nil:
+		return "", fmt.Errorf("%s must be a whole number", d.query)
+	case number < d.min:
+		return "", fmt.Errorf("%s must be at least %d", d.query, d.min)
+	case d.max > 0 && number > d.max:
+		return "", fmt.Errorf("%s must be at most %d", d.query, d.max)
+	}
+	return fmt.Sprintf("%s %d", d.query, number), nil
+}
+
+// changeDeviceSetting sends the command that changes a setting, logs the change and reads the setting
+// back. It waits for the responses, so it is run in its own goroutine.
+func changeDeviceSetting(query, cmd string) CommandResult {
+	before := deviceConfig.text(query)
+	result := sendGFTCommand(cmd, originUI)
+	serialLog.Info("GFT setting changed", "setting", query, "from", before, "cmd", cmd,
+		"status", commandStatusNames[result.status], "response", result.response)
+	if result.status != commandNotSent {
+		deviceConfig.set(query, sendGFTCommand(query, originDevice), time.Now())
+	}
+	if result.accepted() && (query == "flash range" || query == "flash level") {
+		saveLedSetting(query, strings.TrimPrefix(cmd, query+" "))
+	}
+	return result
+}
+
+// saveLedSetting changes the LED intensity preference (and the slider) to a flash range or level set from
+// the device panel, so that it is the one sent when the LED on box is ticked or a recording is armed
+func saveLedSetting(query, value string) {
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return
+	}
+	intensity, _ := strconv.ParseFloat(myWin.App.Preferences().StringWithFallback("LedIntensity", "400"), 64)
+	ledRange, level := ledRangeAndLevel(intensity)
+	if query == "flash range" {
+		ledRange = number
+	} else {
+		level = number
+	}
+	intensity = ledIntensity(ledRange, level)
+	myWin.App.Preferences().SetString("LedIntensity", fmt.Sprintf("%0.0f", intensity))
+	if myWin.flashIntensitySlider != nil {
+		myWin.flashIntensitySlider.Value = intensity
+		myWin.flashIntensitySlider.Refresh()
+	}
+	serialLog.Info("LED intensity preference changed", "setting", query, "intensity", intensity)
+}
+
+// runDeviceAction sends an action command and logs it. It waits for the response, so it is run in its own
+// goroutine.
+func runDeviceAction(cmd string) CommandResult {
+	result := sendGFTCommand(cmd, originUI)
+	serialLog.Info("GFT action", "cmd", cmd, "status", commandStatusNames[result.status],
+		"response", result.response)
+	return result
+}
+
+// DevicePanel is the open GFT device window
+type DevicePanel struct {
+	window fyne.Window
+	values map[string]*widget.Label // the values read back, by query
+	notes  *widget.Label
+	read   *widget.Label
+	status *widget.Label // the result of the last command sent from the panel
+}
+
+func showDevicePanel() {
+	if myWin.devicePanel != nil {
+		myWin.devicePanel.window.RequestFocus()
+		return
+	}
+	panel := &DevicePanel{
+		window: myWin.App.NewWindow("GFT device"),
+		values: make(map[string]*widget.Label),
+		notes:  widget.NewLabel(""),
+		read:   widget.NewLabel(""),
+		status: widget.NewLabel(""),
+	}
+	grid := container.NewGridWithColumns(4)
+	for _, query := range deviceQueries {
+		panel.values[query] = widget.NewLabel("")
+		grid.Add(widget.NewLabel(query))
+		grid.Add(panel.values[query])
+		setting, ok := deviceSetting(query)
+		if !ok {
+			grid.Add(layout.NewSpacer())
+			grid.Add(widget.NewButton("Read", func() { go panel.readSetting(query) }))
+			continue
+		}
+		var input func() string
+		if setting.choices != nil {
+			choice := widget.NewSelect(setting.choices, nil)
+			input = func() string { return choice.Selected }
+			grid.Add(choice)
+		} else {
+			entry := widget.NewEntry()
+			if setting.max > 0 {
+				entry.SetPlaceHolder(fmt.Sprintf("%d to %d", setting.min, setting.max))
+			} else {
+				entry.SetPlaceHolder(fmt.Sprintf("at least %d", setting.min))
+			}
+			input = func() string { return entry.Text }
+			grid.Add(entry)
+		}
+		grid.Add(widget.NewButton("Set", func() { panel.set(setting, input()) }))
+	}
+
+	actions := container.NewHBox()
+	for _, cmd := range deviceActions {
+		actions.Add(widget.NewButton(cmd, func() {
+			go func() { panel.showResult(runDeviceAction(cmd)) }()
+		}))
+	}
+	actions.Add(layout.NewSpacer())
+	actions.Add(widget.NewButton("Read all again", func() { go queryDeviceConfig() }))
+
+	panel.notes.Wrapping = fyne.TextWrapWord
+	panel.status.Wrapping = fyne.TextWrapWord
+	panel.window.SetContent(container.NewVBox(grid, actions, panel.status, panel.read, panel.notes))
+	panel.window.Resize(fyne.Size{Height: 500, Width: 750})
+	panel.window.SetOnClosed(func() { myWin.devicePanel = nil })
+	myWin.devicePanel = panel
+	refreshDevicePanel()
+	panel.window.CenterOnScreen()
+	panel.window.Show()
+}
+
+// set validates a new value for a setting and, if it is accepted, sends it to the GFT
+func (panel *DevicePanel) set(setting DeviceSetting, value string) {
+	cmd, err := setting.command(value)
+	if err != nil {
+		panel.status.SetText(err.Error())
+		return
+	}
+	panel.status.SetText("Sending " + cmd + " ...")
+	go func() {
+		panel.showResult(changeDeviceSetting(setting.query, cmd))
+		refreshDevicePanel()
+	}()
+}
+
+// readSetting reads one query again
+func (panel *DevicePanel) readSetting(query string) {
+	deviceConfig.set(query, sendGFTCommand(query, originDevice), time.Now())
+	refreshDevicePanel()
+}
+
+func (panel *DevicePanel) showResult(result CommandResult) {
+	panel.status.SetText(result.String())
+}
+
+// refreshDevicePanel shows the configuration last read from the GFT, if the device panel is open
+func refreshDevicePanel() {
+	panel := myWin.devicePanel
+	if panel == nil {
+		return
+	}
+	for _, query := range deviceQueries {
+		panel.values[query].SetText(deviceConfig.text(query))
+	}
+	deviceConfig.mu.Lock()
+	read, notes := deviceConfig.read, strings.Join(deviceConfig.notes, "\n")
+	deviceConfig.mu.Unlock()
+	if read.IsZero() {
+		panel.read.SetText("The configuration is read when the GFT starts.")
+	} else {
+		panel.read.SetText("Read at " + read.Format(time.TimeOnly))
+	}
+	panel.notes.SetText(notes)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_queryValue(t *testing.T) {
+	assert.Equal(t, "5", queryValue("flash duration", "[CMD flash duration 5]"))
+	assert.Equal(t, "exp", queryValue("flash mode", "[Flash Mode: exp]"))
+	assert.Equal(t, "1.04", queryValue("version", "[ 1.04 ]"))
+	assert.Equal(t, "IOTA GFT", queryValue("device", "[IOTA GFT]"))
+	assert.Equal(t, "pps locked", queryValue("status", "[CMD status: pps locked]"))
+}
+
+func Test_firmwareVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), firmwareFile)
+	known, err := loadFirmwareVersions(path)
+	assert.Nil(t, err)
+	assert.Equal(t, builtInFirmwareVersions, known)
+	assert.Equal(t, "", firmwareNote("1.04", nil)) // nothing to check against
+	assert.Contains(t, firmwareNote("1.04", []string{"1.05"}), `version "1.04" is not one this app knows`)
+
+	assert.Nil(t, os.WriteFile(path, []byte("# checked\n1.04\n\n"), 0644))
+	known, err = loadFirmwareVersions(path)
+	assert.Nil(t, err)
+	assert.Equal(t, "", firmwareNote("1.04", known))
+
+	assert.Equal(t, "", ledNote("1", "45", 300))
+	assert.Contains(t, ledNote("2", "255", 300), "range 1 level 45")
+}
+
+func Test_documentedFirmwareVersions(t *testing.T) {
+	assert.Equal(t, []string{"1.04", "1.05"},
+		documentedFirmwareVersions("Available IOTA GFT commands:\n\tFirmware versions: 1.04, 1.05\n\tflash now\n"))
+	assert.Empty(t, documentedFirmwareVersions("\tversion\n"))
+	assert.Equal(t, documentedFirmwareVersions(cmdText), builtInFirmwareVersions)
+}
+
+func Test_queryDeviceConfigKnownVersion(t *testing.T) {
+	savedPort, savedTracker, savedAlerts := myWin.serialPort, commandTracker.pending, alerts.alerts
+	defer func() {
+		myWin.serialPort, commandTracker.pending, alerts.alerts = savedPort, savedTracker, savedAlerts
+		deviceConfig.reset()
+	}()
+	commandTracker.pending, alerts.alerts = nil, nil
+
+	// With the versions of the real cmd.txt a GFT connecting raises no alert
+	version := "1.04"
+	if len(builtInFirmwareVersions) > 0 {
+		version = builtInFirmwareVersions[0]
+	}
+
+	myWin.serialPort = &fakeGFT{answers: []string{"[CMD version " + version + "]", "[IOTA GFT]", "[CMD status ok]", "[CMD flash mode pps]",
+		"[CMD flash duration 1]", "[CMD flash level 45]", "[CMD flash range 1]", "[CMD pulse duration 1]",
+		"[CMD pulse interval 100]"}}
+	queryDeviceConfig()
+
+	assert.Equal(t, version, deviceConfig.text("version"))
+	list, _ := alerts.snapshot()
+	assert.Empty(t, list)
+}
+
+func Test_queryDeviceConfig(t *testing.T) {
+	savedPort, savedTracker, savedAlerts := myWin.serialPort, commandTracker.pending, alerts.alerts
+	savedVersions := builtInFirmwareVersions
+	defer func() {
+		myWin.serialPort, commandTracker.pending, alerts.alerts = savedPort, savedTracker, savedAlerts
+		builtInFirmwareVersions = savedVersions
+		deviceConfig.reset()
+	}()
+	commandTracker.pending, alerts.alerts = nil, nil
+	builtInFirmwareVersions = []string{"1.04"}
+
+	port := &fakeGFT{answers: []string{"[CMD version 9.99]", "[IOTA GFT]", "[CMD status ok]", "[CMD flash mode pps]",
+		"[CMD flash duration 1]", "[CMD flash level 45]", "[CMD flash range 1]", "{ERROR unknown command}",
+		"[CMD pulse interval 100]"}}
+	myWin.serialPort = port
+	queryDeviceConfig()
+
+	assert.Equal(t, len(deviceQueries), len(port.written))
+	assert.Equal(t, "9.99", deviceConfig.text("version"))
+	assert.Equal(t, "ok", deviceConfig.text("status"))
+	assert.Equal(t, "pps", deviceConfig.text("flash mode"))
+	assert.Equal(t, "rejected", deviceConfig.text("pulse duration"))
+	_, ok := deviceConfig.value("pulse duration")
+	assert.False(t, ok)
+	list, _ := alerts.snapshot()
+	assert.Equal(t, 1, len(list))
+	assert.Contains(t, list[0].text, "9.99")
+}
+
+func Test_deviceSettings(t *testing.T) {
+	for _, query := range deviceQueries {
+		_, ok := deviceSetting(query)
+		assert.Equal(t, query != "version" && query != "device" && query != "status", ok, query)
+	}
+	mode, _ := deviceSetting("flash mode")
+	cmd, err := mode.command(" EXP ")
+	assert.Nil(t, err)
+	assert.Equal(t, "flash mode exp", cmd)
+	_, err = mode.command("both")
+	assert.EqualError(t, err, "flash mode must be one of pps, exp")
+
+	level, _ := deviceSetting("flash level")
+	cmd, err = level.command("120")
+	assert.Nil(t, err)
+	assert.Equal(t, "flash level 120", cmd)
+	_, err = level.command("256")
+	assert.EqualError(t, err, "flash level must be at most 255")
+	_, err = level.command("bright")
+	assert.EqualError(t, err, "flash level must be a whole number")
+	interval, _ := deviceSetting("pulse interval")
+	_, err = interval.command("0")
+	assert.EqualError(t, err, "pulse interval must be at least 1")
+}
+
+func Test_changeDeviceSetting(t *testing.T) {
+	savedPort, savedTracker := myWin.serialPort, commandTracker.pending
+	defer func() {
+		myWin.serialPort, commandTracker.pending = savedPort, savedTracker
+		deviceConfig.reset()
+	}()
+	commandTracker.pending = nil
+
+	// The setting is read back after it is changed
+	port := &fakeGFT{answers: []string{"[CMD flash duration 3]", "[CMD flash duration 3]"}}
+	myWin.serialPort = port
+	result := changeDeviceSetting("flash duration", "flash duration 3")
+	assert.True(t, result.accepted())
+	assert.Equal(t, 2, len(port.written))
+	assert.Equal(t, "flash duration*", port.written[1][:len("flash duration*")])
+	assert.Equal(t, "3", deviceConfig.text("flash duration"))
+
+	// status is read only: it has a Read button, not a Set
+	port.answers = []string{"[CMD status ok]"}
+	panel := &DevicePanel{}
+	panel.readSetting("status")
+	assert.Equal(t, "status*", port.written[2][:len("status*")])
+	assert.Equal(t, "ok", deviceConfig.text("status"))
+
+	port.answers = []string{"[CMD led on]"}
+	assert.True(t, runDeviceAction("led on").accepted())
+}
+
+func Test_changeDeviceSettingSavesLedIntensity(t *testing.T) {
+	savedPort, savedTracker := myWin.serialPort, commandTracker.pending
+	savedIntensity := myWin.App.Preferences().StringWithFallback("LedIntensity", "400")
+	defer func() {
+		myWin.serialPort, commandTracker.pending = savedPort, savedTracker
+		myWin.App.Preferences().SetString("LedIntensity", savedIntensity)
+		deviceConfig.reset()
+	}()
+	commandTracker.pending = nil
+	myWin.App.Preferences().SetString("LedIntensity", "400") // range 1 level 145
+
+	myWin.serialPort = &fakeGFT{answers: []string{"[CMD flash level 45]", "[CMD flash level 45]"}}
+	assert.True(t, changeDeviceSetting("flash level", "flash level 45").accepted())
+	assert.Equal(t, "300", myWin.App.Preferences().String("LedIntensity"))
+	assert.Equal(t, 300.0, myWin.flashIntensitySlider.Value)
+
+	myWin.serialPort = &fakeGFT{answers: []string{"[CMD flash range 2]", "[CMD flash range 2]"}}
+	assert.True(t, changeDeviceSetting("flash range", "flash range 2").accepted())
+	assert.Equal(t, "555", myWin.App.Preferences().String("LedIntensity"))
+
+	// A level the GFT does not accept leaves the preference alone
+	myWin.serialPort = &fakeGFT{answers: []string{"{ERROR invalid parameter}", "[CMD flash level 45]"}}
+	assert.False(t, changeDeviceSetting("flash level", "flash level 200").accepted())
+	assert.Equal(t, "555", myWin.App.Preferences().String("LedIntensity"))
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+const flashValidationFile = "FLASH_EDGE_VALIDATION.txt"
+
+// This is the layout of the timestamps produced by convertTimeObjectToTimestamp()
+const timestampLayout = "2006-01-02T15:04:05.000000"
+
+// A flash is considered to have lasted the commanded duration if the measured on to off
+// time is within this many seconds of it. The GFT switches the LED on the 1pps edge, so
+// the only error should be that of the tick interpolation.
+const flashDurationTolerance = 0.005
+
+// A goalpost flash must begin within this many seconds of the time it was scheduled for.
+// 'flash now' is sent on the P tick and the GFT waits for the next 1pps edge to act on it.
+const goalpostTimeTolerance = 2.0
+
+type timedFlashEdge struct {
+	number int       // edge number as written to FLASH_EDGE_TIMES (counting from 1)
+	on     bool      // true for a flash on edge
+	utc    time.Time // interpolated UTC time of the edge
+	gap    bool      // true if 1pps pulses were lost in the interval used to interpolate utc
+}
+
+type FlashValidation struct {
+	passed bool
+	lines  []string
+}
+
+func (v *FlashValidation) fail(format string, a ...any) {
+	v.passed = false
+	v.lines = append(v.lines, "FAIL: "+fmt.Sprintf(format, a...))
+}
+
+func (v *FlashValidation) warn(format string, a ...any) {
+	v.lines = append(v.lines, "warn: "+fmt.Sprintf(format, a...))
+}
+
+func (v *FlashValidation) pass(format string, a ...any) {
+	v.lines = append(v.lines, "ok:   "+fmt.Sprintf(format, a...))
+}
+
+func (v *FlashValidation) summary() string {
+	result := "PASSED"
+	if !v.passed {
+		result = "FAILED"
+	}
+	return fmt.Sprintf("Flash edge validation %s\n\n%s\n", result, strings.Join(v.lines, "\n"))
+}
+
+// validateFlashEdges checks that the edges form on/off pairs, that each flash lasted the
+// commanded duration (in seconds) and that there is one flash for each of the goalposts,
+// which are the unix times at which a 'flash now' was scheduled.
+func validateFlashEdges(edges []timedFlashEdge, commandedDuration int64, goalposts []int64) FlashValidation {
+	v := FlashValidation{passed: true}
+
+	if len(edges) != 2*len(goalposts) {
+		v.fail("found %d flash edges - expected %d (an on and an off for each of %d goalposts)",
+			len(edges), 2*len(goalposts), len(goalposts))
+	} else {
+		v.pass("found %d flash edges", len(edges))
+	}
+
+	for _, edge := range edges {
+		if edge.gap {
+			v.warn("edge %d was interpolated across lost 1pps pulses", edge.number)
+		}
+	}
+
+	var flashStarts []time.Time
+	for i := 0; i < len(edges); i++ {
+		if !edges[i].on {
+			v.fail("edge %d is an off edge without a preceding on edge", edges[i].number)
+			continue
+		}
+		if i+1 == len(edges) || edges[i+1].on {
+			v.fail("edge %d is an on edge without a following off edge", edges[i].number)
+			continue
+		}
+		on, off := edges[i], edges[i+1]
+		i++ // We have consumed the off edge of the pair
+
+		flashStarts = append(flashStarts, on.utc)
+		measured := off.utc.Sub(on.utc).Seconds()
+		if math.Abs(measured-float64(commandedDuration)) > flashDurationTolerance {
+			v.fail("flash (edges %d and %d) lasted %0.6f seconds - commanded duration was %d seconds",
+				on.number, off.number, measured, commandedDuration)
+		} else {
+			v.pass("flash (edges %d and %d) lasted %0.6f seconds - commanded duration was %d seconds",
+				on.number, off.number, measured, commandedDuration)
+		}
+	}
+
+	for k, goalpost := range goalposts {
+		expected := time.Unix(goalpost, 0).UTC()
+		if k >= len(flashStarts) {
+			v.fail("no flash found for goalpost %d scheduled at %s", k+1, expected.Format(time.DateTime))
+			continue
+		}
+		offBy := flashStarts[k].Sub(expected).Seconds()
+		if math.Abs(offBy) > goalpostTimeTolerance {
+			v.fail("goalpost %d started at %s - %0.3f seconds from its scheduled time of %s",
+				k+1, flashStarts[k].Format(timestampLayout), offBy, expected.Format(time.DateTime))
+		} else {
+			v.pass("goalpost %d started at %s (scheduled for %s)",
+				k+1, flashStarts[k].Format(timestampLayout), expected.Format(time.DateTime))
+		}
+	}
+	return v
+}
+
+// checkFlashCommand notes whether the GFT accepted the 'flash now' of a goalpost. A flash it did not
+// acknowledge may still have happened (the edges decide that), so it is only a warning.
+func (v *FlashValidation) checkFlashCommand(goalpost int, result CommandResult, known bool) {
+	switch {
+	case !known:
+		v.warn("goalpost %d: no record of the GFT answering its flash now", goalpost)
+	case result.accepted():
+		v.pass("goalpost %d: the GFT accepted its flash now %s", goalpost, result.response)
+	default:
+		v.warn("goalpost %d: %s", goalpost, result)
+	}
+}
+
+// validateRecordingFlashEdges validates the flash edges of the recording that has just ended and
+// writes the result next to FLASH_EDGE_TIMES.txt
+func validateRecordingFlashEdges(edges []timedFlashEdge) FlashValidation {
+	goalposts := []int64{myWin.firstFlashTime, myWin.secondFlashTime}
+	validation := validateFlashEdges(edges, myWin.flashDuration, goalposts)
+	for goalpost := range goalposts {
+		result, ok := goalpostCommands.result(goalpost + 1)
+		validation.checkFlashCommand(goalpost+1, result, ok)
+	}
+
+	err := os.WriteFile(myWin.flashValidationPath, []byte(validation.summary()), 0644)
+	if err != nil {
+		filesLog.Error("flash edge validation not written", "err", err)
+	}
+	level := slog.LevelInfo
+	if !validation.passed {
+		level = slog.LevelWarn
+	}
+	schedulerLog.Log(context.Background(), level, "flash edge validation", "passed", validation.passed,
+		"summary", validation.summary())
+	return validation
+}
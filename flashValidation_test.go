@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Goalposts start on the 1pps of 1_700_000_000 and 1_700_000_060: their flashes come on a second later
+var testGoalposts = []int64{1_700_000_000, 1_700_000_060}
+
+func Test_validateFlashEdgesPasses(t *testing.T) {
+	edges := []timedFlashEdge{
+		{number: 1, on: true, utc: time.Date(2023, 11, 14, 22, 13, 21, 0, time.UTC)},
+		{number: 2, on: false, utc: time.Date(2023, 11, 14, 22, 13, 23, 1_200_000, time.UTC)},
+		{number: 3, on: true, utc: time.Date(2023, 11, 14, 22, 14, 21, 0, time.UTC)},
+		{number: 4, on: false, utc: time.Date(2023, 11, 14, 22, 14, 23, 1_200_000, time.UTC)},
+	}
+	v := validateFlashEdges(edges, 2, testGoalposts)
+	assert.True(t, v.passed, v.summary())
+}
+
+func Test_validateFlashEdgesWrongDuration(t *testing.T) {
+	edges := []timedFlashEdge{
+		{number: 1, on: true, utc: time.Date(2023, 11, 14, 22, 13, 21, 0, time.UTC)},
+		{number: 2, on: false, utc: time.Date(2023, 11, 14, 22, 13, 22, 0, time.UTC)},
+		{number: 3, on: true, utc: time.Date(2023, 11, 14, 22, 14, 21, 0, time.UTC)},
+		{number: 4, on: false, utc: time.Date(2023, 11, 14, 22, 14, 22, 0, time.UTC)},
+	}
+	v := validateFlashEdges(edges, 2, testGoalposts)
+	assert.False(t, v.passed)
+	assert.Contains(t, v.summary(), "commanded duration was 2 seconds")
+}
+
+func Test_validateFlashEdgesBadPairing(t *testing.T) {
+	// The off edge of the first flash was lost
+	edges := []timedFlashEdge{
+		{number: 1, on: true, utc: time.Date(2023, 11, 14, 22, 13, 21, 0, time.UTC)},
+		{number: 3, on: true, utc: time.Date(2023, 11, 14, 22, 14, 21, 0, time.UTC)},
+		{number: 4, on: false, utc: time.Date(2023, 11, 14, 22, 14, 23, 0, time.UTC)},
+	}
+	v := validateFlashEdges(edges, 2, testGoalposts)
+	assert.False(t, v.passed)
+	assert.Contains(t, v.summary(), "edge 1 is an on edge without a following off edge")
+}
+
+func Test_validateFlashEdgesMissedGoalpost(t *testing.T) {
+	// The second flash came 10 seconds late
+	edges := []timedFlashEdge{
+		{number: 1, on: true, utc: time.Date(2023, 11, 14, 22, 13, 21, 0, time.UTC)},
+		{number: 2, on: false, utc: time.Date(2023, 11, 14, 22, 13, 23, 0, time.UTC)},
+		{number: 3, on: true, utc: time.Date(2023, 11, 14, 22, 14, 31, 0, time.UTC)},
+		{number: 4, on: false, utc: time.Date(2023, 11, 14, 22, 14, 33, 0, time.UTC)},
+	}
+	v := validateFlashEdges(edges, 2, testGoalposts)
+	assert.False(t, v.passed)
+	assert.Contains(t, v.summary(), "goalpost 2 started at")
+}
+
+func Test_calcEdgeTimestamp(t *testing.T) {
+	data := OnePPSdata{tickStamp: []TickStamp{
+		{utcTimestamp: "2024-03-01T00:00:05.000000", runningTickTime: 5_000_000},
+		{utcTimestamp: "2024-03-01T00:00:06.000000", runningTickTime: 6_000_000},
+		{utcTimestamp: "2024-03-01T00:00:07.000000", runningTickTime: 7_000_000},
+	}}
+
+	timestamp, left, ok := calcEdgeTimestamp(&data, 6_250_000)
+	assert.True(t, ok)
+	assert.Equal(t, 1, left)
+	assert.Equal(t, "2024-03-01T00:00:07.250000", timestamp)
+
+	// Edges outside the 1pps history are not extrapolated
+	_, _, ok = calcEdgeTimestamp(&data, 4_900_000)
+	assert.False(t, ok)
+	_, _, ok = calcEdgeTimestamp(&data, 7_100_000)
+	assert.False(t, ok)
+	_, _, ok = calcEdgeTimestamp(&OnePPSdata{}, 6_250_000)
+	assert.False(t, ok)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	offsetSourceDefault = "default" // the receiver has not yet downloaded the UTC parameters (offset ends in D)
+	offsetSourceAlmanac = "almanac" // the offset has been confirmed by the almanac
+)
+
+// An OffsetEpoch is a run of 1pps events during which the receiver reported the same GpsUtcOffset
+type OffsetEpoch struct {
+	firstUnixTime int64  // gpsData.unixTime when this offset was first reported
+	reported      string // GpsUtcOffset as reported by PUBX,04 (for example 16D or 18)
+	source        string // offsetSourceDefault or offsetSourceAlmanac
+	appliedOffset int    // GpsUtcOffset that the utcTimestamps of this epoch have been corrected to
+	rebased       bool   // true if the utcTimestamps of this epoch were shifted when the almanac arrived
+}
+
+func parseGpsUtcOffset(offset string) (int, error) {
+	return strconv.Atoi(strings.Replace(offset, "D", "", 1))
+}
+
+// noteGpsUtcOffset is called for every PUBX,04 sentence. It starts a new offset epoch whenever the
+// reported offset changes and, when the almanac offset arrives, rebases the tick stamps that were
+// corrected using a different offset.
+func noteGpsUtcOffset(data *OnePPSdata, reported string, unixTime int64) {
+	previousReported := ""
+	if n := len(data.offsetEpochs); n > 0 {
+		previousReported = data.offsetEpochs[n-1].reported
+		if previousReported == reported {
+			return
+		}
+	}
+
+	source := offsetSourceAlmanac
+	if strings.Contains(reported, "D") {
+		source = offsetSourceDefault
+	}
+	applied, _ := parseGpsUtcOffset(getGpsUtcOffset())
+	data.offsetEpochs = append(data.offsetEpochs, OffsetEpoch{
+		firstUnixTime: unixTime,
+		reported:      reported,
+		source:        source,
+		appliedOffset: applied,
+	})
+	timingLog.Info("GpsUtcOffset epoch started", "epoch", len(data.offsetEpochs)-1, "unixTime", unixTime,
+		"reported", reported, "source", source, "appliedOffset", applied)
+
+	if previousReported == "" {
+		return
+	}
+
+	// The GPRMC time (and so gpsData.unixTime) steps when the receiver changes its offset.
+	// runApp uses this to recognize the step as an offset change rather than as lost 1pps pulses.
+	oldValue, err1 := parseGpsUtcOffset(previousReported)
+	newValue, err2 := parseGpsUtcOffset(reported)
+	if err1 == nil && err2 == nil {
+		data.pendingUnixTimeStep += int64(oldValue - newValue)
+	}
+
+	if source == offsetSourceAlmanac {
+		rebaseTickStamps(data, applied)
+	}
+}
+
+// rebaseTickStamps shifts the utcTimestamp of every tick stamp (and the startTime) that was corrected
+// to UTC using a default offset different from correctOffset. Almanac epochs are left alone: an almanac
+// offset that changes (a leap second) was right for the stamps made while it applied.
+func rebaseTickStamps(data *OnePPSdata, correctOffset int) {
+	for i := range data.offsetEpochs {
+		epoch := &data.offsetEpochs[i]
+		if epoch.source != offsetSourceDefault || epoch.appliedOffset == correctOffset {
+			continue
+		}
+		shift := float64(epoch.appliedOffset - correctOffset)
+		count := 0
+		for j := range data.tickStamp {
+			if data.tickStamp[j].offsetEpoch == i {
+				data.tickStamp[j].utcTimestamp = calcAdderToTimestamp(data.tickStamp[j].utcTimestamp, shift)
+				count++
+			}
+		}
+		if data.startTime != "" && data.startEpoch == i {
+			data.startTime = calcAdderToTimestamp(data.startTime, shift)
+		}
+		timingLog.Info("tick stamps rebased", "epoch", i, "reported", epoch.reported, "count", count,
+			"shiftSeconds", shift, "gpsUtcOffset", correctOffset)
+		epoch.appliedOffset = correctOffset
+		epoch.rebased = true
+	}
+}
+
+func currentOffsetEpoch(data *OnePPSdata) int {
+	return len(data.offsetEpochs) - 1
+}
+
+// offsetSourceLabel describes the GpsUtcOffset that applied to a tick stamp
+func offsetSourceLabel(data *OnePPSdata, epochIndex int) string {
+	if epochIndex < 0 || epochIndex >= len(data.offsetEpochs) {
+		return "unknown"
+	}
+	epoch := data.offsetEpochs[epochIndex]
+	if epoch.rebased {
+		return fmt.Sprintf("%s-rebased-to-%d", epoch.source, epoch.appliedOffset)
+	}
+	return epoch.source
+}
+
+// offsetEpochLines describes every offset epoch of this session for the flash edge file
+func offsetEpochLines(data *OnePPSdata) []string {
+	var lines []string
+	for i, epoch := range data.offsetEpochs {
+		lines = append(lines, fmt.Sprintf("# GpsUtcOffset epoch %d: from unixTime %d reported %s (%s) applied %d",
+			i, epoch.firstUnixTime, epoch.reported, offsetSourceLabel(data, i), epoch.appliedOffset))
+	}
+	return lines
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func Test_rebaseTickStamps(t *testing.T) {
+	data := OnePPSdata{
+		startTime:  "2024-03-01T10:00:00.000000",
+		startEpoch: 0,
+		tickStamp: []TickStamp{
+			{utcTimestamp: "2024-03-01T10:00:00.000000", offsetEpoch: 0},
+			{utcTimestamp: "2024-03-01T10:00:01.000000", offsetEpoch: 0},
+			{utcTimestamp: "2024-03-01T10:00:02.000000", offsetEpoch: 1},
+		},
+		offsetEpochs: []OffsetEpoch{
+			{reported: "16D", source: offsetSourceDefault, appliedOffset: 17},
+			{reported: "18", source: offsetSourceAlmanac, appliedOffset: 18},
+		},
+	}
+	rebaseTickStamps(&data, 18)
+
+	// Epoch 0 was corrected assuming 17 leap seconds - its time stamps must move back 1 second
+	assert.Equal(t, "2024-03-01T09:59:59.000000", data.startTime)
+	assert.Equal(t, "2024-03-01T09:59:59.000000", data.tickStamp[0].utcTimestamp)
+	assert.Equal(t, "2024-03-01T10:00:00.000000", data.tickStamp[1].utcTimestamp)
+	assert.Equal(t, "2024-03-01T10:00:02.000000", data.tickStamp[2].utcTimestamp)
+	assert.True(t, data.offsetEpochs[0].rebased)
+	assert.False(t, data.offsetEpochs[1].rebased)
+	assert.Equal(t, "default-rebased-to-18", offsetSourceLabel(&data, 0))
+	assert.Equal(t, "almanac", offsetSourceLabel(&data, 1))
+}
+
+func Test_rebaseTickStampsKeepsAlmanacEpochs(t *testing.T) {
+	// A leap second: the almanac offset steps from 18 to 19
+	data := OnePPSdata{
+		startTime:  "2024-03-01T10:00:00.000000",
+		startEpoch: 0,
+		tickStamp: []TickStamp{
+			{utcTimestamp: "2024-03-01T10:00:00.000000", offsetEpoch: 0},
+			{utcTimestamp: "2024-03-01T10:00:01.000000", offsetEpoch: 0},
+			{utcTimestamp: "2024-03-01T10:00:02.000000", offsetEpoch: 1},
+		},
+		offsetEpochs: []OffsetEpoch{
+			{reported: "18", source: offsetSourceAlmanac, appliedOffset: 18},
+			{reported: "19", source: offsetSourceAlmanac, appliedOffset: 19},
+		},
+	}
+	rebaseTickStamps(&data, 19)
+
+	assert.Equal(t, "2024-03-01T10:00:00.000000", data.startTime)
+	assert.Equal(t, "2024-03-01T10:00:00.000000", data.tickStamp[0].utcTimestamp)
+	assert.Equal(t, "2024-03-01T10:00:01.000000", data.tickStamp[1].utcTimestamp)
+	assert.Equal(t, 18, data.offsetEpochs[0].appliedOffset)
+	assert.False(t, data.offsetEpochs[0].rebased)
+	assert.Equal(t, "almanac", offsetSourceLabel(&data, 0))
+}
+
+func Test_noteGpsUtcOffsetRecordsUnixTimeStep(t *testing.T) {
+	data := OnePPSdata{}
+	noteGpsUtcOffset(&data, "16D", 1000)
+	noteGpsUtcOffset(&data, "16D", 1001)
+	assert.Equal(t, 1, len(data.offsetEpochs))
+	assert.Equal(t, int64(0), data.pendingUnixTimeStep)
+
+	noteGpsUtcOffset(&data, "18", 1002)
+	assert.Equal(t, 2, len(data.offsetEpochs))
+	assert.Equal(t, int64(-2), data.pendingUnixTimeStep)
+	assert.Equal(t, offsetSourceAlmanac, data.offsetEpochs[1].source)
+}
+
+func Test_writeFlashEdgeTimesOffsetComments(t *testing.T) {
+	data := OnePPSdata{
+		startTime: "2024-03-01T10:00:00.000000",
+		tickStamp: []TickStamp{
+			{utcTimestamp: "2024-03-01T09:59:59.000000", runningTickTime: 1_000_000, offsetEpoch: 0},
+			{utcTimestamp: "2024-03-01T10:00:00.000000", runningTickTime: 2_000_000, offsetEpoch: 0},
+		},
+		offsetEpochs: []OffsetEpoch{
+			{reported: "16D", source: offsetSourceDefault, appliedOffset: 18, rebased: true},
+		},
+	}
+	var sb strings.Builder
+	writeFlashEdgeTimes(&sb, &data, []FlashEdge{{edgeTime: 1_500_000, on: true}}, calcEdgeTimestamp)
+
+	// The edge line keeps its format: the source of the offset is in a comment line before it
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	assert.Equal(t, "# edge 1: GpsUtcOffset 18 (default-rebased-to-18)", lines[len(lines)-2])
+	assert.Equal(t, "1 on  2024-03-01T10:00:00.500000Z|18", lines[len(lines)-1])
+}
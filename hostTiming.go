@@ -0,0 +1,359 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const hostLatencyFile = "HOST_LATENCY.txt"
+
+// appStartTime carries the monotonic clock reading that host receive times are measured from, so that
+// they are not disturbed when the computer clock is stepped
+var appStartTime = time.Now()
+
+// A ReceivedSentence is what getNextSentence sends: the sentence and the host time at which the
+// "\r\n" that ends it was found
+type ReceivedSentence struct {
+	text     string
+	hostTime time.Time
+}
+
+// A HostEvent records when a command that the app sent on a scheduled 1pps was sent and answered
+type HostEvent struct {
+	name         string    // the command, such as "start"
+	unixTime     int64     // gpsData.unixTime of the 1pps it was sent on
+	ppsHostTime  time.Time // when the P sentence of that 1pps was received
+	sentTime     time.Time // host time when the command was sent
+	responseTime time.Time // host time when its response was received
+}
+
+// hostMonotonic returns the time since the app started, by the monotonic clock when t has a reading of it
+func hostMonotonic(t time.Time) time.Duration {
+	return t.Sub(appStartTime)
+}
+
+// hostTimeColumn is appended (after a tab) to every sentence written to the sentence log when the
+// HostTimeColumn preference is set: the host receive time by the computer clock in UTC and then by the
+// monotonic clock in seconds since the app started
+func hostTimeColumn(wall time.Time, monotonic time.Duration) string {
+	return fmt.Sprintf("\t%s %.6f", wall.UTC().Format("2006-01-02T15:04:05.000000Z"), monotonic.Seconds())
+}
+
+// stripHostTimeColumn returns a sentence log line without its host time column
+func stripHostTimeColumn(line string) string {
+	sentence, _, _ := strings.Cut(line, "\t")
+	return sentence
+}
+
+// processHostTimeColumnCheck turns the host time column of the sentence log on or off from the next sentence
+func processHostTimeColumnCheck(checked bool) {
+	myWin.App.Preferences().SetBool("HostTimeColumn", checked)
+	if myWin.logFile != nil {
+		myWin.logFile.hostTimes = checked
+	}
+}
+
+// timedSharpCapCommand sends a command to SharpCap on the 1pps being processed and records when it was
+// sent and answered
+func timedSharpCapCommand(cmd string) string {
+	event := HostEvent{name: cmd, unixTime: gpsData.unixTime, ppsHostTime: gpsData.hostTime, sentTime: time.Now()}
+	response := getResponse(myWin.SharpCapConn, cmd)
+	event.responseTime = time.Now()
+	myWin.hostEvents = append(myWin.hostEvents, event)
+	return response
+}
+
+type LatencyStats struct {
+	count                 int
+	min, median, p95, max time.Duration
+}
+
+func calcLatencyStats(latencies []time.Duration) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	n := len(sorted)
+	return LatencyStats{
+		count:  n,
+		min:    sorted[0],
+		median: sorted[n/2],
+		p95:    sorted[min(n-1, n*95/100)],
+		max:    sorted[n-1],
+	}
+}
+
+// ppsHostLatencies returns, for every 1pps in the history that has a host receive time, how long after
+// the GPS second the computer clock says its P sentence arrived. That is the USB/serial delay plus
+// the offset of the computer clock.
+func ppsHostLatencies(data *OnePPSdata) []time.Duration {
+	var latencies []time.Duration
+	for _, tick := range data.tickStamp {
+		if tick.hostTime.IsZero() || tick.utcTimestamp == "" {
+			continue
+		}
+		utc, err := convertTimestampToTimeObject(tick.utcTimestamp)
+		if err != nil {
+			continue
+		}
+		latencies = append(latencies, tick.hostTime.Round(0).Sub(utc))
+	}
+	return latencies
+}
+
+func formatMs(d time.Duration) string {
+	return fmt.Sprintf("%.3f ms", float64(d)/float64(time.Millisecond))
+}
+
+// A PPSClock converts host times to UTC. It is a straight line (the rate error of the computer clock) fitted
+// to the host receive times of the P sentences around the time converted, moved down onto the P sentence
+// that arrived soonest, since USB and the serial port can only delay a P sentence.
+type PPSClock struct {
+	refHost time.Time // host time of the first P sentence used
+	refUTC  time.Time // its GPS second
+	offset  float64   // seconds from refHost to the arrival of an undelayed P sentence at refUTC
+	rate    float64   // host seconds per GPS second
+	jitter  float64   // seconds that the most delayed P sentence used arrived later than the soonest one
+}
+
+// fitPPSClock fits a PPSClock to the P sentences received within halfWindow seconds of host time around.
+// It needs P sentences from at least 2 different GPS seconds.
+func fitPPSClock(data *OnePPSdata, around time.Time, halfWindow time.Duration) (PPSClock, error) {
+	var clock PPSClock
+	var xs, ys []float64
+	for _, tick := range data.tickStamp {
+		if tick.hostTime.IsZero() || tick.hostTime.Sub(around).Abs() > halfWindow {
+			continue
+		}
+		utc, err := convertTimestampToTimeObject(tick.utcTimestamp)
+		if err != nil {
+			continue
+		}
+		if len(xs) == 0 {
+			clock.refHost, clock.refUTC = tick.hostTime, utc
+		}
+		xs = append(xs, utc.Sub(clock.refUTC).Seconds())
+		ys = append(ys, tick.hostTime.Sub(clock.refHost).Seconds())
+	}
+	if len(xs) < 2 {
+		return PPSClock{}, errors.New("fitPPSClock(): fewer than 2 P sentences in the window")
+	}
+
+	var sumX, sumY, sumXX, sumXY float64
+	n := float64(len(xs))
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+		sumXX += xs[i] * xs[i]
+		sumXY += xs[i] * ys[i]
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return PPSClock{}, errors.New("fitPPSClock(): the P sentences in the window are all for the same GPS second")
+	}
+	clock.rate = (n*sumXY - sumX*sumY) / denominator
+	clock.offset = (sumY - clock.rate*sumX) / n
+	lowest, highest := 0.0, 0.0
+	for i := range xs {
+		residual := ys[i] - (clock.offset + clock.rate*xs[i])
+		lowest, highest = min(lowest, residual), max(highest, residual)
+	}
+	clock.offset += lowest
+	clock.jitter = highest - lowest
+	return clock, nil
+}
+
+// utc returns the GPS (UTC) time of host time t
+func (c PPSClock) utc(t time.Time) time.Time {
+	seconds := (t.Sub(c.refHost).Seconds() - c.offset) / c.rate
+	return c.refUTC.Add(time.Duration(seconds * float64(time.Second)))
+}
+
+const (
+	latencyHistoryFile = "IotaGFT_sharpcap_latency.txt"
+	ppsClockHalfWindow = 30 * time.Second
+	histogramBinWidth  = 25 * time.Millisecond
+	histogramBins      = 20 // the last bin collects everything later
+)
+
+// A LatencyRecord is how long after the GPS second of its 1pps a SharpCap command was sent and answered
+type LatencyRecord struct {
+	unixTime int64
+	name     string
+	sent     time.Duration
+	response time.Duration
+}
+
+// eventLatencies times the events against the PPSClock. Events without P sentence receive times are left out.
+func eventLatencies(data *OnePPSdata, events []HostEvent) []LatencyRecord {
+	var records []LatencyRecord
+	for _, event := range events {
+		clock, err := fitPPSClock(data, event.sentTime, ppsClockHalfWindow)
+		if err != nil {
+			continue
+		}
+		second := time.Unix(event.unixTime, 0)
+		records = append(records, LatencyRecord{
+			unixTime: event.unixTime,
+			name:     event.name,
+			sent:     clock.utc(event.sentTime).Sub(second),
+			response: clock.utc(event.responseTime).Sub(second),
+		})
+	}
+	return records
+}
+
+func appendLatencyHistory(path string, records []LatencyRecord) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("appendLatencyHistory(): %w", err)
+	}
+	defer file.Close()
+	for _, record := range records {
+		_, err = fmt.Fprintf(file, "%s %s %.3f %.3f\n", time.Unix(record.unixTime, 0).UTC().Format(time.DateTime),
+			record.name, record.sent.Seconds()*1000, record.response.Seconds()*1000)
+		if err != nil {
+			return fmt.Errorf("appendLatencyHistory(): %w", err)
+		}
+	}
+	return nil
+}
+
+// readLatencyHistory reads the latency history of all sessions. Lines that cannot be read are skipped.
+func readLatencyHistory(path string) ([]LatencyRecord, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []LatencyRecord
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			continue
+		}
+		second, err := time.Parse(time.DateTime, fields[0]+" "+fields[1])
+		if err != nil {
+			continue
+		}
+		sent, err1 := strconv.ParseFloat(fields[3], 64)
+		response, err2 := strconv.ParseFloat(fields[4], 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		records = append(records, LatencyRecord{
+			unixTime: second.Unix(),
+			name:     fields[2],
+			sent:     time.Duration(sent * float64(time.Millisecond)),
+			response: time.Duration(response * float64(time.Millisecond)),
+		})
+	}
+	return records, nil
+}
+
+// writeLatencyHistogram writes a text histogram of latencies in histogramBinWidth bins
+func writeLatencyHistogram(w io.Writer, latencies []time.Duration) {
+	counts := make([]int, histogramBins)
+	for _, latency := range latencies {
+		bin := min(histogramBins-1, max(0, int(latency/histogramBinWidth)))
+		counts[bin]++
+	}
+	last := 0
+	for i, count := range counts {
+		if count > 0 {
+			last = i
+		}
+	}
+	for i := 0; i <= last; i++ {
+		label := fmt.Sprintf("%4d - %4d ms", i*int(histogramBinWidth/time.Millisecond), (i+1)*int(histogramBinWidth/time.Millisecond))
+		if i == histogramBins-1 {
+			label = fmt.Sprintf("%4d ms and up", i*int(histogramBinWidth/time.Millisecond))
+		}
+		_, _ = fmt.Fprintf(w, "  %s %4d %s\n", label, counts[i], strings.Repeat("#", counts[i]))
+	}
+}
+
+// writeHostLatencyReport reports when P sentences reached the computer, when the SharpCap commands of the
+// session were sent and answered relative to the GPS second they were sent on, and the histograms of
+// those latencies across all sessions in history
+func writeHostLatencyReport(w io.Writer, data *OnePPSdata, events []HostEvent, history []LatencyRecord, leaderSeconds int64) {
+	stats := calcLatencyStats(ppsHostLatencies(data))
+	_, _ = fmt.Fprintf(w, "# IotaGFTapp %s host latency report\n", Version)
+	_, _ = fmt.Fprintf(w, "# P sentence receive time by the computer clock minus its GPS second (USB delay + computer clock offset)\n")
+	if stats.count == 0 {
+		_, _ = fmt.Fprintf(w, "no 1pps with a host receive time\n")
+	} else {
+		_, _ = fmt.Fprintf(w, "1pps count %d  min %s  median %s  p95 %s  max %s\n", stats.count,
+			formatMs(stats.min), formatMs(stats.median), formatMs(stats.p95), formatMs(stats.max))
+	}
+
+	_, _ = fmt.Fprintf(w, "# SharpCap commands: when they were sent after the P sentence arrived, and when they were sent and\n")
+	_, _ = fmt.Fprintf(w, "# answered after the GPS second by the computer clock disciplined to the 1pps\n")
+	for _, event := range events {
+		second := time.Unix(event.unixTime, 0).UTC().Format(time.DateTime)
+		_, _ = fmt.Fprintf(w, "%-6s on the 1pps of %s:", event.name, second)
+		if event.ppsHostTime.IsZero() {
+			_, _ = fmt.Fprintf(w, " no P sentence receive time\n")
+			continue
+		}
+		_, _ = fmt.Fprintf(w, " sent %s after the P sentence", formatMs(event.sentTime.Sub(event.ppsHostTime)))
+		records := eventLatencies(data, []HostEvent{event})
+		if len(records) == 1 {
+			_, _ = fmt.Fprintf(w, ", sent %s and answered %s after the GPS second",
+				formatMs(records[0].sent), formatMs(records[0].response))
+			if event.name == "start" && leaderSeconds > 0 && records[0].response >= time.Duration(leaderSeconds)*time.Second {
+				_, _ = fmt.Fprintf(w, " - LATER THAN THE %d s LEADER", leaderSeconds)
+			}
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+
+	for _, name := range []string{"start", "stop"} {
+		var latencies []time.Duration
+		for _, record := range history {
+			if record.name == name {
+				latencies = append(latencies, record.response)
+			}
+		}
+		if len(latencies) == 0 {
+			continue
+		}
+		historyStats := calcLatencyStats(latencies)
+		_, _ = fmt.Fprintf(w, "# %s answered after the GPS second, all sessions: count %d  median %s  p95 %s  max %s\n", name,
+			historyStats.count, formatMs(historyStats.median), formatMs(historyStats.p95), formatMs(historyStats.max))
+		writeLatencyHistogram(w, latencies)
+	}
+}
+
+// saveHostLatencyReport adds the SharpCap latencies of the session to the history in the work directory
+// and writes the host latency report into the session directory
+func saveHostLatencyReport(dir string) {
+	historyPath := filepath.Join(getWorkDir(), latencyHistoryFile)
+	err := appendLatencyHistory(historyPath, eventLatencies(&onePPSdata, myWin.hostEvents))
+	if err != nil {
+		timingLog.Error("SharpCap latency history not updated", "err", err)
+	}
+	history, err := readLatencyHistory(historyPath)
+	if err != nil {
+		timingLog.Error("SharpCap latency history not read", "err", err)
+	}
+
+	file, err := os.Create(filepath.Join(dir, hostLatencyFile))
+	if err != nil {
+		timingLog.Error("host latency report not written", "err", err)
+		return
+	}
+	defer file.Close()
+	var leaderSeconds int64
+	if myWin.leaderStartTime != 0 {
+		leaderSeconds = myWin.firstFlashTime - myWin.leaderStartTime
+	}
+	writeHostLatencyReport(file, &onePPSdata, myWin.hostEvents, history, leaderSeconds)
+}
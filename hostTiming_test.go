@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// makeHostTimedTickStamps gives 20 1pps that reach a computer with a clock 0.5 s fast and running 50 ppm
+// fast 4, 5 or 6 ms after their GPS second
+func makeHostTimedTickStamps() OnePPSdata {
+	data := OnePPSdata{tickStamp: makeTickStamps(20)}
+	for i := range data.tickStamp {
+		utc, _ := convertTimestampToTimeObject(data.tickStamp[i].utcTimestamp)
+		drift := time.Duration(i) * 50 * time.Microsecond
+		data.tickStamp[i].hostTime = utc.Add(500*time.Millisecond + drift + time.Duration(4+i%3)*time.Millisecond)
+	}
+	return data
+}
+
+func Test_fitPPSClock(t *testing.T) {
+	data := makeHostTimedTickStamps()
+	data.tickStamp[0].hostTime = time.Time{} // a 1pps restored from the journal has no host time
+
+	clock, err := fitPPSClock(&data, data.tickStamp[10].hostTime, ppsClockHalfWindow)
+	assert.Nil(t, err)
+	assert.InDelta(t, 1.00005, clock.rate, 20e-6) // the USB delays bias the fitted rate a little
+
+	// The P sentences that arrived soonest (4 ms late) define the GPS seconds
+	second6 := time.Date(2024, 3, 1, 0, 0, 6, 0, time.UTC)
+	assert.InDelta(t, 0, clock.utc(data.tickStamp[6].hostTime).Sub(second6), float64(50*time.Microsecond))
+	assert.InDelta(t, float64(12*time.Millisecond),
+		clock.utc(data.tickStamp[6].hostTime.Add(12*time.Millisecond)).Sub(second6), float64(50*time.Microsecond))
+
+	_, err = fitPPSClock(&data, data.tickStamp[10].hostTime.Add(time.Hour), ppsClockHalfWindow)
+	assert.NotNil(t, err)
+
+	// P sentences that all carry the same GPS second give no rate
+	for i := range data.tickStamp {
+		data.tickStamp[i].utcTimestamp = data.tickStamp[1].utcTimestamp
+	}
+	_, err = fitPPSClock(&data, data.tickStamp[10].hostTime, ppsClockHalfWindow)
+	assert.NotNil(t, err)
+}
+
+func Test_hostLatencyReport(t *testing.T) {
+	data := makeHostTimedTickStamps()
+	stats := calcLatencyStats(ppsHostLatencies(&data))
+	assert.Equal(t, 20, stats.count)
+	assert.Equal(t, 504*time.Millisecond, stats.min)
+	assert.Equal(t, 506850*time.Microsecond, stats.max)
+
+	leaderP := data.tickStamp[6].hostTime // arrived 4 ms late
+	events := []HostEvent{
+		{name: "start", unixTime: 1709251206, ppsHostTime: leaderP, sentTime: leaderP.Add(1500 * time.Microsecond),
+			responseTime: leaderP.Add(2*time.Second + 496*time.Millisecond)},
+		{name: "stop", unixTime: 1709251215},
+	}
+	records := eventLatencies(&data, events)
+	assert.Equal(t, 1, len(records))
+	assert.InDelta(t, float64(1500*time.Microsecond), records[0].sent, float64(100*time.Microsecond))
+	assert.InDelta(t, float64(2496*time.Millisecond), records[0].response, float64(200*time.Microsecond))
+
+	historyPath := filepath.Join(t.TempDir(), latencyHistoryFile)
+	assert.Nil(t, appendLatencyHistory(historyPath, records))
+	assert.Nil(t, appendLatencyHistory(historyPath, []LatencyRecord{{unixTime: 1709000000, name: "start", response: 30 * time.Millisecond}}))
+	history, err := readLatencyHistory(historyPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+	assert.Equal(t, "start", history[0].name)
+	assert.InDelta(t, float64(records[0].response), history[0].response, float64(time.Microsecond))
+
+	var report bytes.Buffer
+	writeHostLatencyReport(&report, &data, events, history, 2)
+	assert.Contains(t, report.String(), "1pps count 20  min 504.000 ms")
+	assert.Contains(t, report.String(), "start  on the 1pps of 2024-03-01 00:00:06: sent 1.500 ms after the P sentence, sent ")
+	assert.Contains(t, report.String(), " ms after the GPS second - LATER THAN THE 2 s LEADER\n")
+	assert.Contains(t, report.String(), "stop   on the 1pps of 2024-03-01 00:00:15: no P sentence receive time\n")
+	assert.Contains(t, report.String(), "# start answered after the GPS second, all sessions: count 2")
+	assert.Contains(t, report.String(), "    25 -   50 ms    1 #\n")
+	assert.Contains(t, report.String(), "   475 ms and up    1 #\n")
+}
+
+func Test_stripHostTimeColumn(t *testing.T) {
+	column := hostTimeColumn(time.Date(2024, 3, 1, 0, 0, 5, 123456000, time.UTC), 12345678*time.Microsecond)
+	assert.Equal(t, "\t2024-03-01T00:00:05.123456Z 12.345678", column)
+	assert.Equal(t, "{00000001 P}*77", stripHostTimeColumn("{00000001 P}*77"+column))
+	assert.Equal(t, "{00000001 P}*77", stripHostTimeColumn("{00000001 P}*77"))
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2/widget"
+)
+
+// While a recording is armed its schedule and timing events are appended to this file (in the directory
+// the app is started from) so that the recording can be resumed if the app is restarted
+const journalFile = "IotaGFT_journal.txt"
+
+// Tick, gap and edge records are flushed to disk at most this often. Every record is written to the
+// file at once, so only a crash of the computer itself can lose the last of them.
+const journalSyncInterval = 5 * time.Second
+
+// Journal record types
+const (
+	journalArm    = "arm"    // the recording was armed (the schedule is in the record)
+	journalStep   = "step"   // the scheduler passed a step (leader, flashOne, flashTwo or end)
+	journalTick   = "tick"   // a 1pps tick stamp
+	journalEdge   = "edge"   // a flash edge
+	journalGap    = "gap"    // lost 1pps pulses
+	journalResume = "resume" // the app was restarted and resumed the recording
+	journalClose  = "close"  // the recording ended, was cancelled or was reconstructed
+)
+
+// A JournalRecord is one line of the journal. Only the fields that apply to its type are written.
+type JournalRecord struct {
+	Type     string `json:"type"`
+	Host     string `json:"host"` // computer clock time the record was written
+	UnixTime int64  `json:"unixTime,omitempty"`
+
+	// arm
+	LeaderStart       int64   `json:"leaderStart,omitempty"`
+	FlashOne          int64   `json:"flashOne,omitempty"`
+	FlashTwo          int64   `json:"flashTwo,omitempty"`
+	End               int64   `json:"end,omitempty"`
+	FlashDuration     int64   `json:"flashDuration,omitempty"`
+	RecordingDuration float64 `json:"recordingDuration,omitempty"`
+	UTCEventTime      string  `json:"utcEventTime,omitempty"`
+
+	// step and close
+	Step string `json:"step,omitempty"`
+
+	// tick, edge and gap
+	UTC     string `json:"utc,omitempty"`
+	GPS     string `json:"gps,omitempty"`
+	Tick    int64  `json:"tick,omitempty"`
+	Offset  string `json:"offset,omitempty"`  // GpsUtcOffset reported for the tick stamp
+	Applied int    `json:"applied,omitempty"` // GpsUtcOffset that utc was corrected with
+	On      bool   `json:"on,omitempty"`
+	Lost    int64  `json:"lost,omitempty"`
+}
+
+// A Journal appends records to the journal file. Records that change the schedule are flushed to disk
+// before returning, timing events every journalSyncInterval.
+type Journal struct {
+	path        string
+	file        *os.File
+	lastSync    time.Time
+	leaderStart int64
+	lastTick    int64 // runningTickTime of the last tick stamp journaled
+	tickIndex   int   // index in the 1pps history of the tick stamp after it, if the history has not been trimmed
+	lastGap     int64 // runningTickTime of the last gap journaled
+	edges       int   // number of flash edges journaled
+}
+
+func openJournal(path string, truncate bool) (*Journal, error) {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if truncate {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("openJournal(): %w", err)
+	}
+	if !truncate {
+		// Start on a new line in case the last record was only partly written
+		_, _ = file.WriteString("\n")
+	}
+	return &Journal{path: path, file: file, lastSync: time.Now(), lastTick: math.MinInt64, lastGap: math.MinInt64}, nil
+}
+
+func (j *Journal) append(record JournalRecord) {
+	if j == nil {
+		return
+	}
+	now := time.Now()
+	record.Host = now.UTC().Format(time.RFC3339Nano)
+	line, err := json.Marshal(record)
+	if err == nil {
+		_, err = j.file.Write(append(line, '\n'))
+	}
+	timingEvent := record.Type == journalTick || record.Type == journalGap || record.Type == journalEdge
+	if err == nil && (!timingEvent || now.Sub(j.lastSync) >= journalSyncInterval) {
+		err = j.file.Sync()
+		j.lastSync = now
+	}
+	if err != nil {
+		schedulerLog.Error("journal record not written", "type", record.Type, "err", err)
+	}
+}
+
+func (j *Journal) step(step string, unixTime int64) {
+	j.append(JournalRecord{Type: journalStep, Step: step, UnixTime: unixTime})
+}
+
+// recordTimingEvents journals the tick stamps, gaps and flash edges that have been added since the last
+// call. Tick stamps are only needed from shortly before the leader starts.
+func (j *Journal) recordTimingEvents(data *OnePPSdata, edges []FlashEdge, unixTime int64) {
+	if j == nil {
+		return
+	}
+	if unixTime >= j.leaderStart-ppsProtectionMargin {
+		for j.tickIndex = j.nextTickIndex(data.tickStamp); j.tickIndex < len(data.tickStamp); j.tickIndex++ {
+			ts := data.tickStamp[j.tickIndex]
+			record := JournalRecord{Type: journalTick, UnixTime: unixTime, UTC: ts.utcTimestamp,
+				GPS: ts.gpsTimestamp, Tick: ts.runningTickTime}
+			if ts.offsetEpoch >= 0 && ts.offsetEpoch < len(data.offsetEpochs) {
+				record.Offset = data.offsetEpochs[ts.offsetEpoch].reported
+				record.Applied = data.offsetEpochs[ts.offsetEpoch].appliedOffset
+			}
+			j.append(record)
+			j.lastTick = ts.runningTickTime
+		}
+	}
+	for _, gap := range data.gaps {
+		if gap.runningTickTime <= j.lastGap {
+			continue
+		}
+		j.append(JournalRecord{Type: journalGap, UnixTime: gap.unixTime, UTC: gap.utcTimestamp,
+			Tick: gap.runningTickTime, Lost: gap.lostPulses})
+		j.lastGap = gap.runningTickTime
+	}
+	for ; j.edges < len(edges); j.edges++ {
+		j.append(JournalRecord{Type: journalEdge, UnixTime: unixTime, Tick: edges[j.edges].edgeTime,
+			On: edges[j.edges].on})
+	}
+}
+
+// nextTickIndex returns the index of the first tick stamp not yet journaled. The index left by the last
+// call is used unless the 1pps history has since been trimmed or replaced.
+func (j *Journal) nextTickIndex(stamps []TickStamp) int {
+	i := j.tickIndex
+	if i > 0 && i <= len(stamps) && stamps[i-1].runningTickTime == j.lastTick {
+		return i
+	}
+	if i == 0 && (len(stamps) == 0 || stamps[0].runningTickTime > j.lastTick) {
+		return 0
+	}
+	return sort.Search(len(stamps), func(k int) bool { return stamps[k].runningTickTime > j.lastTick })
+}
+
+// close writes the final record and keeps the journal with the current session as a record of the recording
+func (j *Journal) close(reason string) {
+	if j == nil {
+		return
+	}
+	j.append(JournalRecord{Type: journalClose, Step: reason})
+	_ = j.file.Close()
+	if myWin.sessionDir != "" {
+		err := copyFile(j.path, filepath.Join(myWin.sessionDir, journalFile))
+		if err != nil {
+			filesLog.Error("journal not copied to the session", "err", err)
+		}
+	}
+	err := os.Remove(j.path)
+	if err != nil {
+		filesLog.Error("journal not removed", "err", err)
+	}
+}
+
+// startJournal is called when a recording has been armed
+func startJournal() {
+	myWin.journal.close("rearmed") // never expected, but an older journal must not be mixed in
+	journal, err := openJournal(filepath.Join(getWorkDir(), journalFile), true)
+	if err != nil {
+		schedulerLog.Error("journal not started - the recording cannot be resumed after a restart", "err", err)
+		myWin.journal = nil
+		return
+	}
+	journal.leaderStart = myWin.leaderStartTime
+	if n := len(onePPSdata.tickStamp); n > 0 {
+		journal.lastTick = onePPSdata.tickStamp[n-1].runningTickTime
+	}
+	if n := len(onePPSdata.gaps); n > 0 {
+		journal.lastGap = onePPSdata.gaps[n-1].runningTickTime
+	}
+	journal.edges = len(flashEdges)
+	journal.append(JournalRecord{
+		Type:              journalArm,
+		UnixTime:          gpsData.unixTime,
+		LeaderStart:       myWin.leaderStartTime,
+		FlashOne:          myWin.firstFlashTime,
+		FlashTwo:          myWin.secondFlashTime,
+		End:               myWin.endOfRecording,
+		FlashDuration:     myWin.flashDuration,
+		RecordingDuration: myWin.recordingDuration,
+		UTCEventTime:      myWin.utcEventTime.Text,
+	})
+	myWin.journal = journal
+}
+
+// closeJournal is called when the armed recording ends or is cancelled
+func closeJournal(reason string) {
+	myWin.journal.close(reason)
+	myWin.journal = nil
+}
+
+// readJournal returns the records of a journal. A last line that was only partly written (because the
+// app was stopped while writing it) is ignored.
+func readJournal(path string) ([]JournalRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []JournalRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var record JournalRecord
+		if json.Unmarshal([]byte(line), &record) != nil {
+			schedulerLog.Warn("malformed journal record ignored", "line", line)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// loadPendingJournal reads the journal left by an earlier run of the app. It returns nil if there is no
+// armed recording to resume.
+func loadPendingJournal(workDir string) []JournalRecord {
+	path := filepath.Join(workDir, journalFile)
+	records, err := readJournal(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		schedulerLog.Error("journal not read", "err", err)
+		return nil
+	}
+	if len(records) == 0 || records[0].Type != journalArm || records[len(records)-1].Type == journalClose {
+		schedulerLog.Info("finished journal removed", "path", path)
+		_ = os.Remove(path)
+		return nil
+	}
+	schedulerLog.Info("journal of an armed recording found", "records", len(records))
+	return records
+}
+
+// A JournalReplay is what a journal says about the armed recording
+type JournalReplay struct {
+	arm   JournalRecord
+	steps map[string]bool
+	data  OnePPSdata
+	edges []FlashEdge
+}
+
+// replayJournal rebuilds the schedule, the 1pps history and the flash edges of an armed recording
+func replayJournal(records []JournalRecord) (JournalReplay, error) {
+	replay := JournalReplay{steps: map[string]bool{}}
+	if len(records) == 0 || records[0].Type != journalArm {
+		return replay, errors.New("replayJournal(): the journal does not start with an arm record")
+	}
+	replay.arm = records[0]
+
+	data := &replay.data
+	for _, record := range records[1:] {
+		switch record.Type {
+		case journalStep:
+			replay.steps[record.Step] = true
+		case journalTick:
+			epoch := currentOffsetEpoch(data)
+			if epoch < 0 || data.offsetEpochs[epoch].reported != record.Offset ||
+				data.offsetEpochs[epoch].appliedOffset != record.Applied {
+				source := offsetSourceAlmanac
+				if strings.Contains(record.Offset, "D") {
+					source = offsetSourceDefault
+				}
+				data.offsetEpochs = append(data.offsetEpochs, OffsetEpoch{firstUnixTime: record.UnixTime,
+					reported: record.Offset, source: source, appliedOffset: record.Applied})
+				epoch++
+			}
+			if len(data.tickStamp) == 0 {
+				data.startTime = record.UTC
+				data.startEpoch = epoch
+			}
+			data.tickStamp = append(data.tickStamp, TickStamp{utcTimestamp: record.UTC, gpsTimestamp: record.GPS,
+				runningTickTime: record.Tick, offsetEpoch: epoch})
+			data.runningTickTime = record.Tick
+		case journalGap:
+			data.gaps = append(data.gaps, PPSGap{unixTime: record.UnixTime, lostPulses: record.Lost,
+				utcTimestamp: record.UTC, runningTickTime: record.Tick})
+		case journalEdge:
+			replay.edges = append(replay.edges, FlashEdge{edgeTime: record.Tick, on: record.On})
+		}
+	}
+
+	// Tick stamps journaled before the almanac offset arrived are corrected as they were in memory
+	if epoch := currentOffsetEpoch(data); epoch >= 0 && data.offsetEpochs[epoch].source == offsetSourceAlmanac {
+		rebaseTickStamps(data, data.offsetEpochs[epoch].appliedOffset)
+	}
+	return replay, nil
+}
+
+// continueResumedHistory is called for the first 1pps after a resume. The tick count of the GFT cannot be
+// related to the one from before the restart, so the history is continued at the average tick rate and
+// the pulses missed while the app was not running are recorded as a gap.
+func continueResumedHistory(data *OnePPSdata, gpsInfo GPSdata) {
+	last := data.resumeFrom
+	if last == nil {
+		return
+	}
+	data.resumeFrom = nil
+
+	ticksPerSecond := int64(1_000_000)
+	if n := len(data.tickStamp); n > 1 {
+		first := data.tickStamp[0]
+		if seconds := calcDeltaSeconds(first.utcTimestamp, last.utcTimestamp); seconds > 0 {
+			ticksPerSecond = (last.runningTickTime - first.runningTickTime) / seconds
+		}
+	}
+	missed := calcDeltaSeconds(last.utcTimestamp, gpsInfo.utcTimestamp)
+	data.runningTickTime = last.runningTickTime + missed*ticksPerSecond
+	data.startTime = data.tickStamp[0].utcTimestamp
+	data.startEpoch = data.tickStamp[0].offsetEpoch
+	if missed > 1 {
+		recordPPSGap(data, gpsInfo, missed-1)
+	}
+	data.pendingUnixTimeStep = 0 // any offset change happened while the app was not running
+	timingLog.Info("1pps history continued after restart", "missedSeconds", missed, "ticksPerSecond", ticksPerSecond)
+}
+
+// resumeFromJournal is called at the first valid GPRMC after the app starts with the journal of an armed
+// recording. If the recording is still in progress its schedule is resumed. If it has already ended, its
+// flash edge times are reconstructed from the journal into the current session.
+func resumeFromJournal(records []JournalRecord, unixTime int64) {
+	replay, err := replayJournal(records)
+	if err != nil {
+		schedulerLog.Error("recording not resumed", "err", err)
+		return
+	}
+	arm := replay.arm
+
+	if unixTime >= arm.End {
+		reconstructFromJournal(replay)
+		return
+	}
+
+	myWin.leaderStartTime = arm.LeaderStart
+	myWin.firstFlashTime = arm.FlashOne
+	myWin.secondFlashTime = arm.FlashTwo
+	myWin.endOfRecording = arm.End
+	myWin.flashDuration = arm.FlashDuration
+	myWin.recordingDuration = arm.RecordingDuration
+	myWin.pastLeader = replay.steps["leader"]
+	myWin.pastFlashOne = replay.steps["flashOne"]
+	myWin.pastFlashTwo = replay.steps["flashTwo"]
+	myWin.pastEnd = false
+	myWin.sessionRecorded = true
+
+	// A goalpost flash fired late would be mistaken for one at its scheduled time, so one that was
+	// missed while the app was not running is skipped. A missed leader start is done late.
+	var missed []string
+	if !myWin.pastFlashOne && unixTime > arm.FlashOne {
+		myWin.pastFlashOne = true
+		missed = append(missed, "flash one")
+	}
+	if !myWin.pastFlashTwo && unixTime > arm.FlashTwo {
+		myWin.pastFlashTwo = true
+		missed = append(missed, "flash two")
+	}
+	myWin.captureActive = myWin.pastLeader
+
+	// The journaled history is restored. Offsets reported since the restart are noted again so that
+	// the restored tick stamps are rebased if the almanac has since arrived.
+	liveEpochs := onePPSdata.offsetEpochs
+	restored := replay.data
+	for _, epoch := range liveEpochs {
+		noteGpsUtcOffset(&restored, epoch.reported, epoch.firstUnixTime)
+	}
+	restored.pendingUnixTimeStep = 0
+	if n := len(restored.tickStamp); n > 0 {
+		last := restored.tickStamp[n-1]
+		restored.resumeFrom = &last
+	}
+	onePPSdata = restored
+	flashEdges = replay.edges
+
+	journal, err := openJournal(filepath.Join(getWorkDir(), journalFile), false)
+	if err != nil {
+		schedulerLog.Error("journal not reopened", "err", err)
+	} else {
+		journal.leaderStart = arm.LeaderStart
+		journal.lastTick = restored.runningTickTime
+		if n := len(restored.gaps); n > 0 {
+			journal.lastGap = restored.gaps[n-1].runningTickTime
+		}
+		journal.edges = len(flashEdges)
+		journal.append(JournalRecord{Type: journalResume, UnixTime: unixTime})
+		myWin.journal = journal
+	}
+
+	myWin.utcStartArmed = true
+	myWin.App.Preferences().SetBool("ArmUTCstartTime", true)
+	myWin.armUTCbutton.SetText("UTC start armed and active")
+	myWin.armUTCbutton.Importance = widget.SuccessImportance
+
+	schedulerLog.Info("recording resumed after restart", "pastLeader", myWin.pastLeader,
+		"pastFlashOne", myWin.pastFlashOne, "pastFlashTwo", myWin.pastFlashTwo, "tickStamps", len(restored.tickStamp),
+		"flashEdges", len(flashEdges), "missed", strings.Join(missed, ", "))
+	msg := "\nThe armed recording has been resumed after the app was restarted.\n"
+	if len(missed) > 0 {
+		msg += fmt.Sprintf("\nMissed while the app was not running (and skipped): %s\n", strings.Join(missed, ", "))
+	}
+	if myWin.pastLeader && !connectToSharpCap() {
+		msg += "\nSharpCap could not be reached - check that the capture is still running.\n"
+	}
+	showMsg("Recording resumed", msg, 300, 700)
+}
+
+// reconstructFromJournal writes the flash edge times and their validation of a recording that ended
+// while the app was not running into the current session, and delivers it to the SharpCap capture folder
+// as at the end of a recording
+func reconstructFromJournal(replay JournalReplay) {
+	arm := replay.arm
+	myWin.sessionRecorded = true
+	timedEdges := writeFlashEdgeTimes(myWin.flashEdgeLogfile, &replay.data, replay.edges, calcEdgeTimestamp)
+	validation := validateFlashEdges(timedEdges, arm.FlashDuration, []int64{arm.FlashOne, arm.FlashTwo})
+	err := os.WriteFile(myWin.flashValidationPath, []byte(validation.summary()), 0644)
+	if err != nil {
+		filesLog.Error("flash edge validation not written", "err", err)
+	}
+
+	journal, err := openJournal(filepath.Join(getWorkDir(), journalFile), false)
+	if err == nil {
+		journal.close("reconstructed")
+	}
+	myWin.App.Preferences().SetBool("ArmUTCstartTime", false)
+
+	sessionDir := myWin.sessionDir
+	schedulerLog.Info("flash edge times reconstructed from the journal", "flashEdges", len(replay.edges),
+		"timed", len(timedEdges), "passed", validation.passed, "session", sessionDir)
+	msg := fmt.Sprintf("\nThe armed recording ended while the app was not running.\n\n"+
+		"Its flash edge times have been reconstructed from the journal into:\n\n%s\n\n", sessionDir)
+
+	// The capture folder is the one SharpCap last recorded into
+	var captureDir string
+	if connectToSharpCap() {
+		captureDir, _ = filepath.Split(getResponse(myWin.SharpCapConn, "lastfilepath"))
+	}
+	if captureDir == "" {
+		sharpCapLog.Warn("capture folder unknown - the reconstructed session is not delivered", "session", sessionDir)
+		msg += "SharpCap could not tell the capture folder, so the files have been left there.\n\n"
+	} else {
+		sharpCapLog.Info("capture folder", "path", captureDir)
+		msg += fmt.Sprintf("and delivered to the capture folder:\n\n%s\n\n", captureDir)
+		closeAndDeliverSession(captureDir, arm.LeaderStart, arm.End, func(sessionDir string,
+			results []TransferResult, allDelivered bool) {
+			if !allDelivered {
+				showTransferProblem(sessionDir, captureDir, results)
+			}
+		})
+	}
+	showMsg("Recording reconstructed", msg+validation.summary(), 450, 800)
+}
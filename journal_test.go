@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_journalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), journalFile)
+	journal, err := openJournal(path, true)
+	assert.Nil(t, err)
+
+	data := OnePPSdata{
+		tickStamp:    makeTickStamps(20),
+		offsetEpochs: []OffsetEpoch{{reported: "18", source: offsetSourceAlmanac, appliedOffset: 18}},
+		gaps:         []PPSGap{{unixTime: 1709251212, lostPulses: 1, runningTickTime: 12_000_000}},
+	}
+	edges := []FlashEdge{{edgeTime: 5_250_000, on: true}, {edgeTime: 7_250_000, on: false}}
+
+	journal.leaderStart = 1709251205
+	journal.append(JournalRecord{Type: journalArm, LeaderStart: 1709251205, FlashOne: 1709251206,
+		FlashTwo: 1709251208, End: 1709251215, FlashDuration: 2})
+	journal.step("leader", 1709251205)
+	journal.recordTimingEvents(&data, edges, 1709251220)
+	journal.recordTimingEvents(&data, edges, 1709251220) // nothing new to journal
+	assert.Nil(t, journal.file.Close())
+
+	// The app was stopped while writing a record
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	_, _ = file.WriteString(`{"type":"tick","utc":"2024-03-0`)
+	_ = file.Close()
+
+	records, err := readJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2+20+1+2, len(records))
+
+	replay, err := replayJournal(records)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1709251215), replay.arm.End)
+	assert.True(t, replay.steps["leader"])
+	assert.False(t, replay.steps["flashOne"])
+	assert.Equal(t, 20, len(replay.data.tickStamp))
+	assert.Equal(t, 1, len(replay.data.gaps))
+	assert.Equal(t, edges, replay.edges)
+
+	// The reconstructed flash edge times are those that the original history gives
+	var original, reconstructed bytes.Buffer
+	originalEdges := writeFlashEdgeTimes(&original, &data, edges, calcEdgeTimestamp)
+	reconstructedEdges := writeFlashEdgeTimes(&reconstructed, &replay.data, replay.edges, calcEdgeTimestamp)
+	assert.Equal(t, 2, len(reconstructedEdges))
+	assert.Equal(t, originalEdges, reconstructedEdges)
+	assert.Contains(t, reconstructed.String(), "1 on  2024-03-01T00:00:06.250000Z|18\n")
+}
+
+func Test_journalTicksAfterTrim(t *testing.T) {
+	path := filepath.Join(t.TempDir(), journalFile)
+	journal, err := openJournal(path, true)
+	assert.Nil(t, err)
+
+	stamps := makeTickStamps(30)
+	data := OnePPSdata{tickStamp: stamps[:10]}
+	journal.recordTimingEvents(&data, nil, 1709251210)
+	data.tickStamp = stamps[:15]
+	journal.recordTimingEvents(&data, nil, 1709251215)
+	assert.Equal(t, 15, journal.tickIndex)
+
+	// Trimming the history moves the tick stamps not yet journaled to lower indexes
+	data.tickStamp = append([]TickStamp(nil), stamps[10:20]...)
+	journal.recordTimingEvents(&data, nil, 1709251220)
+	assert.Nil(t, journal.file.Close())
+
+	records, err := readJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, len(records))
+	for i, record := range records {
+		assert.Equal(t, stamps[i].runningTickTime, record.Tick)
+	}
+}
+
+func Test_journalReopenAfterPartialRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), journalFile)
+	assert.Nil(t, os.WriteFile(path, []byte(`{"type":"arm","end":1709251215}`+"\n"+`{"type":"ti`), 0644))
+
+	journal, err := openJournal(path, false)
+	assert.Nil(t, err)
+	journal.append(JournalRecord{Type: journalResume})
+	assert.Nil(t, journal.file.Close())
+
+	records, err := readJournal(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, journalResume, records[1].Type)
+}
+
+func Test_continueResumedHistory(t *testing.T) {
+	data := OnePPSdata{tickStamp: makeTickStamps(10)}
+	last := data.tickStamp[9]
+	data.resumeFrom = &last
+
+	gpsInfo := GPSdata{unixTime: 1709251230, utcTimestamp: "2024-03-01T00:00:30.000000"}
+	continueResumedHistory(&data, gpsInfo)
+	assert.Nil(t, data.resumeFrom)
+	assert.Equal(t, int64(30_000_000), data.runningTickTime)
+	assert.Equal(t, 1, len(data.gaps))
+	assert.Equal(t, int64(20), data.gaps[0].lostPulses)
+}
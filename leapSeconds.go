@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Additional (or newly announced) leap seconds can be added to this file in the working directory,
+// one per line as:  YYYY-MM-DD offset    (the UTC date from which the new GpsUtcOffset applies)
+const leapSecondFile = "leapSeconds.txt"
+
+type LeapSecondEntry struct {
+	effective    time.Time // UTC date from which gpsUtcOffset applies
+	gpsUtcOffset int       // GPS time minus UTC time (seconds)
+}
+
+// GPS-UTC offsets since the start of GPS time (1980-01-06), from the IERS bulletins
+var builtInLeapSeconds = []LeapSecondEntry{
+	{time.Date(1980, 1, 6, 0, 0, 0, 0, time.UTC), 0},
+	{time.Date(1981, 7, 1, 0, 0, 0, 0, time.UTC), 1},
+	{time.Date(1982, 7, 1, 0, 0, 0, 0, time.UTC), 2},
+	{time.Date(1983, 7, 1, 0, 0, 0, 0, time.UTC), 3},
+	{time.Date(1985, 7, 1, 0, 0, 0, 0, time.UTC), 4},
+	{time.Date(1988, 1, 1, 0, 0, 0, 0, time.UTC), 5},
+	{time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC), 6},
+	{time.Date(1991, 1, 1, 0, 0, 0, 0, time.UTC), 7},
+	{time.Date(1992, 7, 1, 0, 0, 0, 0, time.UTC), 8},
+	{time.Date(1993, 7, 1, 0, 0, 0, 0, time.UTC), 9},
+	{time.Date(1994, 7, 1, 0, 0, 0, 0, time.UTC), 10},
+	{time.Date(1996, 1, 1, 0, 0, 0, 0, time.UTC), 11},
+	{time.Date(1997, 7, 1, 0, 0, 0, 0, time.UTC), 12},
+	{time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC), 13},
+	{time.Date(2006, 1, 1, 0, 0, 0, 0, time.UTC), 14},
+	{time.Date(2009, 1, 1, 0, 0, 0, 0, time.UTC), 15},
+	{time.Date(2012, 7, 1, 0, 0, 0, 0, time.UTC), 16},
+	{time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC), 17},
+	{time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), 18},
+}
+
+var leapSecondTable = builtInLeapSeconds
+
+// loadLeapSecondTable returns the built-in table merged with the entries in the file at path.
+// A missing file is not an error.
+func loadLeapSecondTable(path string) ([]LeapSecondEntry, error) {
+	table := make([]LeapSecondEntry, len(builtInLeapSeconds))
+	copy(table, builtInLeapSeconds)
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return table, nil
+	}
+	if err != nil {
+		return table, fmt.Errorf("loadLeapSecondTable(): %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return table, fmt.Errorf("loadLeapSecondTable(): %s line %d: expected 'YYYY-MM-DD offset'", path, lineNumber)
+		}
+		effective, err := time.Parse(time.DateOnly, fields[0])
+		if err != nil {
+			return table, fmt.Errorf("loadLeapSecondTable(): %s line %d: %w", path, lineNumber, err)
+		}
+		offset, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return table, fmt.Errorf("loadLeapSecondTable(): %s line %d: %w", path, lineNumber, err)
+		}
+		table = addLeapSecondEntry(table, LeapSecondEntry{effective: effective, gpsUtcOffset: offset})
+	}
+	return table, scanner.Err()
+}
+
+func addLeapSecondEntry(table []LeapSecondEntry, entry LeapSecondEntry) []LeapSecondEntry {
+	for i := range table {
+		if table[i].effective.Equal(entry.effective) {
+			table[i] = entry
+			return table
+		}
+	}
+	table = append(table, entry)
+	sort.Slice(table, func(i, j int) bool { return table[i].effective.Before(table[j].effective) })
+	return table
+}
+
+// leapSecondOffsetAt returns the GpsUtcOffset that applies at UTC time t
+func leapSecondOffsetAt(table []LeapSecondEntry, t time.Time) int {
+	offset := 0
+	for _, entry := range table {
+		if entry.effective.After(t) {
+			break
+		}
+		offset = entry.gpsUtcOffset
+	}
+	return offset
+}
+
+// pendingLeapSecond returns the first table entry that takes effect after UTC time t (a pre-announced leap second)
+func pendingLeapSecond(table []LeapSecondEntry, t time.Time) (LeapSecondEntry, bool) {
+	for _, entry := range table {
+		if entry.effective.After(t) {
+			return entry, true
+		}
+	}
+	return LeapSecondEntry{}, false
+}
+
+func initLeapSecondTable(workDir string) {
+	table, err := loadLeapSecondTable(filepath.Join(workDir, leapSecondFile))
+	if err != nil {
+		timingLog.Warn("leap second file not loaded", "err", err)
+	}
+	leapSecondTable = table
+	last := leapSecondTable[len(leapSecondTable)-1]
+	timingLog.Info("leap second table loaded", "latestGpsUtcOffset", last.gpsUtcOffset,
+		"effective", last.effective.Format(time.DateOnly))
+}
+
+// currentUtcTime is GPS derived UTC when it is available, else the computer clock
+func currentUtcTime() time.Time {
+	if gpsData.unixTime != 0 {
+		return time.Unix(gpsData.unixTime, 0).UTC()
+	}
+	return time.Now().UTC()
+}
+
+// checkLeapSeconds cross-checks the receiver's GpsUtcOffset against the leap second table and looks for
+// a pre-announced leap second before endTime (the end of the recording). It returns a warning for the
+// user, or an empty string if all is well.
+func checkLeapSeconds(reported string, now, endTime time.Time) string {
+	var warnings []string
+
+	tableOffset := leapSecondOffsetAt(leapSecondTable, now)
+	if reported != "" && !strings.Contains(reported, "D") {
+		receiverOffset, err := strconv.Atoi(reported)
+		if err == nil && receiverOffset != tableOffset {
+			warnings = append(warnings, fmt.Sprintf(
+				"The GPS receiver reports a GpsUtcOffset of %d but the leap second table gives %d for %s.\n"+
+					"If the receiver is right, add a line to %s giving the date of the new leap second.",
+				receiverOffset, tableOffset, now.Format(time.DateOnly), leapSecondFile))
+		}
+	}
+
+	if pending, ok := pendingLeapSecond(leapSecondTable, now); ok && !pending.effective.After(endTime) {
+		warnings = append(warnings, fmt.Sprintf(
+			"A leap second (GpsUtcOffset %d) takes effect at %s, before the end of this recording.\n"+
+				"UTC times after that instant will differ by %d second(s).",
+			pending.gpsUtcOffset, pending.effective.Format(time.DateTime), pending.gpsUtcOffset-tableOffset))
+	}
+
+	return strings.Join(warnings, "\n\n")
+}
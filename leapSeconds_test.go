@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_leapSecondOffsetAt(t *testing.T) {
+	assert.Equal(t, 16, leapSecondOffsetAt(builtInLeapSeconds, time.Date(2015, 6, 30, 23, 59, 59, 0, time.UTC)))
+	assert.Equal(t, 17, leapSecondOffsetAt(builtInLeapSeconds, time.Date(2015, 7, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 18, leapSecondOffsetAt(builtInLeapSeconds, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)))
+}
+
+func Test_loadLeapSecondTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), leapSecondFile)
+	err := os.WriteFile(path, []byte("# announced in Bulletin C\n2030-01-01 19\n"), 0644)
+	assert.Nil(t, err)
+
+	table, err := loadLeapSecondTable(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 18, leapSecondOffsetAt(table, time.Date(2029, 12, 31, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 19, leapSecondOffsetAt(table, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	pending, ok := pendingLeapSecond(table, time.Date(2029, 12, 31, 0, 0, 0, 0, time.UTC))
+	assert.True(t, ok)
+	assert.Equal(t, 19, pending.gpsUtcOffset)
+
+	table, err = loadLeapSecondTable(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Nil(t, err)
+	assert.Equal(t, len(builtInLeapSeconds), len(table))
+}
+
+func Test_checkLeapSeconds(t *testing.T) {
+	savedTable := leapSecondTable
+	defer func() { leapSecondTable = savedTable }()
+	leapSecondTable = append(append([]LeapSecondEntry(nil), builtInLeapSeconds...),
+		LeapSecondEntry{effective: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), gpsUtcOffset: 19})
+
+	may1 := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+	newYearsEve := time.Date(2029, 12, 31, 23, 30, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name     string
+		reported string
+		now, end time.Time
+		want     string // in the warning, empty for no warning
+	}{
+		{"offset agrees", "18", may1, may1.Add(time.Hour), ""},
+		{"default offset", "16D", may1, may1.Add(time.Hour), ""},
+		{"offset differs", "19", may1, may1.Add(time.Hour), "reports a GpsUtcOffset of 19"},
+		{"leap second during the recording", "18", newYearsEve, newYearsEve.Add(time.Hour),
+			"A leap second (GpsUtcOffset 19) takes effect at 2030-01-01 00:00:00"},
+		{"leap second as the recording ends", "18", newYearsEve, newYearsEve.Add(30 * time.Minute),
+			"before the end of this recording"},
+		{"leap second after the recording", "18", newYearsEve.Add(-time.Hour), newYearsEve, ""},
+	} {
+		warning := checkLeapSeconds(test.reported, test.now, test.end)
+		if test.want == "" {
+			assert.Equal(t, "", warning, test.name)
+		} else {
+			assert.Contains(t, warning, test.want, test.name)
+		}
+	}
+}
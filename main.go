@@ -9,10 +9,12 @@ import (
 	"fyne.io/fyne/v2/widget"
 	"go.bug.st/serial"
 	"gonum.org/v1/plot/font"
-	"log"
+	"image/color"
+	"io"
 	"math"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,21 +24,23 @@ import (
 	"gonum.org/v1/plot/plotter"
 	"gonum.org/v1/plot/plotutil"
 	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
 )
 
 const MaxSerialDataLines = 100_000
 
 const Version = "1.3.4"
 
-const gpsUtcOffset = "18"
-
 const operationLog = "IotaGFToperationLog.txt"
 
 type TickStamp struct {
-	utcTimestamp    string // UTC time when P sentence occurred
-	gpsTimestamp    string // GPS time when P event occurred
-	runningTickTime int64  // runningTickTime at P event
-	tickTime        int64  // tickTime reported at P event
+	utcTimestamp    string    // UTC time when P sentence occurred
+	gpsTimestamp    string    // GPS time when P event occurred
+	runningTickTime int64     // runningTickTime at P event
+	tickTime        int64     // tickTime reported at P event
+	offsetEpoch     int       // index into onePPSdata.offsetEpochs of the GpsUtcOffset used for utcTimestamp
+	hostTime        time.Time // host clock time at which the P sentence was received (zero if not known)
+	qErr            int32     // quantization error of the 1pps (ps) from a UBX TIM-TP, 0 if not known
 }
 
 type FlashEdge struct {
@@ -44,11 +48,24 @@ type FlashEdge struct {
 	on       bool
 }
 
+// A PPSGap records 1pps pulses that were never received
+type PPSGap struct {
+	unixTime        int64  // gpsData.unixTime of the first 1pps received after the gap
+	lostPulses      int64  // number of 1pps pulses that were lost
+	utcTimestamp    string // UTC time of the first 1pps received after the gap
+	runningTickTime int64  // runningTickTime of the first 1pps received after the gap
+}
+
 type OnePPSdata struct {
-	startTime       string      // UTC time of first valid 1pps reading
-	runningTickTime int64       // sum of all P event tickTime
-	tickStamp       []TickStamp // contains info for all P events
-	pDelta          []int64     // delta tickTime for all P events
+	startTime           string        // UTC time of first valid 1pps reading
+	startEpoch          int           // offset epoch in effect when startTime was recorded
+	runningTickTime     int64         // sum of all P event tickTime
+	tickStamp           []TickStamp   // contains info for all P events
+	pDelta              []int64       // delta tickTime for all P events
+	gaps                []PPSGap      // lost 1pps pulses
+	offsetEpochs        []OffsetEpoch // every GpsUtcOffset reported during this session
+	pendingUnixTimeStep int64         // expected step in gpsData.unixTime due to a GpsUtcOffset change
+	resumeFrom          *TickStamp    // last tick stamp restored from the journal, until the first 1pps after a resume
 }
 
 type GPSdata struct {
@@ -71,7 +88,24 @@ type GPSdata struct {
 	gpsTimestamp  string
 	utcTimestamp  string
 	unixTime      int64
-	nextUnixTime  int64 // We use this to detect missing 1pps pulses
+	nextUnixTime  int64     // We use this to detect missing 1pps pulses
+	hostTime      time.Time // host clock time at which the sentence being parsed was received
+
+	fixType          int              // from GSA sentences: fixNone, fix2D or fix3D (0 until one is received)
+	rmcValid         bool             // the last GPRMC had status A
+	satellitesUsed   int              // from GGA sentences
+	satellitesInView map[GSVGroup]int // from GSV sentences, by talker (constellation) and signal
+	hdop             float64
+	pdop             float64
+	sky              SkyView
+	usableSince      time.Time // host time from which enough satellites have had a usable signal
+	fixSince         time.Time // host time from which the receiver has had a 3D fix
+	qErr             int32     // from UBX TIM-TP: quantization error of the next 1pps (ps)
+	qErrPending      bool      // qErr is valid and its 1pps has not been received yet
+	utcValidKnown    bool      // the receiver sends UBX NAV-TIMEUTC
+	utcValid         bool      // from NAV-TIMEUTC: the receiver knows the leap seconds
+	timeAccuracy     uint32    // from UBX NAV-CLOCK: time accuracy estimate (ns)
+	gftStarts        int       // [STARTING!] sentences received since the port was opened
 }
 
 type Config struct {
@@ -88,6 +122,11 @@ type Config struct {
 	longitudeStatus           *canvas.Text
 	altitudeStatus            *canvas.Text
 	dateTimeStatus            *canvas.Text
+	satellitesStatus          *canvas.Text
+	skyPanel                  *SkyPanel
+	alertsButton              *widget.Button
+	alertsPanel               *AlertsPanel
+	devicePanel               *DevicePanel
 	comPortInUse              *widget.Label
 	gpsUtcOffsetInUse         *canvas.Text
 	portsAvailable            []string
@@ -107,6 +146,10 @@ type Config struct {
 	pubxCheckBox              *widget.Check
 	pCheckBox                 *widget.Check
 	modeCheckBox              *widget.Check
+	gpzdaCheckBox             *widget.Check
+	gpgsaCheckBox             *widget.Check
+	gpgsvCheckBox             *widget.Check
+	ubxCheckBox               *widget.Check
 	ledOnCheckbox             *widget.Check
 	autoRunFitsReaderCheckBox *widget.Check
 	shutdownCheckBox          *widget.Check
@@ -118,12 +161,22 @@ type Config struct {
 	firstFlashTime            int64
 	secondFlashTime           int64
 	endOfRecording            int64
+	flashDuration             int64
 	recordingLength           *widget.Entry
+	ppsRetentionSelect        *widget.Select
 	recordingDuration         float64
 	logFilePath               string
-	logFile                   *os.File
+	logFile                   *SentenceLog
+	archive                   *SentenceArchive // nil unless the binary sentence archive is enabled
+	journal                   *Journal         // open while a recording is armed
+	pendingJournal            []JournalRecord  // journal of an armed recording left by an earlier run of the app
+	hostEvents                []HostEvent      // scheduled actions of the session, for the host latency report
+	sitePosition              PositionAverage  // GPS fixes of the session, for the site record
+	sessionDir                string
+	sessionRecorded           bool // a recording has started in the current session
 	flashEdgeLogfilePath      string
 	flashEdgeLogfile          *os.File
+	flashValidationPath       string
 	keepLogFile               bool
 	gotFirst1PPS              bool
 	utcStartArmed             bool
@@ -192,10 +245,20 @@ func msgTrim(msg string) string {
 	return strings.TrimSpace(msg)
 }
 
+// sendServerCommand sends a GFT command for a control server client and returns the reply to the client
+func sendServerCommand(cmd string, waitForGFT bool) string {
+	if !waitForGFT {
+		sendCommandToArduino(cmd, originServer)
+		return "OK"
+	}
+	return sendGFTCommand(cmd, originServer).serverReply()
+}
+
+// sendResponse writes a response to a client. A write that fails is logged by the caller.
 func sendResponse(conn net.Conn, cmd string) error {
 	_, err := conn.Write(makeMsg(cmd))
-	if err != nil {
-		log.Println("Error writing:", err.Error())
+	if err == nil {
+		serverLog.Info("response sent", "response", cmd)
 	}
 	return err
 }
@@ -203,30 +266,31 @@ func sendResponse(conn net.Conn, cmd string) error {
 func getResponse(conn net.Conn, cmd string) string {
 	_, err := conn.Write(makeMsg(cmd))
 	if err != nil {
-		log.Println("Error writing:", err.Error())
+		sharpCapLog.Error("command write failed", "cmd", cmd, "err", err)
 	}
 	buffer := make([]byte, MSGLEN)
 	_, err = conn.Read(buffer) // Get response - blocks until MSGLEN bytes have been received
 	if err != nil {
-		log.Println("Error reading:", err.Error())
+		sharpCapLog.Error("response read failed", "cmd", cmd, "err", err)
 	}
-	return msgTrim(string(buffer[:]))
+	response := msgTrim(string(buffer[:]))
+	sharpCapLog.Info("command", "cmd", cmd, "response", response)
+	return response
 }
 
 func server() {
 	// establish connection
 	server, err := net.Listen(ServerType, ServerHost+":"+IotaGFTPort)
 	if err != nil {
-		log.Println("Error listening:", err.Error())
+		serverLog.Error("listen failed", "err", err)
 		os.Exit(1)
 	}
 	defer server.Close()
-	log.Println("Listening on " + ServerHost + ":" + IotaGFTPort)
-	log.Println("Waiting for client...")
+	serverLog.Info("listening", "address", ServerHost+":"+IotaGFTPort)
 	for {
 		connection, err := server.Accept()
 		if err != nil {
-			log.Println("Error accepting: ", err.Error())
+			serverLog.Error("accept failed", "err", err)
 			os.Exit(1)
 		}
 		//fmt.Println("client connected")
@@ -241,7 +305,7 @@ func processClient(connection net.Conn) {
 	for {
 		mLen, err := connection.Read(buffer)
 		if err != nil {
-			log.Println("Error reading:", err.Error())
+			serverLog.Error("client read failed", "err", err)
 			os.Exit(1)
 		}
 		bytesRead += mLen
@@ -252,13 +316,16 @@ func processClient(connection net.Conn) {
 	}
 
 	cmd := strings.TrimSpace(string(buffer[:bytesRead]))
-	log.Println("Received: ", cmd)
+	serverLog.Info("command received", "cmd", cmd)
+
+	// A client that gives a GFT command as "v2 <command>" is answered once the GFT has answered, with
+	// OK and the GFT's response or with what became of the command. Otherwise the reply is OK at once.
+	cmd, waitForGFT := strings.CutPrefix(cmd, "v2 ")
 
 	if cmd == "flash now" {
-		sendCommandToArduino(cmd)
-		err := sendResponse(connection, "OK")
+		err := sendResponse(connection, sendServerCommand(cmd, waitForGFT))
 		if err != nil {
-			log.Println(err)
+			serverLog.Error("response not sent", "cmd", cmd, "err", err)
 		}
 		connection.Close()
 		return
@@ -269,25 +336,25 @@ func processClient(connection net.Conn) {
 		if !found { // If no parameter given for LED intensity
 			err := sendResponse(connection, "Invalid intensity value")
 			if err != nil {
-				log.Println(err)
+				serverLog.Error("response not sent", "cmd", cmd, "err", err)
 			}
 		} else {
 			intensity, err := strconv.ParseFloat(intensityStr, 64)
 			if err != nil {
 				err := sendResponse(connection, "Invalid intensity value")
 				if err != nil {
-					log.Println(err)
+					serverLog.Error("response not sent", "cmd", cmd, "err", err)
 				}
 			} else if intensity < 0.0 || intensity > 3*255 {
 				err := sendResponse(connection, "Invalid intensity value")
 				if err != nil {
-					log.Println(err)
+					serverLog.Error("response not sent", "cmd", cmd, "err", err)
 				}
 			} else {
 				processFlashIntensitySliderChange(intensity)
 				err := sendResponse(connection, "OK")
 				if err != nil {
-					log.Println(err)
+					serverLog.Error("response not sent", "cmd", cmd, "err", err)
 				}
 			}
 		}
@@ -300,20 +367,19 @@ func processClient(connection net.Conn) {
 		if len(parts) != 3 {
 			err := sendResponse(connection, "Invalid flash duration")
 			if err != nil {
-				log.Println(err)
+				serverLog.Error("response not sent", "cmd", cmd, "err", err)
 			}
 		} else {
 			duration, err := strconv.Atoi(parts[2])
 			if err != nil || duration < 1 {
 				err := sendResponse(connection, "Invalid flash duration")
 				if err != nil {
-					log.Println(err)
+					serverLog.Error("response not sent", "cmd", cmd, "err", err)
 				}
 			} else {
-				sendCommandToArduino(cmd)
-				err = sendResponse(connection, "OK")
+				err = sendResponse(connection, sendServerCommand(cmd, waitForGFT))
 				if err != nil {
-					log.Println(err)
+					serverLog.Error("response not sent", "cmd", cmd, "err", err)
 				}
 			}
 		}
@@ -327,7 +393,7 @@ func processClient(connection net.Conn) {
 		if !found { // If event time is empty
 			err := sendResponse(connection, "OK")
 			if err != nil {
-				log.Println(err)
+				serverLog.Error("response not sent", "cmd", cmd, "err", err)
 			}
 			myWin.utcEventTime.SetText("")
 		} else {
@@ -336,12 +402,12 @@ func processClient(connection net.Conn) {
 			if ok {
 				err := sendResponse(connection, "OK")
 				if err != nil {
-					log.Println(err)
+					serverLog.Error("response not sent", "cmd", cmd, "err", err)
 				}
 			} else {
 				err := sendResponse(connection, "Invalid UTC time format")
 				if err != nil {
-					log.Println(err)
+					serverLog.Error("response not sent", "cmd", cmd, "err", err)
 				}
 			}
 		}
@@ -354,12 +420,12 @@ func processClient(connection net.Conn) {
 		if isValidRecordingTime() {
 			err := sendResponse(connection, "OK")
 			if err != nil {
-				log.Println(err)
+				serverLog.Error("response not sent", "cmd", cmd, "err", err)
 			}
 		} else {
 			err := sendResponse(connection, "Invalid recording time")
 			if err != nil {
-				log.Println(err)
+				serverLog.Error("response not sent", "cmd", cmd, "err", err)
 			}
 		}
 		return
@@ -370,7 +436,7 @@ func processClient(connection net.Conn) {
 		myWin.shutdownCheckBox.SetChecked(true)
 		err := sendResponse(connection, "OK")
 		if err != nil {
-			log.Println(err)
+			serverLog.Error("response not sent", "cmd", cmd, "err", err)
 		}
 		connection.Close()
 		return
@@ -381,7 +447,7 @@ func processClient(connection net.Conn) {
 		myWin.shutdownCheckBox.SetChecked(false)
 		err := sendResponse(connection, "OK")
 		if err != nil {
-			log.Println(err)
+			serverLog.Error("response not sent", "cmd", cmd, "err", err)
 		}
 		connection.Close()
 		return
@@ -391,7 +457,7 @@ func processClient(connection net.Conn) {
 		autoRunFitsReader(true)
 		err := sendResponse(connection, "OK")
 		if err != nil {
-			log.Println(err)
+			serverLog.Error("response not sent", "cmd", cmd, "err", err)
 		}
 		connection.Close()
 		return
@@ -401,7 +467,7 @@ func processClient(connection net.Conn) {
 		autoRunFitsReader(false)
 		err := sendResponse(connection, "OK")
 		if err != nil {
-			log.Println(err)
+			serverLog.Error("response not sent", "cmd", cmd, "err", err)
 		}
 		connection.Close()
 		return
@@ -411,7 +477,7 @@ func processClient(connection net.Conn) {
 		showIntensitySlider(true)
 		err := sendResponse(connection, "OK")
 		if err != nil {
-			log.Println(err)
+			serverLog.Error("response not sent", "cmd", cmd, "err", err)
 		}
 		connection.Close()
 		return
@@ -421,7 +487,7 @@ func processClient(connection net.Conn) {
 		showIntensitySlider(false)
 		err := sendResponse(connection, "OK")
 		if err != nil {
-			log.Println(err)
+			serverLog.Error("response not sent", "cmd", cmd, "err", err)
 		}
 		connection.Close()
 		return
@@ -431,7 +497,7 @@ func processClient(connection net.Conn) {
 		ans := armUTCstart()
 		err := sendResponse(connection, ans)
 		if err != nil {
-			log.Println(err)
+			serverLog.Error("response not sent", "cmd", cmd, "err", err)
 		}
 		connection.Close()
 		return
@@ -439,7 +505,7 @@ func processClient(connection net.Conn) {
 
 	err := sendResponse(connection, "Unimplemented command")
 	if err != nil {
-		log.Println(err)
+		serverLog.Error("response not sent", "cmd", cmd, "err", err)
 	}
 	connection.Close()
 	return
@@ -447,26 +513,29 @@ func processClient(connection net.Conn) {
 
 func main() {
 
-	logFile, err := os.OpenFile(operationLog, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
-		log.Fatal(err)
+	// The offline tools are run by giving their name as the first command line argument
+	if len(os.Args) > 1 && runSubcommand(os.Args[1:]) {
+		return
 	}
 
-	log.SetOutput(logFile)
-	//log.SetOutput(os.Stdout)  // Uncomment this to send all logs to console instead of a file
-	log.SetFlags(log.LstdFlags) // Add date and time as prefix
-	log.Printf("IotaGFTapp %s started...", Version)
+	// -json and -debug select the format and level of the operation log
+	args, asJSON, debug := operationLogOptions(os.Args[1:])
+	logFile, err := initOperationLog(operationLog, asJSON, debug)
+	if err != nil {
+		fatal("operation log not opened", err)
+	}
+	defer logFile.Close()
+	appLog.Info("IotaGFTapp started", "version", Version, "json", asJSON, "debug", debug)
 
 	// A non-standard baudrate (which is normally 250000) can be specified on the command line
-	//fmt.Println(len(os.Args), os.Args)
-	if len(os.Args) > 1 {
-		cmdLineBaudrate, err := strconv.Atoi(os.Args[1])
+	if len(args) > 0 {
+		cmdLineBaudrate, err := strconv.Atoi(args[0])
 		if (err != nil) || (baudrate < 0) {
-			log.Println("Baudrate given on command line was not a positive integer")
+			appLog.Error("baudrate given on command line was not a positive integer", "arg", args[0])
 			os.Exit(911)
 		} else {
 			if baudrate != 250000 {
-				log.Printf("Cmdline changed baudrate from standard 250000 to: %d", cmdLineBaudrate)
+				serialLog.Info("command line changed baudrate from standard 250000", "baudrate", cmdLineBaudrate)
 				baudrate = cmdLineBaudrate
 			}
 		}
@@ -475,6 +544,8 @@ func main() {
 	// Form a unique name for the log file from the working directory.
 	workDir := getWorkDir()
 
+	initLeapSecondTable(workDir)
+
 	initializeStartingWindow(&myWin)
 
 	// Build the GUI
@@ -486,18 +557,22 @@ func main() {
 	myWin.pastFlashTwo = false
 	myWin.pastEnd = false
 
+	// Sessions in which nothing was recorded are kept for a while, for diagnosing problems, then removed
+	removeIdleSessions(workDir, time.Now(), idleSessionMaxAge)
 	createLogAndFlashEdgeFiles(workDir)
 
+	// An armed recording that was interrupted by a restart is resumed at the first valid GPRMC
+	myWin.pendingJournal = loadPendingJournal(workDir)
+
 	//defer deleteLogfile()
 
 	newLine := fmt.Sprintf("... the serial port will be opened at 8,N,1 and %d baudrate.", baudrate)
 	addToTextOutDisplay(newLine)
-	log.Println(newLine)
+	serialLog.Info("serial settings", "baudrate", baudrate)
 
 	if baudrate != 250000 {
 		newLine = fmt.Sprintf("... a non-standard baudrate of %d has been specified in the command line.", baudrate)
 		addToTextOutDisplay(newLine)
-		log.Println(newLine)
 	}
 
 	//newLine = fmt.Sprintf("Log file @ %s", logfilePath)
@@ -516,6 +591,10 @@ func main() {
 
 	go server()
 
+	if myWin.App.Preferences().BoolWithFallback("TimeServer", false) {
+		processTimeServerCheck(true)
+	}
+
 	// show and run the GUI
 	myWin.MainWindow.ShowAndRun()
 
@@ -524,7 +603,7 @@ func main() {
 	if myWin.serialPort != nil {
 		err := myWin.serialPort.Close()
 		if err != nil {
-			fmt.Println("While closing serial port got:", err)
+			serialLog.Error("serial port not closed", "port", myWin.comPortName, "err", err)
 		}
 	}
 	myWin.spMutex.Unlock()
@@ -533,14 +612,14 @@ func main() {
 		myWin.SharpCapConn.Close()
 	}
 
-	_ = myWin.logFile.Close()
-	_ = myWin.flashEdgeLogfile.Close()
+	finishSession()
+	appLog.Info("IotaGFTapp closed")
 }
 
 func getWorkDir() string {
 	workDir, err := os.Getwd()
 	if err != nil {
-		fmt.Println("os.Getwd() failed to return working directory")
+		appLog.Error("os.Getwd() failed to return working directory", "err", err)
 		os.Exit(911)
 	}
 	return workDir
@@ -555,7 +634,7 @@ func connectToSharpCap() bool {
 	if err != nil {
 		showMsg("SharpCap unavailable", sharpCapErr, 600, 550)
 		myWin.SharpCapAvailable = false
-		fmt.Println("SharpCap not running")
+		sharpCapLog.Warn("SharpCap not running", "err", err)
 		return false
 	} else {
 		myWin.SharpCapAvailable = true
@@ -564,26 +643,45 @@ func connectToSharpCap() bool {
 }
 
 func createLogAndFlashEdgeFiles(workDir string) bool {
+	// Files of the previous session are never overwritten - each session gets a new directory
+	finishSession()
+
+	sessionDir, err := newSessionDir(workDir, time.Now())
+	if err != nil {
+		filesLog.Error("session directory not created", "err", err)
+		return false
+	}
+	myWin.sessionDir, myWin.sessionRecorded = sessionDir, false
+	filesLog.Info("session started", "dir", sessionDir)
+
 	// Form the full path to the standard logfile
-	logfilePath = fmt.Sprintf("%s\\GPS_LOG_GFT.txt", workDir)
-	flashEdgeLogfilePath = fmt.Sprintf("%s\\FLASH_EDGE_TIMES.txt", workDir)
+	logfilePath = filepath.Join(sessionDir, sentenceLogFile)
+	flashEdgeLogfilePath = filepath.Join(sessionDir, flashEdgeTimesFile)
 	myWin.logFilePath = logfilePath
 	myWin.flashEdgeLogfilePath = flashEdgeLogfilePath
+	myWin.flashValidationPath = filepath.Join(sessionDir, flashValidationFile)
 
-	// create and open the logFile
-	logFile, err1 := os.Create(logfilePath)
+	// create and open the logFile (this is rotated into gzipped segments when it gets too big or too old)
+	maxSize := int64(myWin.App.Preferences().IntWithFallback("SentenceLogMaxMB", defaultSentenceLogMaxMB)) << 20
+	maxAge := time.Duration(myWin.App.Preferences().IntWithFallback("SentenceLogMaxMinutes", defaultSentenceLogMaxMinutes)) * time.Minute
+	logFile, err1 := newSentenceLog(sessionDir, maxSize, maxAge)
 	if err1 != nil {
-		log.Println("in createLogAndFlashEdgeFiles:", err1)
+		filesLog.Error("sentence log not created", "err", err1)
 		return false
 	}
+	logFile.hostTimes = myWin.App.Preferences().BoolWithFallback("HostTimeColumn", false)
 	myWin.logFile = logFile
 
 	_, _ = myWin.logFile.WriteString(fmt.Sprintf("First line of the IotaGFTapp %s GPS sentence log file\n", Version))
 
+	if myWin.App.Preferences().BoolWithFallback("BinaryArchive", false) {
+		startSentenceArchive(sessionDir)
+	}
+
 	// create and open the flash edge logfile
 	flashLogFile, err1 := os.Create(flashEdgeLogfilePath)
 	if err1 != nil {
-		log.Println("in createLogAndFlashEdgeFiles:", err1)
+		filesLog.Error("flash edge file not created", "err", err1)
 		return false
 	}
 	myWin.flashEdgeLogfile = flashLogFile
@@ -613,46 +711,114 @@ func initializeStartingWindow(myWin *Config) {
 	myWin.MainWindow.CenterOnScreen()
 }
 
-func calcFlashEdgeTimes() {
-	_, fileErr := myWin.flashEdgeLogfile.WriteString(fmt.Sprintf("# IotaGFTapp Version %s\n", Version))
-	if fileErr != nil {
-		log.Println(fmt.Errorf("calcFlashEdgeTimes(): %w", fileErr))
-	}
-	for i := range flashEdges {
-		for j := 0; j < len(onePPSdata.tickStamp); j++ {
-			// Find the onePPS time stamp that precedes the flash edge - we go past it, then back up 1 step
-			if onePPSdata.tickStamp[j].runningTickTime > flashEdges[i].edgeTime {
-				leftPoint := j - 1
-				rightPoint := j
-				newTimestamp := interpolateTimestamp(
-					flashEdges[i].edgeTime,
-					onePPSdata.tickStamp[leftPoint].runningTickTime,
-					onePPSdata.tickStamp[rightPoint].runningTickTime,
-					onePPSdata.tickStamp[leftPoint].utcTimestamp,
-					onePPSdata.tickStamp[rightPoint].utcTimestamp)
-
-				edgeStr := ""
-				if flashEdges[i].on {
-					// Count flash edges starting from 1
-					edgeStr = fmt.Sprintf("%d on  %s%s\n", i+1, newTimestamp+"Z|", gpsData.gpsUtcOffset)
-				} else {
-					edgeStr = fmt.Sprintf("%d off %s%s\n", i+1, newTimestamp+"Z|", gpsData.gpsUtcOffset)
-				}
-				_, fileErr := myWin.flashEdgeLogfile.WriteString(edgeStr)
-				//fmt.Println(edgeStr)
-				if fileErr != nil {
-					log.Println(fmt.Errorf("calcFlashEdgeTimes(): %w", fileErr))
-				}
-				break
-			}
+func calcFlashEdgeTimes() []timedFlashEdge {
+	return writeFlashEdgeTimes(myWin.flashEdgeLogfile, &onePPSdata, flashEdges, calcEdgeTimestamp)
+}
+
+// An edgeTimer returns the UTC timestamp of a flash edge, timed from the 1pps history in data, and the
+// index of the tick stamp that precedes it
+type edgeTimer func(data *OnePPSdata, edgeTime int64) (string, int, bool)
+
+// writeFlashEdgeTimes times the flash edges from the 1pps history in data and writes them to w
+// in the FLASH_EDGE_TIMES.txt format. The edge lines are those FitsReader and PyOTE read; what is known
+// about the GpsUtcOffset of each edge is in # comment lines before them.
+func writeFlashEdgeTimes(w io.Writer, data *OnePPSdata, edges []FlashEdge, timer edgeTimer) []timedFlashEdge {
+	lines := []string{fmt.Sprintf("# IotaGFTapp Version %s", Version)}
+	lines = append(lines, offsetEpochLines(data)...)
+	lines = append(lines, gapLines(data.gaps)...)
+
+	var timedEdges []timedFlashEdge
+	var edgeLines []string
+	for i := range edges {
+		newTimestamp, leftPoint, ok := timer(data, edges[i].edgeTime)
+		if !ok {
+			continue
+		}
+
+		// The GpsUtcOffset (and its source) that applied to the 1pps time stamps used
+		epochIndex := data.tickStamp[leftPoint].offsetEpoch
+		offsetStr := edgeGpsUtcOffset(data, epochIndex)
+		lines = append(lines, fmt.Sprintf("# edge %d: GpsUtcOffset %s (%s)", i+1, offsetStr,
+			offsetSourceLabel(data, epochIndex)))
+
+		// An edge whose bracketing 1pps interval contains lost pulses is noted
+		gap := bracketHasGap(data.gaps, data.tickStamp[leftPoint], data.tickStamp[leftPoint+1])
+		if gap {
+			lines = append(lines, fmt.Sprintf("# edge %d: 1pps pulses were lost in the interval used to time it", i+1))
+		}
+
+		// Count flash edges starting from 1
+		if edges[i].on {
+			edgeLines = append(edgeLines, fmt.Sprintf("%d on  %s%s", i+1, newTimestamp+"Z|", offsetStr))
+		} else {
+			edgeLines = append(edgeLines, fmt.Sprintf("%d off %s%s", i+1, newTimestamp+"Z|", offsetStr))
+		}
+		schedulerLog.Info("flash edge timed", "edge", i+1, "on", edges[i].on, "utc", newTimestamp,
+			"offset", offsetStr, "gap", gap)
+
+		utc, err := time.Parse(timestampLayout, newTimestamp)
+		if err != nil {
+			schedulerLog.Error("flash edge timestamp not parsed", "edge", i+1, "err", err)
+			continue
+		}
+		timedEdges = append(timedEdges, timedFlashEdge{number: i + 1, on: edges[i].on, utc: utc, gap: gap})
+	}
+
+	for _, line := range append(lines, edgeLines...) {
+		_, fileErr := fmt.Fprintln(w, line)
+		if fileErr != nil {
+			filesLog.Error("flash edge file not written", "err", fileErr)
+			break
 		}
 	}
+	return timedEdges
+}
+
+// edgeGpsUtcOffset is the GpsUtcOffset written on an edge line: the one reported in the offset epoch of
+// the edge, or the almanac offset its time stamps were rebased to
+func edgeGpsUtcOffset(data *OnePPSdata, epochIndex int) string {
+	if epochIndex < 0 || epochIndex >= len(data.offsetEpochs) {
+		return gpsData.gpsUtcOffset
+	}
+	if epoch := data.offsetEpochs[epochIndex]; epoch.rebased {
+		return strconv.Itoa(epoch.appliedOffset)
+	}
+	return data.offsetEpochs[epochIndex].reported
+}
+
+// calcEdgeTimestamp returns the interpolated UTC timestamp of a flash edge and the index of the
+// tick stamp that precedes it. An edge before the first tick stamp or after the last is not timed.
+func calcEdgeTimestamp(data *OnePPSdata, edgeTime int64) (string, int, bool) {
+	if len(data.tickStamp) == 0 || edgeTime < data.tickStamp[0].runningTickTime {
+		return "", 0, false
+	}
+	for j := 1; j < len(data.tickStamp); j++ {
+		// Find the onePPS time stamp that precedes the flash edge - we go past it, then back up 1 step
+		if data.tickStamp[j].runningTickTime > edgeTime {
+			leftPoint := j - 1
+			rightPoint := j
+			newTimestamp := interpolateCorrectedTimestamp(edgeTime, data.tickStamp[leftPoint], data.tickStamp[rightPoint])
+			return newTimestamp, leftPoint, true
+		}
+	}
+	return "", 0, false
 }
 
 func interpolateTimestamp(flashTime, t1, t2 int64, s1, s2 string) string {
-	// Calculate seconds since start
-	seconds1 := float64(calcDeltaSeconds(onePPSdata.startTime, s1))
-	seconds2 := float64(calcDeltaSeconds(onePPSdata.startTime, s2))
+	return interpolateWithQErr(flashTime, t1, t2, s1, s2, 0, 0)
+}
+
+// interpolateCorrectedTimestamp interpolates between two tick stamps, each 1pps taken at its true time:
+// the GPS second plus the quantization error the receiver reported for it (see TIM-TP)
+func interpolateCorrectedTimestamp(flashTime int64, left, right TickStamp) string {
+	return interpolateWithQErr(flashTime, left.runningTickTime, right.runningTickTime,
+		left.utcTimestamp, right.utcTimestamp, left.qErr, right.qErr)
+}
+
+func interpolateWithQErr(flashTime, t1, t2 int64, s1, s2 string, qErr1, qErr2 int32) string {
+	// Calculate seconds relative to the left tick stamp (so that any 1pps history can be used)
+	seconds1 := float64(qErr1) * 1e-12
+	seconds2 := float64(calcDeltaSeconds(s1, s2)) + float64(qErr2)*1e-12
 
 	// Convert tick times to float64
 	time1 := float64(t1)
@@ -661,8 +827,8 @@ func interpolateTimestamp(flashTime, t1, t2 int64, s1, s2 string) string {
 	// Calculate slope of seconds versus ticks
 	a := (seconds2 - seconds1) / (time2 - time1)
 
-	// Calculate f(flashTime)  output is time (in seconds) relative to seconds1
-	deltaTsecs := a * float64(flashTime-t1)
+	// Calculate f(flashTime)  output is time (in seconds) relative to the left tick stamp
+	deltaTsecs := seconds1 + a*float64(flashTime-t1)
 
 	deltaTsecs += 1.0 // This corrects for recording the GPS time of the  + or - pulse using the current GPS time,
 	// which is 1 second behind because the GPRMC string gets emitted AFTER the + or - event
@@ -673,12 +839,18 @@ func interpolateTimestamp(flashTime, t1, t2 int64, s1, s2 string) string {
 
 func show1ppsHistory() {
 
-	buildPlot() // Writes ppsHistory.png in current working directory
+	plotPath := filepath.Join(myWin.sessionDir, ppsHistoryPlotFile)
+	err := buildPlot(plotPath) // Writes ppsHistory.png in the session directory
+	if err != nil {
+		filesLog.Error("1pps history plot not written", "err", err)
+		showMsg("1pps history", "\nThe plot could not be written:\n"+err.Error()+"\n", 200, 600)
+		return
+	}
 
 	pngWin := myWin.App.NewWindow("1pps history")
 	pngWin.Resize(fyne.Size{Height: 450, Width: 1400})
 
-	testImage := canvas.NewImageFromFile("ppsHistory.png")
+	testImage := canvas.NewImageFromFile(plotPath)
 	pngWin.SetContent(testImage)
 	pngWin.CenterOnScreen()
 	pngWin.Show()
@@ -694,7 +866,7 @@ func isValidRecordingTime() bool {
 		return false
 	}
 	myWin.recordingDuration = value
-	log.Println("recording length (sec): ", textGiven)
+	schedulerLog.Info("recording length set", "seconds", textGiven)
 	return true
 }
 
@@ -705,14 +877,13 @@ func isValidUTCtime() (bool, int64) {
 		return false, 0
 	}
 	unixTime := utcTime.Unix()
-	log.Println("utc date/time entered:", utcTime)
+	schedulerLog.Info("UTC event time entered", "utc", utcTime)
 	myWin.eventDateTime = utcTime
 	return true, unixTime
 }
 
 func calculateStartTime(delta int64) string {
 	exposureStr := getResponse(myWin.SharpCapConn, "exposure")
-	log.Println("Rcvd:", exposureStr, "ms exposure time")
 	if exposureStr == "No camera selected" {
 		showMsg("SharpCap error", "\nNo camera selected!\n", 200, 200)
 		return "No camera selected"
@@ -724,11 +895,11 @@ func calculateStartTime(delta int64) string {
 	}
 	//fmt.Println(exposureMs)
 	readingsPerSecond := 1000 / exposureMs
-	log.Println(readingsPerSecond, "readings per second")
+	schedulerLog.Info("camera exposure", "exposureMs", exposureMs, "readingsPerSecond", readingsPerSecond)
 	neededFlashTime := int(math.Ceil(10 / readingsPerSecond))
 	flashTime := int64(neededFlashTime) // seconds
 	cmd := fmt.Sprintf("flash duration %d", neededFlashTime)
-	sendCommandToArduino(cmd)
+	sendCommandToArduino(cmd, originScheduler)
 
 	var offset int64
 
@@ -743,16 +914,17 @@ func calculateStartTime(delta int64) string {
 
 	startTime := unixTimeNow + delta - offset
 	d := unixTimeNow - startTime
-	log.Println("unixTime now:", unixTimeNow)
-	log.Println("unixTime at start of acquisition:", startTime, "(seconds in the future:", -d, ")")
+	schedulerLog.Info("start of acquisition calculated", "unixTimeNow", unixTimeNow, "startTime", startTime,
+		"secondsInFuture", -d)
 	if d < 0 {
 		myWin.leaderStartTime = startTime
 		myWin.firstFlashTime = myWin.leaderStartTime + flashTime
 		myWin.secondFlashTime = myWin.firstFlashTime + flashTime + int64(myWin.recordingDuration)
 		myWin.endOfRecording = myWin.secondFlashTime + 3*flashTime
+		myWin.flashDuration = flashTime
 		return "ok"
 	} else {
-		log.Printf("Start time is in the past by %d seconds.", d)
+		schedulerLog.Warn("start time is in the past", "seconds", d)
 		return fmt.Sprintf("Start time is in the past by %d seconds.", d)
 	}
 }
@@ -777,9 +949,7 @@ func armUTCstart() string {
 
 		utcText := myWin.utcEventTime.Text
 		if utcText != "" {
-			log.Println("\nUTC event time supplied:", utcText)
-		} else {
-			fmt.Println("")
+			schedulerLog.Info("UTC event time supplied", "utc", utcText)
 		}
 
 		myWin.App.Preferences().SetString("UTCstartTime", myWin.utcEventTime.Text)
@@ -789,6 +959,7 @@ func armUTCstart() string {
 		myWin.pastFlashOne = false
 		myWin.pastFlashTwo = false
 		myWin.pastEnd = false
+		goalpostCommands.reset()
 
 		workDir := getWorkDir()
 		createLogAndFlashEdgeFiles(workDir)
@@ -799,7 +970,7 @@ func armUTCstart() string {
 		}
 
 		if utcText == "" {
-			log.Println("Start test recording 10 seconds from now")
+			schedulerLog.Info("test recording requested for 10 seconds from now")
 			result = calculateStartTime(0)
 		} else {
 			ok, unixTime := isValidUTCtime()
@@ -814,28 +985,40 @@ func armUTCstart() string {
 		}
 
 		if result != "ok" {
+			schedulerLog.Warn("arm rejected", "reason", result)
 			showMsg("Start time error", "\n"+result+"\n", 250, 400)
 			return result
 		}
 
+		leapSecondWarning := checkLeapSeconds(gpsData.gpsUtcOffset, currentUtcTime(), time.Unix(myWin.endOfRecording, 0))
+		if leapSecondWarning != "" {
+			timingLog.Warn("leap second check", "warning", leapSecondWarning)
+			showMsg("GpsUtcOffset warning", "\n"+leapSecondWarning+"\n", 300, 800)
+		}
+
 		processFlashIntensitySliderChange(myWin.flashIntensitySlider.Value)
 
 		myWin.armUTCbutton.SetText("UTC start armed and active")
 		myWin.armUTCbutton.Importance = widget.SuccessImportance
 		myWin.utcStartArmed = true
 		myWin.App.Preferences().SetBool("ArmUTCstartTime", true)
+		schedulerLog.Info("UTC start armed", "leaderStart", myWin.leaderStartTime, "flashOne", myWin.firstFlashTime,
+			"flashTwo", myWin.secondFlashTime, "end", myWin.endOfRecording, "flashDuration", myWin.flashDuration)
+		startJournal()
 	} else {
 		myWin.utcStartArmed = false
 		myWin.armUTCbutton.Importance = widget.MediumImportance
 		myWin.armUTCbutton.SetText("Arm UTC start")
 
 		myWin.App.Preferences().SetBool("ArmUTCstartTime", false)
-		log.Println("UTC start cancelled.")
+		schedulerLog.Info("UTC start cancelled")
+		closeJournal("cancelled")
 	}
 	return "OK"
 }
 
-func buildPlot() {
+// buildPlot writes the 1pps history plot of the session to path
+func buildPlot(path string) error {
 
 	n := len(onePPSdata.tickStamp)
 	myPts := make(plotter.XYs, n)
@@ -856,11 +1039,30 @@ func buildPlot() {
 
 	err := plotutil.AddScatters(plt, myPts)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("buildPlot(): %w", err)
+	}
+
+	// Lost 1pps pulses are marked where the first pulse after the gap was received
+	if len(onePPSdata.gaps) > 0 {
+		gapPts := make(plotter.XYs, len(onePPSdata.gaps))
+		for i, gap := range onePPSdata.gaps {
+			gapPts[i].X = float64(calcDeltaSeconds(onePPSdata.startTime, gap.utcTimestamp))
+			gapPts[i].Y = float64(gap.runningTickTime)
+		}
+		gapScatter, err := plotter.NewScatter(gapPts)
+		if err != nil {
+			return fmt.Errorf("buildPlot(): %w", err)
+		}
+		gapScatter.GlyphStyle.Color = color.NRGBA{R: 220, A: 255}
+		gapScatter.GlyphStyle.Shape = draw.CrossGlyph{}
+		gapScatter.GlyphStyle.Radius = vg.Points(12)
+		plt.Add(gapScatter)
+		plt.Legend.Add("lost 1pps", gapScatter)
 	}
 
-	err = plt.Save(20*vg.Inch, 6*vg.Inch, "ppsHistory.png")
+	err = plt.Save(20*vg.Inch, 6*vg.Inch, path)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("buildPlot(): %w", err)
 	}
+	return nil
 }
@@ -9,8 +9,8 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"image/color"
-	"log"
 	"strconv"
+	"strings"
 )
 
 type forcedVariant struct {
@@ -63,6 +63,32 @@ func (app *Config) makeUI() {
 	leftItem.Add(closePortButton)
 
 	leftItem.Add(widget.NewButton("Show 1pps history", func() { show1ppsHistory() }))
+	leftItem.Add(widget.NewButton("Show satellites", func() { showSkyPanel() }))
+	app.alertsButton = widget.NewButton("Alerts", func() { showAlertsPanel() })
+	leftItem.Add(app.alertsButton)
+	leftItem.Add(widget.NewButton("Show GFT device", func() { showDevicePanel() }))
+
+	app.ppsRetentionSelect = widget.NewSelect([]string{"1", "2", "6", "12", "24", "48"},
+		func(value string) { processPpsRetentionSelection(value) })
+	app.ppsRetentionSelect.SetSelected(strconv.Itoa(
+		myWin.App.Preferences().IntWithFallback("PpsRetentionHours", defaultPpsRetentionHours)))
+	leftItem.Add(container.NewHBox(canvas.NewText("1pps history kept (hours)", nil), app.ppsRetentionSelect))
+
+	binaryArchiveCheckBox := widget.NewCheck("binary sentence archive", processBinaryArchiveCheck)
+	binaryArchiveCheckBox.Checked = myWin.App.Preferences().BoolWithFallback("BinaryArchive", false)
+	leftItem.Add(binaryArchiveCheckBox)
+
+	hostTimeColumnCheckBox := widget.NewCheck("host times in sentence log", processHostTimeColumnCheck)
+	hostTimeColumnCheckBox.Checked = myWin.App.Preferences().BoolWithFallback("HostTimeColumn", false)
+	leftItem.Add(hostTimeColumnCheckBox)
+
+	timeServerCheckBox := widget.NewCheck("time server (SNTP on localhost)", processTimeServerCheck)
+	timeServerCheckBox.Checked = myWin.App.Preferences().BoolWithFallback("TimeServer", false)
+	leftItem.Add(timeServerCheckBox)
+
+	timeServerPortCheckBox := widget.NewCheck("time server on NTP port 123", processTimeServerStandardPortCheck)
+	timeServerPortCheckBox.Checked = myWin.App.Preferences().BoolWithFallback("TimeServerStandardPort", false)
+	leftItem.Add(timeServerPortCheckBox)
 
 	leftItem.Add(blackThemeCheckbox)
 
@@ -141,6 +167,22 @@ func (app *Config) makeUI() {
 	app.modeCheckBox.SetChecked(false)
 	column1.Add(app.modeCheckBox)
 
+	app.gpzdaCheckBox = widget.NewCheck("$GPZDA", func(bool) {})
+	app.gpzdaCheckBox.SetChecked(false)
+	column1.Add(app.gpzdaCheckBox)
+
+	app.gpgsaCheckBox = widget.NewCheck("$GPGSA", func(bool) {})
+	app.gpgsaCheckBox.SetChecked(false)
+	column1.Add(app.gpgsaCheckBox)
+
+	app.gpgsvCheckBox = widget.NewCheck("$GPGSV", func(bool) {})
+	app.gpgsvCheckBox.SetChecked(false)
+	column1.Add(app.gpgsvCheckBox)
+
+	app.ubxCheckBox = widget.NewCheck("UBX", func(bool) {})
+	app.ubxCheckBox.SetChecked(false)
+	column1.Add(app.ubxCheckBox)
+
 	column1.Add(layout.NewSpacer())
 
 	flashIntensitySlider := widget.NewSlider(0, 3*255)
@@ -169,7 +211,7 @@ func (app *Config) makeUI() {
 	// Compose bottom element of the main Border layout
 
 	app.cmdEntry = widget.NewEntry()
-	app.cmdEntry.OnSubmitted = func(str string) { sendCommandToArduino("") }
+	app.cmdEntry.OnSubmitted = func(str string) { sendCommandToArduino("", originUI) }
 
 	app.pathEntry = widget.NewEntry()
 
@@ -227,12 +269,22 @@ func shutdownEnable(checked bool) {
 
 func processUTCeventTimeEntry(stuff string) {
 	myWin.App.Preferences().SetString("UTCstartTime", stuff)
-	log.Println(stuff)
+	schedulerLog.Info("UTC start time entered", "utc", stuff)
+}
+
+func processPpsRetentionSelection(value string) {
+	hours, err := strconv.Atoi(value)
+	if err != nil {
+		return
+	}
+	myWin.App.Preferences().SetInt("PpsRetentionHours", hours)
+	ppsRetentionHours = hours
+	timingLog.Info("1pps history retention set", "hours", hours)
 }
 
 func processRecordingLengthEntry(stuff string) {
 	myWin.App.Preferences().SetString("RecordingTime", stuff)
-	log.Println("Recording time set to: ", stuff)
+	schedulerLog.Info("recording time entered", "seconds", stuff)
 }
 
 //func changeLogAndEdgeFiles(path string) {
@@ -247,24 +299,37 @@ func processRecordingLengthEntry(stuff string) {
 func showIntensitySlider(clicked bool) {
 	myWin.flashIntensitySlider.Hidden = !clicked
 	if clicked {
-		processFlashIntensitySliderChange(myWin.flashIntensitySlider.Value)
-		sendCommandToArduino("led on")
+		// The LED is turned on once its range and level have been set
+		commandQueue.send(originUI, append(setLedIntensity(myWin.flashIntensitySlider.Value), "led on")...)
 	} else {
-		sendCommandToArduino("led off")
+		sendCommandToArduino("led off", originUI)
 	}
 }
 
-func processFlashIntensitySliderChange(value float64) {
+// ledRangeAndLevel returns the flash range and level commands for an LED intensity slider value
+func ledRangeAndLevel(value float64) (int64, int64) {
 	v := int64(value)
 	ledRange := v / 256
-	level := v - ledRange*255
+	return ledRange, v - ledRange*255
+}
+
+// ledIntensity returns the LED intensity slider value of a flash range and level (the inverse of
+// ledRangeAndLevel)
+func ledIntensity(ledRange, level int64) float64 {
+	return float64(ledRange*255 + level)
+}
+
+func processFlashIntensitySliderChange(value float64) {
+	commandQueue.send(originUI, setLedIntensity(value)...)
+}
+
+// setLedIntensity saves an LED intensity slider value and returns the commands that set it: the level
+// only means something once the range has been set, so they are sent in this order
+func setLedIntensity(value float64) []string {
+	ledRange, level := ledRangeAndLevel(value)
 	levelStr := fmt.Sprintf("%0.0f", value)
-	//fmt.Println("Saving LedIntensity as:", levelStr)
 	myWin.App.Preferences().SetString("LedIntensity", levelStr)
-
-	//fmt.Printf("range: %d  level: %d\n", ledRange, level)
-	sendCommandToArduino(fmt.Sprintf("flash range %d", ledRange))
-	sendCommandToArduino(fmt.Sprintf("flash level %d", level))
+	return []string{fmt.Sprintf("flash range %d", ledRange), fmt.Sprintf("flash level %d", level)}
 }
 
 func closeCurrentPort() {
@@ -272,18 +337,18 @@ func closeCurrentPort() {
 	if myWin.serialPort != nil {
 		err := myWin.serialPort.Close()
 		if err != nil {
-			log.Println(fmt.Errorf("closeCurrentPort(): %w", err))
+			serialLog.Error("serial port not closed", "port", myWin.comPortName, "err", err)
 		}
 		myWin.serialPort = nil
 		gpsData = GPSdata{}
 		updateStatusLine(gpsData)
 		addToTextOutDisplay(fmt.Sprintf("%s has been closed by user", myWin.comPortName))
-		log.Printf("%s has been closed by user", myWin.comPortName)
+		serialLog.Info("serial port closed by user", "port", myWin.comPortName)
 		myWin.comPortInUse.Text = "Serial port open: none"
 		myWin.comPortInUse.Refresh()
 	} else {
 		addToTextOutDisplay("There is no open serial port")
-		log.Println("There is no open serial port")
+		serialLog.Info("close requested but there is no open serial port")
 	}
 	myWin.spMutex.Unlock()
 }
@@ -292,7 +357,9 @@ func closeCurrentPort() {
 //	myWin.keepLogFile = checked
 //}
 
-func sendCommandToArduino(extCmd string) {
+// sendCommandToArduino sends a command (or, if extCmd is empty, the one in the command entry) to the GFT
+// for origin without waiting for it to be answered. What became of it is reported when it is known.
+func sendCommandToArduino(extCmd string, origin string) {
 	var cmdGiven string
 	if extCmd != "" {
 		cmdGiven = extCmd
@@ -300,22 +367,34 @@ func sendCommandToArduino(extCmd string) {
 		cmdGiven = myWin.cmdEntry.Text
 	}
 
-	// Calculate checksum
-	checkSum := byte(0)
-	for _, char := range cmdGiven {
-		checkSum ^= byte(char)
+	// ubx commands are for the receiver: the frame is sent for the GFT to pass through
+	if strings.HasPrefix(cmdGiven, "ubx ") {
+		sendUBX(cmdGiven)
+		return
 	}
 
-	cmdGiven += fmt.Sprintf("*%02X\r\n", checkSum)
+	// The response arrives through the sentence loop, which may be the caller: the command is queued
+	commandQueue.send(origin, cmdGiven)
+}
+
+func sendUBX(cmd string) {
+	frame, err := parseUBXCommand(cmd)
+	if err != nil {
+		serialLog.Warn("ubx command not sent", "cmd", cmd, "err", err)
+		addToTextOutDisplay(err.Error())
+		return
+	}
 	myWin.spMutex.Lock()
-	if myWin.serialPort != nil {
-		_, err := myWin.serialPort.Write([]byte(cmdGiven))
-		if err != nil {
-			errMsg := fmt.Errorf("%w", err)
-			log.Println(errMsg.Error())
-		}
+	defer myWin.spMutex.Unlock()
+	if myWin.serialPort == nil {
+		serialLog.Warn("ubx command not sent: no open serial port", "cmd", cmd)
+		return
+	}
+	if _, err = myWin.serialPort.Write(frame); err != nil {
+		serialLog.Error("ubx command not sent to GFT", "cmd", cmd, "err", err)
+	} else {
+		serialLog.Info("ubx command sent to GFT", "cmd", cmd, "frame", fmt.Sprintf("% X", frame))
 	}
-	myWin.spMutex.Unlock()
 }
 
 func showCommandHelp() {
@@ -335,11 +414,12 @@ func handleComPortSelection(value string) {
 		err := myWin.serialPort.Close()
 		if err != nil {
 			msg := fmt.Sprintf("Attempt to close %s failed.", myWin.comPortName)
-			log.Println(msg)
+			serialLog.Error("serial port not closed", "port", myWin.comPortName, "err", err)
 			addToTextOutDisplay(msg)
 			return
 		}
 		msg := fmt.Sprintf("The currently active serial port (%s) was closed.", myWin.comPortName)
+		serialLog.Info("serial port closed for a new selection", "port", myWin.comPortName)
 
 		gpsData = GPSdata{}
 		updateStatusLine(gpsData)
@@ -349,10 +429,8 @@ func handleComPortSelection(value string) {
 
 		myWin.comPortName = ""
 		addToTextOutDisplay(msg)
-		log.Println(msg)
 		msg = fmt.Sprintf("Make a new serial port selection.")
 		addToTextOutDisplay(msg)
-		log.Println(msg)
 		myWin.comPortInUse.SetText("Serial port open: " + "none")
 		return
 	}
@@ -365,12 +443,12 @@ func handleComPortSelection(value string) {
 		if err != nil {
 			msg := fmt.Sprintf("Attempt to open %s failed.", myWin.comPortName)
 			addToTextOutDisplay(msg)
-			log.Println(msg)
+			serialLog.Error("serial port not opened", "port", myWin.comPortName, "err", err)
 			return
 		} else {
 			msg := fmt.Sprintf("%s was opened successfully.", myWin.comPortName)
 			addToTextOutDisplay(msg)
-			log.Println(msg)
+			serialLog.Info("serial port opened", "port", myWin.comPortName, "baudrate", myWin.curBaudRate)
 		}
 		myWin.comPortInUse.SetText("Serial port open: " + value)
 	}
@@ -405,9 +483,12 @@ func makeStatusLine(app *Config) *fyne.Container {
 
 	app.dateTimeStatus = canvas.NewText("UTC date/time: not available", nil)
 
-	// 5 items with only 4 columns so that dateTime appears on second line
+	app.satellitesStatus = canvas.NewText("Satellites: not available", nil)
+
+	// 6 items with only 4 columns so that dateTime and satellites appear on second line
 	ans := container.NewGridWithColumns(4,
-		app.statusStatus, app.latitudeStatus, app.longitudeStatus, app.altitudeStatus, app.dateTimeStatus)
+		app.statusStatus, app.latitudeStatus, app.longitudeStatus, app.altitudeStatus, app.dateTimeStatus,
+		app.satellitesStatus)
 	return ans
 }
 
@@ -0,0 +1,37 @@
+package main
+
+import "strings"
+
+// A nest is a sentence with another sentence inside it. The GFT interrupts the sentence it is sending
+// (usually an NMEA) to send a P, E, + or ! sentence, and sends the rest of the interrupted sentence
+// (the nestee) as the next line, for example
+//
+//	{0033C29E $GPDTM,W84,,{0050BD13 P}*77
+//	0.0,N,0.0,E,0.0,W84*6F}*3A
+//
+// A NestSplitter turns the two lines back into the two sentences.
+type NestSplitter struct {
+	waiting bool
+	start   string           // the first part of the nestee, without its {
+	nester  ReceivedSentence // the sentence inside the nest, which was complete in the first line
+}
+
+// feed returns the sentences that a line completes, in the order they are to be parsed: the line
+// itself, nothing if it starts a nest, or the nestee and then the nester if it finishes one
+func (ns *NestSplitter) feed(line ReceivedSentence) []ReceivedSentence {
+	if ns.waiting {
+		ns.waiting = false
+		nestee := ReceivedSentence{text: "{" + ns.start + line.text, hostTime: line.hostTime}
+		return []ReceivedSentence{nestee, ns.nester}
+	}
+
+	// There will be exactly 2 { characters in a nest
+	parts := strings.Split(line.text, "{")
+	if len(parts) > 2 {
+		ns.waiting = true
+		ns.start = parts[1]
+		ns.nester = ReceivedSentence{text: "{" + parts[2], hostTime: line.hostTime}
+		return nil
+	}
+	return []ReceivedSentence{line}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func Test_nestSplitter(t *testing.T) {
+	var nests NestSplitter
+	first := time.Now()
+	second := first.Add(2 * time.Millisecond)
+
+	plain := ReceivedSentence{text: gftLine("{000C97C7 P}"), hostTime: first}
+	assert.Equal(t, []ReceivedSentence{plain}, nests.feed(plain))
+
+	assert.Nil(t, nests.feed(ReceivedSentence{text: "{0033C29E $GPDTM,W84,,{0050BD13 P}*77", hostTime: first}))
+	completed := nests.feed(ReceivedSentence{text: "0.0,N,0.0,E,0.0,W84*6F}*3A", hostTime: second})
+	assert.Equal(t, []ReceivedSentence{
+		{text: "{0033C29E $GPDTM,W84,,0.0,N,0.0,E,0.0,W84*6F}*3A", hostTime: second},
+		{text: "{0050BD13 P}*77", hostTime: first},
+	}, completed)
+	for _, sentence := range completed {
+		_, err := decodeLine(sentence.text)
+		assert.Nil(t, err, sentence.text)
+	}
+}
+
+// FuzzNestSplitter checks that no pair of lines, however garbled, makes the nest handling and the
+// decoding of what it returns panic
+func FuzzNestSplitter(f *testing.F) {
+	f.Add("{0033C29E $GPDTM,W84,,{0050BD13 P}*77", "0.0,N,0.0,E,0.0,W84*6F}*3A")
+	f.Add(gftLine("{000C97C7 P}"), gftLine("{000C97C7 E}"))
+	f.Fuzz(func(t *testing.T, first, second string) {
+		var nests NestSplitter
+		for _, line := range []string{first, second} {
+			for _, sentence := range nests.feed(ReceivedSentence{text: line}) {
+				_, _ = decodeLine(sentence.text)
+			}
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Earlier operation logs are kept as IotaGFToperationLog.1.txt (the most recent) to IotaGFToperationLog.5.txt
+const operationLogBackups = 5
+
+// Each part of the app writes to the operation log through its own logger so that every record
+// carries a subsystem tag.
+var (
+	appLog       = newSubsystemLogger("app")
+	serialLog    = newSubsystemLogger("serial")
+	parserLog    = newSubsystemLogger("parser")
+	timingLog    = newSubsystemLogger("timing")
+	schedulerLog = newSubsystemLogger("scheduler")
+	sharpCapLog  = newSubsystemLogger("sharpcap")
+	serverLog    = newSubsystemLogger("server")
+	filesLog     = newSubsystemLogger("files")
+)
+
+var operationLogLevel = new(slog.LevelVar) // Info unless the app is started with -debug
+
+var operationLogOpen bool // records go to IotaGFToperationLog.txt rather than stderr
+
+// Until initOperationLog is called (and in the offline tools and tests) records go to stderr
+var operationLogHandler slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: operationLogLevel})
+
+// subsystemHandler adds the subsystem tag and passes records on to whatever operationLogHandler is current
+type subsystemHandler struct {
+	subsystem string
+	attrs     []slog.Attr
+}
+
+func newSubsystemLogger(subsystem string) *slog.Logger {
+	return slog.New(&subsystemHandler{subsystem: subsystem})
+}
+
+func (h *subsystemHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return operationLogHandler.Enabled(ctx, level)
+}
+
+func (h *subsystemHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(slog.String("subsystem", h.subsystem))
+	r.AddAttrs(h.attrs...)
+	return operationLogHandler.Handle(ctx, r)
+}
+
+func (h *subsystemHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &subsystemHandler{subsystem: h.subsystem, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *subsystemHandler) WithGroup(_ string) slog.Handler {
+	return h // groups are not used in the operation log
+}
+
+// fatal logs an error the app cannot go on after, to the operation log and to stderr, and exits
+func fatal(msg string, err error) {
+	appLog.Error(msg, "err", err)
+	if operationLogOpen {
+		fmt.Fprintf(os.Stderr, "IotaGFTapp: %s: %v\n", msg, err)
+	}
+	os.Exit(1)
+}
+
+func rotatedLogName(path string, n int) string {
+	base := strings.TrimSuffix(path, ".txt")
+	return fmt.Sprintf("%s.%d.txt", base, n)
+}
+
+// rotateLogFiles shifts path to path.1.txt, path.1.txt to path.2.txt and so on, discarding the oldest
+func rotateLogFiles(path string, backups int) {
+	_ = os.Remove(rotatedLogName(path, backups))
+	for n := backups - 1; n >= 1; n-- {
+		_ = os.Rename(rotatedLogName(path, n), rotatedLogName(path, n+1))
+	}
+	_ = os.Rename(path, rotatedLogName(path, 1))
+}
+
+// operationLogOptions removes the -json and -debug options from the command line arguments
+func operationLogOptions(args []string) (rest []string, asJSON bool, debug bool) {
+	for _, arg := range args {
+		switch arg {
+		case "-json":
+			asJSON = true
+		case "-debug":
+			debug = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, asJSON, debug
+}
+
+// initOperationLog rotates the operation logs of earlier launches and opens a new one, writing either
+// text or JSON records. Messages from the standard log package are captured too.
+func initOperationLog(path string, asJSON bool, debug bool) (*os.File, error) {
+	rotateLogFiles(path, operationLogBackups)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	if debug {
+		operationLogLevel.Set(slog.LevelDebug)
+	}
+	options := &slog.HandlerOptions{Level: operationLogLevel}
+	if asJSON {
+		operationLogHandler = slog.NewJSONHandler(file, options)
+	} else {
+		operationLogHandler = slog.NewTextHandler(file, options)
+	}
+	operationLogOpen = true
+	slog.SetDefault(appLog)
+	return file, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_rotateLogFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), operationLog)
+	for launch := 1; launch <= operationLogBackups+2; launch++ {
+		rotateLogFiles(path, operationLogBackups)
+		assert.Nil(t, os.WriteFile(path, []byte(strings.Repeat("x", launch)), 0644))
+	}
+
+	current, _ := os.ReadFile(path)
+	assert.Equal(t, operationLogBackups+2, len(current))
+	previous, _ := os.ReadFile(rotatedLogName(path, 1))
+	assert.Equal(t, operationLogBackups+1, len(previous))
+	oldest, _ := os.ReadFile(rotatedLogName(path, operationLogBackups))
+	assert.Equal(t, 2, len(oldest))
+	_, err := os.Stat(rotatedLogName(path, operationLogBackups+1))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_operationLogOptions(t *testing.T) {
+	rest, asJSON, debug := operationLogOptions([]string{"-json", "115200"})
+	assert.Equal(t, []string{"115200"}, rest)
+	assert.True(t, asJSON)
+	assert.False(t, debug)
+}
+
+func Test_initOperationLog(t *testing.T) {
+	savedHandler, savedLevel, savedDefault := operationLogHandler, operationLogLevel.Level(), slog.Default()
+	savedOpen := operationLogOpen
+	defer func() {
+		operationLogHandler, operationLogOpen = savedHandler, savedOpen
+		operationLogLevel.Set(savedLevel)
+		slog.SetDefault(savedDefault)
+	}()
+
+	path := filepath.Join(t.TempDir(), operationLog)
+	file, err := initOperationLog(path, true, false)
+	assert.Nil(t, err)
+	schedulerLog.Info("flash one requested", "unixTime", 1700000000)
+	parserLog.Debug("RMC") // below the level in use
+	assert.Nil(t, file.Close())
+
+	contents, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	assert.Equal(t, 1, len(lines))
+	var record map[string]any
+	assert.Nil(t, json.Unmarshal([]byte(lines[0]), &record))
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "scheduler", record["subsystem"])
+	assert.Equal(t, "flash one requested", record["msg"])
+	assert.Equal(t, float64(1700000000), record["unixTime"])
+}
@@ -2,10 +2,8 @@ package main
 
 import (
 	"bytes"
-	"errors"
 	"fmt"
-	"image/color"
-	"log"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -22,255 +20,277 @@ func calcChecksum(str string) (string, uint8) {
 	return fmt.Sprintf("*%02X", checksum), checksum
 }
 
+// getGpsUtcOffset returns the GpsUtcOffset that GPRMC times are corrected to: the last almanac offset
+// reported by a receiver or, until one has been, the leap second table value for the current date.
 func getGpsUtcOffset() string {
-	return myWin.App.Preferences().StringWithFallback("gpsUtcOffset", gpsUtcOffset)
+	tableOffset := strconv.Itoa(leapSecondOffsetAt(leapSecondTable, currentUtcTime()))
+	return myWin.App.Preferences().StringWithFallback("gpsUtcOffset", tableOffset)
 }
 
-func parseSentence(sentence, checksum string, gpsInfo *GPSdata) ([]string, error) {
-	ans := []string{""}
-	var deltaP int64
-
-	chkSum, _ := calcChecksum(sentence)
+// SentenceActions is what applying a sentence leaves for the UI layer to carry out
+type SentenceActions struct {
+	armRecording    bool   // the first GPS time has arrived and a recording is to be armed
+	gpsUtcOffset    string // the GpsUtcOffset of a PUBX04, with its validity, to be shown
+	newGpsUtcOffset bool   // that offset is from the almanac and differs from the one in use: announce it
+	deltaP          int64  // ticks since the previous pulse sentence, shown with a pulse sentence
+}
 
-	if chkSum != checksum {
-		log.Printf("Checksum error %s != %s\n", checksum, chkSum)
-		return ans, errors.New("parseSentence() found bad checksum in " + sentence)
+// parseSentence decodes a sentence (without its trailing checksum, which is given separately) and applies it
+func parseSentence(sentence, checksum string, gpsInfo *GPSdata) (Sentence, SentenceActions, error) {
+	s, err := decodeSentence(sentence, checksum)
+	if err != nil {
+		return nil, SentenceActions{}, err
 	}
+	return s, applySentence(s, gpsInfo), nil
+}
 
-	// Test for an embedded command response in the sentence (assumed to be an NMEA)
-	parts := strings.Split(sentence, "[]")
-	if len(parts) == 3 {
-		// We have an embedded command response. We simply remove it and print it out.
-		sentence = parts[0] + parts[2]
-		embeddedCommandResponse := parts[1]
-		fmt.Printf("embedded command response: %s\n", embeddedCommandResponse)
+// applySentence makes the changes that a decoded sentence calls for to gpsInfo, onePPSdata, flashEdges and
+// the schedule, and returns what the UI layer is to do about it. It leaves the display and the decoded
+// sentence alone.
+func applySentence(s Sentence, gpsInfo *GPSdata) SentenceActions {
+	var actions SentenceActions
+	if response := s.base().embeddedResponse; response != "" {
+		routeCommandResponse(response, gpsInfo.hostTime)
 	}
 
-	if strings.Contains(sentence, "$") { // process nmea sentence
-		parts := strings.Split(sentence, " ")
-		if len(parts) < 2 {
-			return ans, errors.New("parseSentence(): split of $ sentence on space did not give 2 parts")
+	switch s := s.(type) {
+	case *GGASentence:
+		gpsInfo.altitude = s.altitude
+		gpsInfo.altitudeUnits = s.altitudeUnits
+		gpsInfo.satellitesUsed = s.satellitesUsed
+		gpsInfo.hdop = s.hdop
+		myWin.sitePosition.addFix(s, gpsInfo.unixTime)
+	case *RMCSentence:
+		actions.armRecording = applyRMC(s, gpsInfo)
+	case *ZDASentence:
+		// A u-blox receiver sends ZDA from its real time clock before it has a fix: the time is only
+		// taken once the receiver has a fix
+		if s.valid && gpsInfo.hasFix() {
+			actions.armRecording = applyTimeOfDay(s.timeOfDay, gpsInfo)
+		}
+	case *GSASentence:
+		gpsInfo.fixType = s.fixType
+		gpsInfo.pdop = s.pdop
+		gpsInfo.hdop = s.hdop
+		gpsInfo.sky.addGSA(s, gpsInfo.unixTime)
+		noteTimeValidProgress(gpsInfo)
+	case *GSVSentence:
+		if gpsInfo.satellitesInView == nil {
+			gpsInfo.satellitesInView = make(map[GSVGroup]int)
+		}
+		gpsInfo.satellitesInView[GSVGroup{talker: s.talker, signalID: s.signalID}] = s.inView
+		gpsInfo.sky.addGSV(s)
+		noteTimeValidProgress(gpsInfo)
+	case *PUBX04Sentence:
+		actions.gpsUtcOffset, actions.newGpsUtcOffset = applyPUBX04(s, gpsInfo)
+	case *ModeSentence:
+		gpsInfo.status = s.status
+	case *PulseSentence:
+		actions.deltaP = applyPulse(s, gpsInfo)
+	case *TIMTPSentence:
+		gpsInfo.qErr = s.qErr
+		gpsInfo.qErrPending = s.qErrValid()
+	case *NAVTimeUTCSentence:
+		if !gpsInfo.utcValidKnown || gpsInfo.utcValid != s.utcValid() {
+			timingLog.Info("NAV-TIMEUTC validity", "validUTC", s.utcValid())
 		}
+		gpsInfo.utcValidKnown = true
+		gpsInfo.utcValid = s.utcValid()
+	case *CommandResponseSentence:
+		applyCommandResponse(s, gpsInfo)
+	case *ErrorSentence:
+		applyGFTError(s, gpsInfo)
+	case *NAVClockSentence:
+		gpsInfo.timeAccuracy = s.tAcc
+		parserLog.Debug("NAV-CLOCK", "biasNs", s.clkB, "driftNsPerS", s.clkD, "tAccNs", s.tAcc)
+	}
+	return actions
+}
 
-		// 'payload' removes the leading "{000C97C7 " and the trailing "}". What is left should be standard nmea frame
-		// with leading $ and trailing checksum
-		//payload := parts[1][:len(parts[1])-1]
-		payload := removeTrailingCharacter(parts[1])
+// applyCommandResponse gives a response to the command it answers. [STARTING!] is not a response but
+// the GFT (re)starting, after which the commands waiting for a response will not get one.
+func applyCommandResponse(s *CommandResponseSentence, gpsInfo *GPSdata) {
+	if !s.isStart() {
+		routeCommandResponse(s.text, gpsInfo.hostTime)
+		return
+	}
+	text := "GFT restarted"
+	if gpsInfo.gftStarts == 0 {
+		text = "GFT started"
+	}
+	raiseAlert(gftRestartSeverity(gpsInfo.gftStarts == 0, myWin.captureActive), text, gpsInfo.hostTime,
+		gpsInfo.unixTime)
+	gpsInfo.gftStarts++
+	commandTracker.reset()
+}
 
-		if !isChecksumValid(payload) {
-			return ans, errors.New("parseSentence() found bad checksum in " + payload)
-		}
+// applyGFTError gives an error that answers a command to that command, if one is waiting for its
+// response. Any other error is an alert.
+func applyGFTError(s *ErrorSentence, gpsInfo *GPSdata) {
+	if isCommandError(s.text) && routeCommandResponse(s.text, gpsInfo.hostTime) {
+		return
+	}
+	raiseAlert(gftErrorSeverity(myWin.captureActive), s.text, gpsInfo.hostTime, gpsInfo.unixTime)
+}
 
-		parts = strings.Split(payload, ",")
-		nmeaName := parts[0]
-		switch nmeaName {
-		case "$GPGGA":
-			gpsInfo.altitude = parts[9]
-			gpsInfo.altitudeUnits = parts[10]
-			return []string{"$GPGGA", sentence}, nil
-		case "$GPRMC":
-			if parts[2] != "A" { // GPRMC data is valid only if this field contains an 'A'
-				gpsInfo.date = ""
-				return []string{"$GPRMC", sentence}, nil
-			} else {
-				log.Println("")
-				log.Println(sentence)
-				gpsInfo.timeUTC = parts[1]
-				gpsInfo.latitude = parts[3]
-				gpsInfo.latDirection = parts[4]
-				gpsInfo.longitude = parts[5]
-				gpsInfo.lonDirection = parts[6]
-				gpsInfo.date = parts[9]
-
-				gpsInfo.hour, _ = strconv.Atoi(gpsInfo.timeUTC[0:2])
-				gpsInfo.minute, _ = strconv.Atoi(gpsInfo.timeUTC[2:4])
-				gpsInfo.second, _ = strconv.Atoi(gpsInfo.timeUTC[4:6])
-				gpsInfo.year, _ = strconv.Atoi(gpsInfo.date[4:6])
-				gpsInfo.year += 2000
-				gpsInfo.month, _ = strconv.Atoi(gpsInfo.date[2:4])
-				gpsInfo.day, _ = strconv.Atoi(gpsInfo.date[0:2])
-				unixTime := time.Date(gpsInfo.year, time.Month(gpsInfo.month), gpsInfo.day,
-					gpsInfo.hour, gpsInfo.minute, gpsInfo.second, 0, time.UTC).Unix()
-				if gpsInfo.unixTime == 0 {
-					gpsInfo.nextUnixTime = unixTime + 1
-					if myWin.App.Preferences().BoolWithFallback("ArmUTCstartTime", false) {
-						gpsInfo.unixTime = gpsInfo.nextUnixTime
-						armUTCstart()
-					}
-				}
-				gpsInfo.unixTime = unixTime + 1
-			}
-			return []string{"$GPRMC", sentence}, nil
-		case "$GPDTM":
-			return []string{"$GPDTM", sentence}, nil
-		case "$PUBX":
-			if strings.Contains(parts[6], "D") {
-				gpsInfo.gpsUtcOffset = parts[6]
-				offsetMsg := fmt.Sprintf("GpsUtcOffset: %s", getGpsUtcOffset())
-				myWin.gpsUtcOffsetInUse.Text = offsetMsg
-				myWin.gpsUtcOffsetInUse.Color = color.NRGBA{R: 180, A: 255}
-				myWin.gpsUtcOffsetInUse.Refresh()
-			} else {
-				if isLeapSecondAdjustmentNew(parts[6]) {
-					msg := fmt.Sprintf("\n\n\n\n\n\n\n\n\n\n\t\t!!!!! There is a NEW GpsUtcOffset of: %s  !!!!", parts[6])
-					showMsg("GpsUtcOffset change", msg, 500, 600)
-					log.Printf(fmt.Sprintf("!!!!! There is a NEW GpsUtcOffset of: %s  !!!!", parts[6]))
-					myWin.App.Preferences().SetString("gpsUtcOffset", parts[6])
-				}
-				gpsInfo.gpsUtcOffset = parts[6]
-				offsetMsg := fmt.Sprintf("GpsUtcOffset: %s", gpsInfo.gpsUtcOffset)
-				myWin.gpsUtcOffsetInUse.Text = offsetMsg
-				myWin.gpsUtcOffsetInUse.Color = color.NRGBA{G: 180, A: 255}
-				myWin.gpsUtcOffsetInUse.Refresh()
-			}
+// pendingQErr is the quantization error (ps) of the 1pps about to be received, 0 if not known
+func (g *GPSdata) pendingQErr() int32 {
+	if !g.qErrPending {
+		return 0
+	}
+	return g.qErr
+}
 
-			//gpsInfo.timeUTC = parts[2]
-			//gpsInfo.hour, _ = strconv.Atoi(gpsInfo.timeUTC[0:2])
-			//gpsInfo.minute, _ = strconv.Atoi(gpsInfo.timeUTC[2:4])
-			//gpsInfo.second, _ = strconv.Atoi(gpsInfo.timeUTC[4:6])
-			//gpsInfo.date = parts[3]
-			//gpsInfo.year, _ = strconv.Atoi(gpsInfo.date[4:6])
-			//gpsInfo.year += 2000
-			//gpsInfo.month, _ = strconv.Atoi(gpsInfo.date[2:4])
-			//gpsInfo.day, _ = strconv.Atoi(gpsInfo.date[0:2])
-			//
-			//unixTime := time.Date(gpsInfo.year, time.Month(gpsInfo.month), gpsInfo.day,
-			//	gpsInfo.hour, gpsInfo.minute, gpsInfo.second, 0, time.UTC).Unix()
-			//if gpsInfo.unixTime == 0 {
-			//	gpsInfo.nextUnixTime = unixTime + 1
-			//	if myWin.App.Preferences().BoolWithFallback("ArmUTCstartTime", false) {
-			//		gpsInfo.unixTime = gpsInfo.nextUnixTime
-			//		armUTCstart()
-			//	}
-			//}
-			//gpsInfo.unixTime = unixTime + 1
-			//
-			if gpsInfo.date != "" {
-				calcUtcTimeFromGpsTime(gpsInfo, sentence)
-			}
-			return []string{"$PUBX", sentence}, nil
-		default:
-			errMsg := fmt.Sprintf("parseSentence(): no decoder enabled for %s", payload)
-			log.Println(errMsg)
-			return ans, errors.New(errMsg)
-		}
+// offsetWithUTCValidity marks a GpsUtcOffset reported by a PUBX04 as the receiver's default (D) or as
+// confirmed by the almanac according to the validUTC flag of NAV-TIMEUTC, when the receiver sends it
+func offsetWithUTCValidity(reported string, gpsInfo *GPSdata) string {
+	if !gpsInfo.utcValidKnown || reported == "" {
+		return reported
 	}
+	offset := strings.TrimSuffix(reported, "D")
+	if gpsInfo.utcValid {
+		return offset
+	}
+	return offset + "D"
+}
 
-	if strings.Contains(sentence, "MODE") { // process mode sentence
-		parts := strings.Split(sentence, " ")
-		if len(parts) < 2 {
-			return ans, errors.New("parseSentence(): split of MODE sentence on space did not give 2 parts")
-		}
-		gpsInfo.status = sentence[6 : len(sentence)-1]
-		ans = []string{"MODE", sentence}
-		return ans, nil
-	}
-
-	pSentence := strings.Contains(sentence, "P}") ||
-		strings.Contains(sentence, "E}") ||
-		strings.Contains(sentence, "+}") ||
-		strings.Contains(sentence, "!}")
-
-	if pSentence {
-		tickPulse := strings.Contains(sentence, "P}")
-		pType := "P"
-		parts := strings.Split(sentence, " ")
-		if len(parts) < 2 {
-			return ans, errors.New("parseSentence(): split of P sentence on space did not give 2 parts")
-		}
+// hasFix tells whether the receiver has a fix, from the status of GPRMC or the fix type of GSA
+func (g *GPSdata) hasFix() bool {
+	return g.rmcValid || g.fixType >= fix2D
+}
 
-		// We want to return the P count, not as a hex string, but as an integer string, so we convert it here.
-		hexStr := parts[0][1:]
-		value, err := strconv.ParseInt(hexStr, 16, 64)
-		if err != nil {
-			return ans, errors.New("parseSentence(): hex conversion of P sentence value failed")
-		}
+// applyRMC takes the position and time of an RMC sentence. It returns whether a recording is to be armed.
+func applyRMC(s *RMCSentence, gpsInfo *GPSdata) bool {
+	gpsInfo.rmcValid = s.valid
+	if !s.valid {
+		gpsInfo.date = ""
+		return false
+	}
+	parserLog.Debug("RMC", "sentence", s.text)
+	gpsInfo.latitude = s.latitude
+	gpsInfo.latDirection = s.latDirection
+	gpsInfo.longitude = s.longitude
+	gpsInfo.lonDirection = s.lonDirection
+	return applyTimeOfDay(s.timeOfDay, gpsInfo)
+}
 
-		// Extract the micro tick time of the current pulse
-		if myWin.gotFirst1PPS { // We're past the initial P sentence
-			if value > myWin.lastPvalue {
-				deltaP = value - myWin.lastPvalue
-			} else {
-				deltaP = 0xffffffff - myWin.lastPvalue + value + 1
-			}
-			myWin.lastPvalue = value
+// applyTimeOfDay takes the time of an RMC or ZDA sentence. A receiver that sends both gives the same time
+// in each, so applying it twice does no harm. It returns true when this is the first time of the session
+// and the ArmUTCstartTime preference asks for the recording to be armed.
+func applyTimeOfDay(t timeOfDay, gpsInfo *GPSdata) bool {
+	armRecording := false
+	gpsInfo.timeUTC = t.timeUTC
+	gpsInfo.date = t.date
+	gpsInfo.hour = t.hour
+	gpsInfo.minute = t.minute
+	gpsInfo.second = t.second
+	gpsInfo.year = t.year
+	gpsInfo.month = t.month
+	gpsInfo.day = t.day
+	if gpsInfo.unixTime == 0 {
+		gpsInfo.nextUnixTime = t.unixTime + 1
+		if myWin.pendingJournal != nil {
+			gpsInfo.unixTime = gpsInfo.nextUnixTime
+			resumeFromJournal(myWin.pendingJournal, gpsInfo.unixTime)
+			myWin.pendingJournal = nil
+		} else if myWin.App.Preferences().BoolWithFallback("ArmUTCstartTime", false) {
+			armRecording = true
+		}
+	}
+	gpsInfo.unixTime = t.unixTime + 1
+	return armRecording
+}
 
-			onePPSdata.runningTickTime += deltaP
-			onePPSdata.pDelta = append(onePPSdata.pDelta, deltaP)
+// saveGpsUtcOffset remembers a new leap second for later sessions. The fuzz test replaces it, as its
+// workers share the preferences.
+var saveGpsUtcOffset = func(offset string) {
+	myWin.App.Preferences().SetString("gpsUtcOffset", offset)
+}
 
-			log.Printf("%s  cumulative tick count: %9d  deltaP: %d",
-				sentence, onePPSdata.runningTickTime, deltaP) // process P sentence
+// applyPUBX04 takes the GpsUtcOffset of a PUBX04 sentence. It returns the offset with its validity, and
+// whether it is a new almanac offset.
+func applyPUBX04(s *PUBX04Sentence, gpsInfo *GPSdata) (string, bool) {
+	offset := offsetWithUTCValidity(s.gpsUtcOffset, gpsInfo)
+	newOffset := false
+	if !strings.Contains(offset, "D") && isLeapSecondAdjustmentNew(offset) {
+		newOffset = true
+		timingLog.Warn("new GpsUtcOffset", "gpsUtcOffset", offset)
+		saveGpsUtcOffset(offset)
+	}
+	gpsInfo.gpsUtcOffset = offset
+	noteGpsUtcOffset(&onePPSdata, offset, gpsInfo.unixTime)
+	if gpsInfo.date != "" {
+		calcUtcTimeFromGpsTime(gpsInfo, s.text)
+	}
+	return offset, newOffset
+}
 
-			if tickPulse {
-				//log.Println("tickPulseUtc: ", gpsInfo.utcTimestamp) // TODO Consider leaving this in
-				//log.Println("tickPulseGps: ", gpsInfo.gpsTimestamp) // TODO Consider leaving this in
-				newTickStamp := TickStamp{
-					utcTimestamp:    gpsInfo.utcTimestamp,
-					gpsTimestamp:    gpsInfo.gpsTimestamp,
-					runningTickTime: onePPSdata.runningTickTime,
-					tickTime:        0,
-				}
-				onePPSdata.tickStamp = append(onePPSdata.tickStamp, newTickStamp)
-			}
+// applyPulse adds a pulse sentence to the 1pps history or the flash edges. It returns the ticks since
+// the previous pulse sentence.
+func applyPulse(s *PulseSentence, gpsInfo *GPSdata) int64 {
+	tickPulse := s.kind == pulsePPS
+	var deltaP int64
 
-		} else { // This is the first P sentence received - initialize onePPSdata structure
-			// It is possible at startup that 1pps occurs before the nmea sentence with time info.
-			// We just skip that one.
-			if gpsInfo.utcTimestamp != "" {
-				myWin.gotFirst1PPS = true
-				onePPSdata.startTime = gpsInfo.utcTimestamp
-				deltaP = 0
-				onePPSdata.pDelta = append(onePPSdata.pDelta, deltaP)
-				onePPSdata.runningTickTime = value
-				myWin.lastPvalue = value
-				if tickPulse {
-					newTickStamp := TickStamp{
-						utcTimestamp:    gpsInfo.utcTimestamp,
-						gpsTimestamp:    gpsInfo.gpsTimestamp,
-						runningTickTime: onePPSdata.runningTickTime,
-						tickTime:        0,
-					}
-					onePPSdata.tickStamp = append(onePPSdata.tickStamp, newTickStamp)
-				}
-			}
+	// Extract the micro tick time of the current pulse
+	if myWin.gotFirst1PPS { // We're past the initial P sentence
+		if s.tickCount > myWin.lastPvalue {
+			deltaP = s.tickCount - myWin.lastPvalue
+		} else {
+			deltaP = 0xffffffff - myWin.lastPvalue + s.tickCount + 1
 		}
+		myWin.lastPvalue = s.tickCount
 
-		// The position of this code is important - it must follow the extraction of micro tick
-		// time from a P sentence so that onePPSdata.runningTickTime has been updated
-		if strings.Contains(sentence, "+}") { // process flashOn sentence
-			//fmt.Printf("Flash on  @ %s  %s\n", sentence, gpsInfo.utcTimestamp)
-			pType = "+"
-			if myWin.pastLeader {
-				flashEdges = append(flashEdges, FlashEdge{
-					edgeTime: onePPSdata.runningTickTime,
-					on:       true,
-				})
-			}
+		onePPSdata.runningTickTime += deltaP
+		onePPSdata.pDelta = append(onePPSdata.pDelta, deltaP)
+
+		parserLog.Info("P", "sentence", s.text, "cumulativeTickCount", onePPSdata.runningTickTime,
+			"deltaP", deltaP) // process P sentence
+
+		if tickPulse {
+			onePPSdata.tickStamp = append(onePPSdata.tickStamp, newTickStamp(gpsInfo))
 		}
 
-		// The position of this code is important - it must follow the extraction of micro tick
-		// time from a P sentence so that onePPSdata.runningTickTime has been updated
-		if strings.Contains(sentence, "!}") { // process flashOff sentence
-			//fmt.Printf("Flash off @ %s  %s\n", sentence, gpsInfo.utcTimestamp)
-			pType = "+"
-			if myWin.pastLeader {
-				flashEdges = append(flashEdges, FlashEdge{
-					edgeTime: onePPSdata.runningTickTime,
-					on:       false,
-				})
+	} else { // This is the first P sentence received - initialize onePPSdata structure
+		// It is possible at startup that 1pps occurs before the nmea sentence with time info.
+		// We just skip that one.
+		if gpsInfo.utcTimestamp != "" {
+			myWin.gotFirst1PPS = true
+			onePPSdata.startTime = gpsInfo.utcTimestamp
+			onePPSdata.startEpoch = currentOffsetEpoch(&onePPSdata)
+			onePPSdata.pDelta = append(onePPSdata.pDelta, deltaP)
+			onePPSdata.runningTickTime = s.tickCount
+			myWin.lastPvalue = s.tickCount
+			continueResumedHistory(&onePPSdata, *gpsInfo)
+			if tickPulse {
+				onePPSdata.tickStamp = append(onePPSdata.tickStamp, newTickStamp(gpsInfo))
 			}
 		}
-		if strings.Contains(sentence, "E}") {
-			pType = "E"
-		}
-		ans = []string{pType, fmt.Sprintf("%s (deltaP is %d)", sentence, deltaP)}
-		return ans, nil
+	}
+	if tickPulse {
+		gpsInfo.qErrPending = false // a TIM-TP describes only the 1pps that follows it
 	}
 
-	// We reach this point if the sentence type is not one we need to process
-	// That includes {ERROR ...}  [CMD ...] and [ ... ] (which are command responses
+	// The position of this code is important - it must follow the extraction of micro tick
+	// time from a P sentence so that onePPSdata.runningTickTime has been updated
+	if (s.kind == pulseFlashOn || s.kind == pulseFlashOff) && myWin.pastLeader {
+		flashEdges = append(flashEdges, FlashEdge{
+			edgeTime: onePPSdata.runningTickTime,
+			on:       s.kind == pulseFlashOn,
+		})
+	}
+	return deltaP
+}
 
-	return []string{"other", sentence}, nil
+func newTickStamp(gpsInfo *GPSdata) TickStamp {
+	return TickStamp{
+		utcTimestamp:    gpsInfo.utcTimestamp,
+		gpsTimestamp:    gpsInfo.gpsTimestamp,
+		runningTickTime: onePPSdata.runningTickTime,
+		tickTime:        0,
+		offsetEpoch:     currentOffsetEpoch(&onePPSdata),
+		hostTime:        gpsInfo.hostTime,
+		qErr:            gpsInfo.pendingQErr(),
+	}
 }
 
 func isLeapSecondAdjustmentNew(reportedGpsUtcOffset string) bool {
@@ -278,6 +298,9 @@ func isLeapSecondAdjustmentNew(reportedGpsUtcOffset string) bool {
 }
 
 func convertTimestampToTimeObject(ts string) (time.Time, error) {
+	if len(ts) < len("2006-01-02T15:04:05") {
+		return time.Time{}, fmt.Errorf("convertTimestampToTimeObject(): %q is too short", ts)
+	}
 	location, _ := time.LoadLocation("") // specify UTC
 	year, err := strconv.Atoi(ts[0 : 3+1])
 	if err != nil {
@@ -338,7 +361,7 @@ func calcAdderToTimestamp(ts string, addedTime float64) string {
 	if err != nil {
 		panic(err)
 	}
-	microsecondsToAdd := time.Duration(addedTime*1_000_000+0.5) * time.Microsecond
+	microsecondsToAdd := time.Duration(math.Round(addedTime*1_000_000)) * time.Microsecond
 	augmentedTime := tsTimeObject.Add(microsecondsToAdd)
 	return convertTimeObjectToTimestamp(augmentedTime)
 }
@@ -389,10 +412,8 @@ func calcUtcTimeFromGpsTime(g *GPSdata, sentence string) {
 	g.gpsTimestamp = fmt.Sprintf("%4d-%02d-%02dT%02d:%02d:%02d.000000",
 		gpsTime.Year(), gpsTime.Month(), gpsTime.Day(), gpsTime.Hour(), gpsTime.Minute(), gpsTime.Second())
 
-	log.Println(sentence)
-	log.Println("PUBX04 gpsUtcOffset: ", g.gpsUtcOffset)
-	log.Println("gpsTimestamp:: ", g.gpsTimestamp)
-	log.Println("utcTimestamp:: ", g.utcTimestamp)
+	parserLog.Debug("PUBX04", "sentence", sentence, "gpsUtcOffset", g.gpsUtcOffset,
+		"gpsTimestamp", g.gpsTimestamp, "utcTimestamp", g.utcTimestamp)
 
 }
 
@@ -400,7 +421,7 @@ func isChecksumValid(frameAsString string) bool {
 	frame := []byte(frameAsString)
 
 	start, end := bytes.IndexByte(frame, '$'), bytes.LastIndexByte(frame, '*')
-	if start == -1 || end == -1 || end+3 > len(frame) {
+	if start == -1 || end < start || end+3 > len(frame) {
 		return false
 	}
 
@@ -416,5 +437,8 @@ func isChecksumValid(frameAsString string) bool {
 }
 
 func removeTrailingCharacter(part string) string {
+	if part == "" {
+		return ""
+	}
 	return part[:len(part)-1]
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+)
+
+// recordPPSGap is called on the first 1pps received after lostPulses pulses went missing
+func recordPPSGap(data *OnePPSdata, gpsInfo GPSdata, lostPulses int64) {
+	data.gaps = append(data.gaps, PPSGap{
+		unixTime:        gpsInfo.unixTime,
+		lostPulses:      lostPulses,
+		utcTimestamp:    gpsInfo.utcTimestamp,
+		runningTickTime: data.runningTickTime,
+	})
+}
+
+// bracketHasGap reports whether a recorded gap of lost 1pps pulses lies between the left and right tick
+// stamps. The length of the bracket is not used: the 1pps jitters.
+func bracketHasGap(gaps []PPSGap, left, right TickStamp) bool {
+	for _, gap := range gaps {
+		if gap.runningTickTime > left.runningTickTime && gap.runningTickTime <= right.runningTickTime {
+			return true
+		}
+	}
+	return false
+}
+
+// gapLines describes every lost pulse gap for the flash edge file
+func gapLines(gaps []PPSGap) []string {
+	var lines []string
+	for _, gap := range gaps {
+		lines = append(lines, fmt.Sprintf("# lost 1pps: %d pulse(s) before %sZ (unixTime %d)",
+			gap.lostPulses, gap.utcTimestamp, gap.unixTime))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "# lost 1pps: none")
+	}
+	return lines
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_bracketHasGap(t *testing.T) {
+	stamps := []TickStamp{
+		{utcTimestamp: "2024-03-01T10:00:00.000000", runningTickTime: 1000},
+		{utcTimestamp: "2024-03-01T10:00:01.000000", runningTickTime: 2000},
+		{utcTimestamp: "2024-03-01T10:00:03.000000", runningTickTime: 4000},
+	}
+	gaps := []PPSGap{{unixTime: 1709287203, lostPulses: 1, utcTimestamp: stamps[2].utcTimestamp, runningTickTime: 4000}}
+
+	assert.False(t, bracketHasGap(gaps, stamps[0], stamps[1]))
+	assert.True(t, bracketHasGap(gaps, stamps[1], stamps[2]))
+
+	// Only a recorded gap is flagged, however long the bracket
+	assert.False(t, bracketHasGap(nil, stamps[1], stamps[2]))
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 1pps history is archived in segments of this many tick stamps (one hour)
+const ppsSegmentLength = 3600
+
+const defaultPpsRetentionHours = 6
+
+// Tick stamps from this many seconds before the leader start are kept for the whole recording window
+const ppsProtectionMargin = 60
+
+const ppsArchiveDir = "ppsArchive"
+
+// ppsRetentionHours caches the PpsRetentionHours preference (0 until it is first read) because the 1pps
+// history is trimmed on every 1pps
+var ppsRetentionHours int
+
+func ppsRetentionSeconds() int {
+	if ppsRetentionHours == 0 {
+		ppsRetentionHours = myWin.App.Preferences().IntWithFallback("PpsRetentionHours", defaultPpsRetentionHours)
+	}
+	return ppsRetentionHours * 3600
+}
+
+// ppsKeepFrom returns the unix time from which tick stamps must not be trimmed because they may be needed
+// to time the flash edges of the armed recording.
+func ppsKeepFrom() int64 {
+	if myWin.utcStartArmed {
+		return myWin.leaderStartTime - ppsProtectionMargin
+	}
+	return math.MaxInt64
+}
+
+// trimPPSHistory moves the oldest segments of the 1pps history to files in archiveDir once more than
+// retention (plus one segment) tick stamps are held. Tick stamps at or after keepFrom (a unix time)
+// are never removed. Tick stamps without a UTC timestamp are passed over when the segment is dated; a
+// segment with none is only archived when nothing is to be kept.
+func trimPPSHistory(data *OnePPSdata, retention int, keepFrom int64, archiveDir string) error {
+	for len(data.tickStamp) > retention+ppsSegmentLength {
+		segment := data.tickStamp[:ppsSegmentLength]
+		_, last, found := segmentTimestamps(segment)
+		if !found && keepFrom != math.MaxInt64 {
+			return nil
+		}
+		if found {
+			lastTime, err := convertTimestampToTimeObject(last)
+			if err != nil {
+				return fmt.Errorf("trimPPSHistory(): %w", err)
+			}
+			if lastTime.Unix() >= keepFrom {
+				return nil
+			}
+		}
+
+		firstKept := data.tickStamp[ppsSegmentLength].runningTickTime
+		var segmentGaps, keptGaps []PPSGap
+		for _, gap := range data.gaps {
+			if gap.runningTickTime < firstKept {
+				segmentGaps = append(segmentGaps, gap)
+			} else {
+				keptGaps = append(keptGaps, gap)
+			}
+		}
+
+		err := archivePPSSegment(segment, segmentGaps, archiveDir)
+		if err != nil {
+			return err
+		}
+
+		// Copy what is kept so that the memory of the archived segment can be released
+		data.tickStamp = append([]TickStamp(nil), data.tickStamp[ppsSegmentLength:]...)
+		data.gaps = keptGaps
+	}
+
+	// pDelta is only accumulated for diagnostics, so we simply drop its oldest entries
+	if excess := len(data.pDelta) - retention; excess > ppsSegmentLength {
+		data.pDelta = append([]int64(nil), data.pDelta[excess:]...)
+	}
+	return nil
+}
+
+// segmentTimestamps returns the first and last full UTC timestamps of the tick stamps in segment
+func segmentTimestamps(segment []TickStamp) (first, last string, found bool) {
+	for _, ts := range segment {
+		if len(ts.utcTimestamp) >= len("2006-01-02T15:04:05") {
+			if !found {
+				first = ts.utcTimestamp
+			}
+			last, found = ts.utcTimestamp, true
+		}
+	}
+	return first, last, found
+}
+
+func archivePPSSegment(segment []TickStamp, gaps []PPSGap, archiveDir string) error {
+	err := os.MkdirAll(archiveDir, 0755)
+	if err != nil {
+		return fmt.Errorf("archivePPSSegment(): %w", err)
+	}
+
+	// The file is named by its first UTC timestamp, or by its first tick time if it has none
+	first, last, found := segmentTimestamps(segment)
+	name := fmt.Sprintf("pps_tick_%d.txt", segment[0].runningTickTime)
+	if found {
+		name = "pps_" + strings.NewReplacer("-", "", ":", "", "T", "_").Replace(first[:19]) + ".txt"
+	}
+	path := filepath.Join(archiveDir, name)
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# IotaGFTapp %s 1pps history from %sZ to %sZ\n", Version, first, last))
+	sb.WriteString(strings.Join(gapLines(gaps), "\n") + "\n")
+	sb.WriteString("# utcTimestamp runningTickTime offsetEpoch\n")
+	for _, ts := range segment {
+		sb.WriteString(fmt.Sprintf("%s %d %d\n", ts.utcTimestamp, ts.runningTickTime, ts.offsetEpoch))
+	}
+
+	err = os.WriteFile(path, []byte(sb.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("archivePPSSegment(): %w", err)
+	}
+	timingLog.Info("1pps tick stamps archived", "count", len(segment), "path", path)
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func makeTickStamps(n int) []TickStamp {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	stamps := make([]TickStamp, n)
+	for i := range stamps {
+		stamps[i] = TickStamp{
+			utcTimestamp:    convertTimeObjectToTimestamp(start.Add(time.Duration(i) * time.Second)),
+			runningTickTime: int64(i) * 1_000_000,
+		}
+	}
+	return stamps
+}
+
+func Test_trimPPSHistory(t *testing.T) {
+	archiveDir := t.TempDir()
+	data := OnePPSdata{
+		tickStamp: makeTickStamps(2*ppsSegmentLength + 100),
+		gaps:      []PPSGap{{runningTickTime: 5_000_000, lostPulses: 1}},
+	}
+	err := trimPPSHistory(&data, 100, math.MaxInt64, archiveDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 100+ppsSegmentLength, len(data.tickStamp))
+	assert.Equal(t, int64(ppsSegmentLength)*1_000_000, data.tickStamp[0].runningTickTime)
+	assert.Equal(t, 0, len(data.gaps))
+
+	files, _ := os.ReadDir(archiveDir)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, "pps_20240301_000000.txt", files[0].Name())
+}
+
+func Test_trimPPSHistoryKeepsRecordingWindow(t *testing.T) {
+	data := OnePPSdata{tickStamp: makeTickStamps(2*ppsSegmentLength + 100)}
+	keepFrom := time.Date(2024, 3, 1, 0, 30, 0, 0, time.UTC).Unix() // inside the first segment
+	err := trimPPSHistory(&data, 100, keepFrom, t.TempDir())
+	assert.Nil(t, err)
+	assert.Equal(t, 2*ppsSegmentLength+100, len(data.tickStamp))
+}
+
+func Test_trimPPSHistoryWithoutTimestamps(t *testing.T) {
+	archiveDir := t.TempDir()
+	data := OnePPSdata{tickStamp: makeTickStamps(2*ppsSegmentLength + 100)}
+	data.tickStamp[0].utcTimestamp = "" // 1pps before the first RMC
+	data.tickStamp[ppsSegmentLength-1].utcTimestamp = ""
+	err := trimPPSHistory(&data, 100, math.MaxInt64, archiveDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 100+ppsSegmentLength, len(data.tickStamp))
+	files, _ := os.ReadDir(archiveDir)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, "pps_20240301_000001.txt", files[0].Name())
+
+	// A segment with no timestamps at all cannot be dated against the recording window
+	data = OnePPSdata{tickStamp: make([]TickStamp, 2*ppsSegmentLength+100)}
+	err = trimPPSHistory(&data, 100, time.Date(2024, 3, 1, 0, 30, 0, 0, time.UTC).Unix(), archiveDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2*ppsSegmentLength+100, len(data.tickStamp))
+
+	err = trimPPSHistory(&data, 100, math.MaxInt64, archiveDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 100+ppsSegmentLength, len(data.tickStamp))
+	_, err = os.Stat(filepath.Join(archiveDir, "pps_tick_0.txt"))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const regeneratedFlashEdgeTimesFile = "FLASH_EDGE_TIMES_regenerated.txt"
+
+// Models for timing a flash edge from the 1pps history
+const (
+	edgeModelBracket = "bracket" // straight line between the tick stamps either side of the edge (as done live)
+	edgeModelFit     = "fit"     // least squares line through the tick stamps around the edge
+)
+
+// The fit model uses up to this many tick stamps on each side of an edge
+const fitHalfWindow = 30
+
+type RegenerateOptions struct {
+	model        string
+	gpsUtcOffset int       // GpsUtcOffset to correct GPRMC times to (0: the almanac value reported in the log, else the leap second table)
+	from, to     time.Time // only flash edges in this UTC window are timed (zero: no limit)
+}
+
+// A sentenceReplay rebuilds the 1pps history and the flash edges from the sentences of an IotaGFT_LOG,
+// in the same way that parseSentence builds them live
+type sentenceReplay struct {
+	opts         RegenerateOptions
+	leapTable    []LeapSecondEntry
+	data         OnePPSdata
+	edges        []FlashEdge
+	rmcTime      time.Time // time of the last valid GPRMC (or ZDA)
+	fix          bool      // the receiver has a fix: the last GPRMC had status A or the last GSA a 2D or 3D fix
+	reported     string    // last GpsUtcOffset reported by PUBX,04
+	utcTimestamp string
+	gpsTimestamp string
+	gotFirst1PPS bool
+	lastPvalue   int64
+	lastTickUTC  time.Time
+	nests        NestSplitter
+	sentences    int
+	badSentences int
+}
+
+// feed takes one line of the log. Sentences interrupted by a nested sentence are rejoined as runApp does.
+func (r *sentenceReplay) feed(line string) {
+	for _, sentence := range r.nests.feed(ReceivedSentence{text: stripHostTimeColumn(line)}) {
+		r.process(sentence.text)
+	}
+}
+
+func (r *sentenceReplay) process(line string) {
+	n := len(line)
+	if n < 4 || !strings.HasPrefix(line, "{") {
+		return // log file comments and non-sentence lines
+	}
+	r.sentences++
+	sentence := line[:n-3]
+	if chkSum, _ := calcChecksum(sentence); chkSum != line[n-3:] {
+		r.badSentences++
+		return
+	}
+	if parts := strings.Split(sentence, "[]"); len(parts) == 3 {
+		sentence = parts[0] + parts[2] // embedded command response
+	}
+
+	if strings.Contains(sentence, "$") {
+		r.processNMEA(line)
+		return
+	}
+
+	tickPulse := strings.Contains(sentence, "P}")
+	flashOn := strings.Contains(sentence, "+}")
+	flashOff := strings.Contains(sentence, "!}")
+	if !tickPulse && !flashOn && !flashOff && !strings.Contains(sentence, "E}") {
+		return
+	}
+	fields := strings.Split(sentence, " ")
+	value, err := strconv.ParseInt(fields[0][1:], 16, 64)
+	if err != nil {
+		r.badSentences++
+		return
+	}
+
+	if r.gotFirst1PPS {
+		var deltaP int64
+		if value > r.lastPvalue {
+			deltaP = value - r.lastPvalue
+		} else {
+			deltaP = 0xffffffff - r.lastPvalue + value + 1
+		}
+		r.lastPvalue = value
+		r.data.runningTickTime += deltaP
+	} else {
+		if r.utcTimestamp == "" {
+			return // 1pps before the first time information
+		}
+		r.gotFirst1PPS = true
+		r.data.startTime = r.utcTimestamp
+		r.data.startEpoch = currentOffsetEpoch(&r.data)
+		r.data.runningTickTime = value
+		r.lastPvalue = value
+	}
+
+	if tickPulse && r.utcTimestamp != "" {
+		utc, _ := time.Parse(timestampLayout, r.utcTimestamp)
+		if !r.lastTickUTC.IsZero() {
+			if lost := int64(utc.Sub(r.lastTickUTC).Seconds()) - 1; lost > 0 {
+				r.data.gaps = append(r.data.gaps, PPSGap{unixTime: utc.Unix(), lostPulses: lost,
+					utcTimestamp: r.utcTimestamp, runningTickTime: r.data.runningTickTime})
+			}
+		}
+		r.lastTickUTC = utc
+		r.data.tickStamp = append(r.data.tickStamp, TickStamp{
+			utcTimestamp:    r.utcTimestamp,
+			gpsTimestamp:    r.gpsTimestamp,
+			runningTickTime: r.data.runningTickTime,
+			offsetEpoch:     currentOffsetEpoch(&r.data),
+		})
+	}
+
+	if (flashOn || flashOff) && r.inWindow() {
+		r.edges = append(r.edges, FlashEdge{edgeTime: r.data.runningTickTime, on: flashOn})
+	}
+}
+
+func (r *sentenceReplay) inWindow() bool {
+	if r.lastTickUTC.IsZero() {
+		return r.opts.from.IsZero()
+	}
+	return (r.opts.from.IsZero() || !r.lastTickUTC.Before(r.opts.from)) &&
+		(r.opts.to.IsZero() || !r.lastTickUTC.After(r.opts.to))
+}
+
+// processNMEA takes the time and GpsUtcOffset from an NMEA sentence, decoded by decodeSentence as live
+func (r *sentenceReplay) processNMEA(line string) {
+	n := len(line)
+	s, err := decodeSentence(line[:n-3], line[n-3:])
+	if errors.Is(err, errNoDecoder) {
+		return
+	}
+	if err != nil {
+		r.badSentences++
+		return
+	}
+	switch s := s.(type) {
+	case *ZDASentence:
+		// ZDA sent from the receiver's clock before it has a fix is not used, as live
+		if s.valid && r.fix {
+			r.rmcTime = time.Unix(s.unixTime, 0).UTC()
+		}
+	case *GSASentence:
+		r.fix = s.fixType >= fix2D
+	case *RMCSentence:
+		r.fix = s.valid
+		if s.valid {
+			r.rmcTime = time.Unix(s.unixTime, 0).UTC()
+		}
+	case *PUBX04Sentence:
+		if r.rmcTime.IsZero() {
+			return
+		}
+		reported, err := parseGpsUtcOffset(s.gpsUtcOffset)
+		if err != nil {
+			return
+		}
+		correct := r.correctOffset()
+		if s.gpsUtcOffset != r.reported {
+			source := offsetSourceAlmanac
+			if strings.Contains(s.gpsUtcOffset, "D") {
+				source = offsetSourceDefault
+			}
+			r.data.offsetEpochs = append(r.data.offsetEpochs, OffsetEpoch{firstUnixTime: r.rmcTime.Unix(),
+				reported: s.gpsUtcOffset, source: source, appliedOffset: correct, rebased: reported != correct})
+			r.reported = s.gpsUtcOffset
+		}
+		r.utcTimestamp = convertTimeObjectToTimestamp(r.rmcTime.Add(time.Duration(reported-correct) * time.Second))
+		r.gpsTimestamp = convertTimeObjectToTimestamp(r.rmcTime.Add(time.Duration(reported) * time.Second))
+	}
+}
+
+func (r *sentenceReplay) correctOffset() int {
+	if r.opts.gpsUtcOffset != 0 {
+		return r.opts.gpsUtcOffset
+	}
+	return leapSecondOffsetAt(r.leapTable, r.rmcTime)
+}
+
+// almanacGpsUtcOffset returns the first GpsUtcOffset in the log that the receiver took from the almanac
+func almanacGpsUtcOffset(logPath string) (int, error) {
+	file, err := os.Open(logPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		_, after, found := strings.Cut(scanner.Text(), "$PUBX,04,")
+		if !found {
+			continue
+		}
+		parts := strings.Split(after, ",")
+		if len(parts) > 4 && parts[4] != "" && !strings.Contains(parts[4], "D") {
+			if offset, err := strconv.Atoi(parts[4]); err == nil {
+				return offset, nil
+			}
+		}
+	}
+	return 0, scanner.Err()
+}
+
+// replaySentenceLog rebuilds the 1pps history and the flash edges from the log at logPath
+func replaySentenceLog(logPath string, opts RegenerateOptions, leapTable []LeapSecondEntry) (*sentenceReplay, error) {
+	if opts.gpsUtcOffset == 0 {
+		// With hindsight, the offset the receiver eventually confirmed is used for the whole log
+		offset, err := almanacGpsUtcOffset(logPath)
+		if err != nil {
+			return nil, fmt.Errorf("replaySentenceLog(): %w", err)
+		}
+		opts.gpsUtcOffset = offset
+	}
+
+	file, err := os.Open(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("replaySentenceLog(): %w", err)
+	}
+	defer file.Close()
+
+	r := &sentenceReplay{opts: opts, leapTable: leapTable}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		r.feed(strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("replaySentenceLog(): %w", err)
+	}
+	return r, nil
+}
+
+// fitEdgeTimestamp times a flash edge from a least squares line of UTC against tick count through the
+// tick stamps around it, which averages out the jitter of individual 1pps readings. Tick stamps on the
+// far side of lost pulses are not used.
+func fitEdgeTimestamp(data *OnePPSdata, edgeTime int64) (string, int, bool) {
+	bracketTimestamp, left, ok := calcEdgeTimestamp(data, edgeTime)
+	if !ok {
+		return "", 0, false
+	}
+	ts := data.tickStamp
+	lo := max(0, left-fitHalfWindow+1)
+	hi := min(len(ts)-1, left+fitHalfWindow)
+	for i := left; i > lo; i-- {
+		if bracketHasGap(data.gaps, ts[i-1], ts[i]) {
+			lo = i
+			break
+		}
+	}
+	for i := left + 1; i < hi; i++ {
+		if bracketHasGap(data.gaps, ts[i], ts[i+1]) {
+			hi = i
+			break
+		}
+	}
+	if hi-lo < 2 {
+		return bracketTimestamp, left, true
+	}
+
+	// Seconds and ticks are taken relative to the left tick stamp, and centered before fitting
+	ref := ts[left]
+	n := float64(hi - lo + 1)
+	var meanX, meanY float64
+	for i := lo; i <= hi; i++ {
+		meanX += float64(ts[i].runningTickTime-ref.runningTickTime) / n
+		meanY += float64(calcDeltaSeconds(ref.utcTimestamp, ts[i].utcTimestamp)) / n
+	}
+	var sxx, sxy float64
+	for i := lo; i <= hi; i++ {
+		dx := float64(ts[i].runningTickTime-ref.runningTickTime) - meanX
+		dy := float64(calcDeltaSeconds(ref.utcTimestamp, ts[i].utcTimestamp)) - meanY
+		sxx += dx * dx
+		sxy += dx * dy
+	}
+	if sxx == 0 {
+		return bracketTimestamp, left, true
+	}
+	slope := sxy / sxx
+	seconds := meanY + slope*(float64(edgeTime-ref.runningTickTime)-meanX)
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return bracketTimestamp, left, true
+	}
+
+	seconds += 1.0 // the same correction for the GPRMC time being 1 second behind as in interpolateTimestamp()
+	return calcAdderToTimestamp(ref.utcTimestamp, seconds), left, true
+}
+
+// regenerateFlashEdgeTimes writes a new flash edge file for the log at logPath to outPath
+func regenerateFlashEdgeTimes(logPath, outPath string, opts RegenerateOptions,
+	leapTable []LeapSecondEntry) (*sentenceReplay, []timedFlashEdge, error) {
+	timer := calcEdgeTimestamp
+	switch opts.model {
+	case edgeModelBracket, "":
+		opts.model = edgeModelBracket
+	case edgeModelFit:
+		timer = fitEdgeTimestamp
+	default:
+		return nil, nil, fmt.Errorf("regenerateFlashEdgeTimes(): unknown model %q", opts.model)
+	}
+
+	replay, err := replaySentenceLog(logPath, opts, leapTable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outputFile, err := os.Create(outPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("regenerateFlashEdgeTimes(): %w", err)
+	}
+	defer outputFile.Close()
+	writer := bufio.NewWriter(outputFile)
+
+	offsetNote := "from the log"
+	if opts.gpsUtcOffset != 0 {
+		offsetNote = strconv.Itoa(opts.gpsUtcOffset) + " (given)"
+	}
+	_, _ = fmt.Fprintf(writer, "# regenerated from %s: model %s, GpsUtcOffset %s, %d sentences (%d bad)\n",
+		logPath, opts.model, offsetNote, replay.sentences, replay.badSentences)
+	timedEdges := writeFlashEdgeTimes(writer, &replay.data, replay.edges, timer)
+	err = writer.Flush()
+	if err != nil {
+		return nil, nil, fmt.Errorf("regenerateFlashEdgeTimes(): %w", err)
+	}
+	return replay, timedEdges, outputFile.Sync()
+}
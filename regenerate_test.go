@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func gftLine(inner string) string {
+	chkSum, _ := calcChecksum(inner)
+	return inner + chkSum
+}
+
+func nmeaLine(counter int64, payload string) string {
+	_, sum := calcChecksum(payload[1:])
+	return gftLine(fmt.Sprintf("{%08X %s*%02X}", counter, payload, sum))
+}
+
+// writeTestSentenceLog writes a log of 20 seconds of GFT output starting at 2024-03-01 00:00:00 UTC with
+// one million ticks per second, a flash from 5.25 s to 7.25 s and the 1pps at 12 s missing. The receiver
+// reports the default GpsUtcOffset 16D for the first 5 seconds (and GPRMC times 2 seconds late).
+func writeTestSentenceLog(t *testing.T, jitter func(second int) int64) string {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	const base = int64(0xFFF00000) // the tick count wraps during the log
+	var lines []string
+	lines = append(lines, "First line of the IotaGFTapp GPS sentence log file")
+	for second := 0; second < 20; second++ {
+		offset, rmcTime := "18", start.Add(time.Duration(second)*time.Second)
+		if second < 5 {
+			offset, rmcTime = "16D", rmcTime.Add(2*time.Second)
+		}
+		counter := (base + int64(second)*1_000_000 + jitter(second)) & 0xFFFFFFFF
+		lines = append(lines,
+			nmeaLine(counter, fmt.Sprintf("$GPRMC,%s.00,A,4000.0000,N,10500.0000,W,0.0,0.0,%s,,,D",
+				rmcTime.Format("150405"), rmcTime.Format("020106"))),
+			nmeaLine(counter, fmt.Sprintf("$PUBX,04,%s.00,%s,0.00,2303,%s,0,0,", rmcTime.Format("150405"),
+				rmcTime.Format("020106"), offset)))
+		if second != 12 {
+			lines = append(lines, gftLine(fmt.Sprintf("{%08X P}", counter)))
+		}
+		edgeCounter := (base + int64(second)*1_000_000 + 250_000) & 0xFFFFFFFF
+		switch second {
+		case 5:
+			lines = append(lines, gftLine(fmt.Sprintf("{%08X +}", edgeCounter)))
+		case 7:
+			lines = append(lines, gftLine(fmt.Sprintf("{%08X !}", edgeCounter)))
+		}
+	}
+	path := filepath.Join(t.TempDir(), sentenceLogFile)
+	assert.Nil(t, os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0644))
+	return path
+}
+
+func Test_regenerateFlashEdgeTimes(t *testing.T) {
+	logPath := writeTestSentenceLog(t, func(int) int64 { return 0 })
+	outPath := filepath.Join(t.TempDir(), regeneratedFlashEdgeTimesFile)
+
+	replay, timedEdges, err := regenerateFlashEdgeTimes(logPath, outPath, RegenerateOptions{}, builtInLeapSeconds)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, replay.badSentences)
+	assert.Equal(t, 19, len(replay.data.tickStamp))
+	assert.Equal(t, 1, len(replay.data.gaps))
+	assert.Equal(t, 2, len(timedEdges))
+	assert.Equal(t, "2024-03-01T00:00:06.250000", timedEdges[0].utc.Format(timestampLayout))
+	assert.Equal(t, "2024-03-01T00:00:08.250000", timedEdges[1].utc.Format(timestampLayout))
+
+	contents, _ := os.ReadFile(outPath)
+	assert.Contains(t, string(contents), "model bracket")
+	assert.Contains(t, string(contents), "1 on  2024-03-01T00:00:06.250000Z|18\n")
+	assert.Contains(t, string(contents), "reported 16D (default-rebased-to-18)")
+	assert.Contains(t, string(contents), "# edge 1: GpsUtcOffset 18 (almanac)\n")
+	assert.Contains(t, string(contents), "# lost 1pps: 1 pulse(s) before 2024-03-01T00:00:13.000000Z")
+}
+
+func Test_regenerateWithGivenOffsetAndWindow(t *testing.T) {
+	logPath := writeTestSentenceLog(t, func(int) int64 { return 0 })
+	outPath := filepath.Join(t.TempDir(), regeneratedFlashEdgeTimesFile)
+
+	opts := RegenerateOptions{gpsUtcOffset: 17, from: time.Date(2024, 3, 1, 0, 0, 7, 0, time.UTC)}
+	_, timedEdges, err := regenerateFlashEdgeTimes(logPath, outPath, opts, builtInLeapSeconds)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(timedEdges))
+	assert.False(t, timedEdges[0].on)
+	assert.Equal(t, "2024-03-01T00:00:09.250000", timedEdges[0].utc.Format(timestampLayout))
+}
+
+func Test_replayZDAWithoutFix(t *testing.T) {
+	r := &sentenceReplay{opts: RegenerateOptions{gpsUtcOffset: 18}, leapTable: builtInLeapSeconds}
+	r.feed(nmeaLine(1, "$GPRMC,000000.00,V,,,,,,,010324,,,N"))
+	r.feed(nmeaLine(1, "$GPZDA,000000.00,01,03,2024,00,00"))
+	r.feed(nmeaLine(1, "$PUBX,04,000000.00,010324,0.00,2303,18,0,0,"))
+	assert.True(t, r.rmcTime.IsZero())
+	assert.Equal(t, "", r.utcTimestamp)
+
+	r.feed(nmeaLine(2, "$GNGSA,A,3,10,12,15,24,,,,,,,,,1.5,0.9,1.2,1"))
+	r.feed(nmeaLine(2, "$GPZDA,000001.00,01,03,2024,00,00"))
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 1, 0, time.UTC), r.rmcTime)
+}
+
+func Test_replayDecodesAsLive(t *testing.T) {
+	r := &sentenceReplay{opts: RegenerateOptions{gpsUtcOffset: 18}, leapTable: builtInLeapSeconds}
+
+	// A sentence that decodeSentence rejects is bad, one it has no decoder for is passed over
+	r.feed(nmeaLine(1, "$GPRMC,000000.00,A,4000.0000,N,10500.0000,W,0.0,0.0,0103,,,D"))
+	r.feed(nmeaLine(1, "$PUBX,00,000000.00,4000.0000,N,10500.0000,W"))
+	assert.Equal(t, 1, r.badSentences)
+	assert.True(t, r.rmcTime.IsZero())
+
+	// An RMC with an embedded command response and a GN talker gives the time
+	line := nmeaLine(2, "$GNRMC,000002.00,A,4000.0000,N,10500.0000,W,0.0,0.0,010324,,,D")
+	inner := line[:len(line)-3]
+	r.feed(gftLine(inner[:10] + "[][CMD flash now][]" + inner[10:]))
+	assert.Equal(t, 1, r.badSentences)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 2, 0, time.UTC), r.rmcTime)
+}
+
+func Test_fitEdgeTimestamp(t *testing.T) {
+	// With 1pps readings jittered by +-20 ticks, the fitted time is closer to the true one
+	jitter := func(second int) int64 {
+		if second%2 == 0 {
+			return 20
+		}
+		return -20
+	}
+	logPath := writeTestSentenceLog(t, jitter)
+	outPath := filepath.Join(t.TempDir(), regeneratedFlashEdgeTimesFile)
+
+	_, bracketEdges, err := regenerateFlashEdgeTimes(logPath, outPath, RegenerateOptions{model: edgeModelBracket}, builtInLeapSeconds)
+	assert.Nil(t, err)
+	_, fitEdges, err := regenerateFlashEdgeTimes(logPath, outPath, RegenerateOptions{model: edgeModelFit}, builtInLeapSeconds)
+	assert.Nil(t, err)
+
+	truth := time.Date(2024, 3, 1, 0, 0, 6, 250_000_000, time.UTC)
+	bracketError := bracketEdges[0].utc.Sub(truth).Abs()
+	fitError := fitEdges[0].utc.Sub(truth).Abs()
+	assert.Less(t, fitError, bracketError)
+
+	_, _, err = regenerateFlashEdgeTimes(logPath, outPath, RegenerateOptions{model: "spline"}, builtInLeapSeconds)
+	assert.NotNil(t, err)
+}
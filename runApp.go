@@ -5,7 +5,6 @@ import (
 	"fyne.io/fyne/v2/widget"
 	"image/color"
 	"io"
-	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -13,7 +12,7 @@ import (
 	"time"
 )
 
-func MoveFile(sourcePath, destPath string) error {
+func copyFile(sourcePath, destPath string) error {
 	inputFile, err := os.Open(sourcePath)
 	if err != nil {
 		return fmt.Errorf("couldn't open source file: %v", err)
@@ -30,13 +29,6 @@ func MoveFile(sourcePath, destPath string) error {
 	if err != nil {
 		return fmt.Errorf("couldn't copy to dest from source: %v", err)
 	}
-
-	inputFile.Close() // for Windows, close before trying to remove: https://stackoverflow.com/a/64943554/246801
-
-	err = os.Remove(sourcePath)
-	if err != nil {
-		return fmt.Errorf("couldn't remove source file: %v", err)
-	}
 	return nil
 }
 
@@ -44,23 +36,21 @@ func runApp(myWin *Config) {
 
 	//myWin.App.Preferences().SetString("gpsUtcOffset", "17") // TODO Use this to test change to GpsUtcOffset
 
-	sentenceChan := make(chan string, 1)
+	sentenceChan := make(chan ReceivedSentence, 1)
 
 	// This runs infinitely, sending each sentence received to sentenceChan. It has a 2-second timeout
 	// for dealing with a non-responsive serial port and returns "timeout" as a sentence in that case.
 	go getNextSentence(sentenceChan)
 
-	waitingForNestFinish := false
+	var nests NestSplitter
 
 	//var tickCounter int64
 	var tickMsg string
 
-	var ans []string
+	var parsed Sentence
+	var actions SentenceActions
 	var checksumString string
 	var err error
-	var parts []string
-	var partsSaved []string
-	var nester, nestee string
 	const showTickMsg = true
 	time.Sleep(2000 * time.Millisecond)
 	showMsg("Special test protocol", noUTCtest, 450, 800)
@@ -69,63 +59,85 @@ func runApp(myWin *Config) {
 			// A 'sentence' is everything up to, but not including, a crlf sequence.
 			// The last three characters of the 'sentence' are a checksum *xx (even for a 'nest')
 			// The checksum has not yet been validated at this point.
-			sentence := <-sentenceChan // Block until a sentence is returned by go getNextSentence(sentenceChan)
+			received := <-sentenceChan // Block until a sentence is returned by go getNextSentence(sentenceChan)
+			sentence := received.text
 
 			if sentence == "timeout" {
 				msg := fmt.Sprintf("Serial port %s is not responding.", myWin.comPortName)
 				addToTextOutDisplay(msg)
-				log.Println(msg)
+				serialLog.Warn("serial port not responding", "port", myWin.comPortName)
 				continue
 			}
 
 			// Always write every sentence to the log file
 			if myWin.logFile != nil {
-				_, fileErr := myWin.logFile.WriteString(sentence + "\n")
-				if fileErr != nil {
-					log.Println(fmt.Errorf("runApp(): %w", fileErr))
+				fileErr := myWin.logFile.WriteSentence(sentence, gpsData.unixTime, received.hostTime)
+				if fileErr != nil && fileErr != errSentenceLogBroken { // a broken log has already been reported
+					filesLog.Error("sentence not logged", "err", fileErr)
 				}
 			}
 
-			if waitingForNestFinish {
-				waitingForNestFinish = false
-				nestee = "{" + partsSaved[1] + sentence
-				ans, checksumString, err = sendSentenceToBeParsed(nestee, ans, err)
-				displayEnabledItems(ans, checksumString)
-				ans, checksumString, err = sendSentenceToBeParsed(nester, ans, err)
-				displayEnabledItems(ans, checksumString)
+			// Nested P, E, +, or ! sentences are parsed once the nest is finished
+			completed := nests.feed(received)
+			if len(completed) == 0 {
+				archiveSentence(sentence, "nest", received.hostTime)
 				continue
 			}
-
-			// Test for nested P, E, +, or - flash phrases pulse
-			// or NMEA and E (there will be exactly 2 { characters in the 'nest')
-			parts = strings.Split(sentence, "{")
-			if len(parts) > 2 {
-				// We have a 'nested pulse' situation
-				//fmt.Println("Nest found:", sentence)
-				nester = "{" + parts[2]
-				partsSaved = make([]string, len(parts))
-				copy(partsSaved, parts)
-				waitingForNestFinish = true
+			if len(completed) == 2 {
+				for i, nested := range completed {
+					gpsData.hostTime = nested.hostTime
+					parsed, actions, checksumString, err = sendSentenceToBeParsed(nested.text)
+					if i == 0 {
+						archiveSentence(sentence, sentenceKind(parsed), received.hostTime)
+					}
+					displayEnabledItems(parsed, actions, checksumString)
+				}
 				continue
 			}
 
 			// This call checks the checksum
-			ans, checksumString, err = sendSentenceToBeParsed(sentence, ans, err)
+			gpsData.hostTime = received.hostTime
+			parsed, actions, checksumString, err = sendSentenceToBeParsed(sentence)
+			archiveSentence(sentence, sentenceKind(parsed), received.hostTime)
+			if response, ok := parsed.(*CommandResponseSentence); ok && response.isStart() {
+				go queryDeviceConfig() // it waits for the responses, which arrive through this loop
+			}
 			needTickMsg := false
-			if ans[0] == "P" {
+			if pulse, ok := parsed.(*PulseSentence); ok && pulse.kind == pulsePPS {
 				tickMsg = fmt.Sprintf("unixTime %d ", gpsData.unixTime)
 				lostPulseCount := gpsData.unixTime - gpsData.nextUnixTime
-				// When the PUBX04 gpsUtcOffset changes from 16D to 18, it appears that -2 1pps
-				// pulses were lost. We deal with this by only reporting positive lostPulseCount values
+				// When the PUBX04 gpsUtcOffset changes from 16D to 18, the GPRMC time steps back 2 seconds
+				// and it appears that -2 1pps pulses were lost. noteGpsUtcOffset() records the step that
+				// such an offset change causes, so we can resynchronize instead of reporting lost pulses.
+				if lostPulseCount != 0 && lostPulseCount == onePPSdata.pendingUnixTimeStep {
+					timingLog.Info("unixTime stepped because of a GpsUtcOffset change", "seconds", lostPulseCount)
+					onePPSdata.pendingUnixTimeStep = 0
+					gpsData.nextUnixTime = gpsData.unixTime
+				} else if lostPulseCount < 0 {
+					timingLog.Warn("unixTime stepped back unexpectedly", "seconds", -lostPulseCount)
+					gpsData.nextUnixTime = gpsData.unixTime
+				}
 				if lostPulseCount > 0 {
 					if myWin.captureActive {
 						showMsg("PPS error !",
 							fmt.Sprintf("\n%d 1pps pulses were lost while capture active !!!\n", lostPulseCount), 200, 800)
 					}
-					log.Printf("%d 1pps pulses were lost\n", lostPulseCount)
+					timingLog.Warn("1pps pulses lost", "count", lostPulseCount, "unixTime", gpsData.unixTime,
+						"captureActive", myWin.captureActive)
+					recordPPSGap(&onePPSdata, gpsData, lostPulseCount)
 					gpsData.nextUnixTime = gpsData.unixTime // catch up so that we can continue testing
 				}
 				gpsData.nextUnixTime += 1
+
+				publishTimeService(&onePPSdata, gpsData)
+
+				// Keep the 1pps history bounded for multi-night sessions
+				trimErr := trimPPSHistory(&onePPSdata, ppsRetentionSeconds(), ppsKeepFrom(),
+					filepath.Join(getWorkDir(), ppsArchiveDir))
+				if trimErr != nil {
+					timingLog.Error("1pps history not trimmed", "err", trimErr)
+				}
+
 				// This is where we check for time to do a start recording
 				if myWin.utcStartArmed {
 					tNow := gpsData.unixTime
@@ -135,14 +147,16 @@ func runApp(myWin *Config) {
 					// with a scheduled event
 					if tNow >= myWin.leaderStartTime && !myWin.pastLeader {
 						tickMsg += fmt.Sprint("Starting leader ")
-						log.Println(fmt.Sprint("Starting leader "))
+						schedulerLog.Info("starting leader", "unixTime", tNow)
+						myWin.journal.step("leader", tNow)
 						needTickMsg = true
 						myWin.pastLeader = true
+						myWin.sessionRecorded = true
 						if connectToSharpCap() {
 							//Example of asking SharpCap to set exposure time
 							//fmt.Println(getResponse(myWin.SharpCapConn, "set_exp_seconds 0.5"))
 							myWin.captureActive = true
-							getResponse(myWin.SharpCapConn, "start")
+							timedSharpCapCommand("start")
 						} else {
 							clearSchedule(myWin)
 							goto endSchedule
@@ -151,32 +165,35 @@ func runApp(myWin *Config) {
 
 					if tNow >= myWin.firstFlashTime && !myWin.pastFlashOne {
 						tickMsg += fmt.Sprint("Flash one requested")
-						log.Println(fmt.Sprint("Flash one requested"))
+						schedulerLog.Info("flash one requested", "unixTime", tNow)
+						myWin.journal.step("flashOne", tNow)
 						needTickMsg = true
 						myWin.pastFlashOne = true
-						sendCommandToArduino("flash now")
+						go sendGoalpostFlash(1)
 					}
 
 					if tNow >= myWin.secondFlashTime && !myWin.pastFlashTwo {
 						tickMsg += fmt.Sprint("Flash two requested")
-						log.Println(fmt.Sprint("Flash two requested"))
+						schedulerLog.Info("flash two requested", "unixTime", tNow)
+						myWin.journal.step("flashTwo", tNow)
 						myWin.pastFlashTwo = true
 						needTickMsg = true
-						sendCommandToArduino("flash now")
+						go sendGoalpostFlash(2)
 					}
 
 					if tNow >= myWin.endOfRecording && !myWin.pastEnd {
 						myWin.App.Preferences().SetBool("ArmUTCstartTime", false)
 
 						tickMsg += fmt.Sprint("Recording ended\n")
-						log.Println(fmt.Sprint("Recording ended"))
+						schedulerLog.Info("recording ended", "unixTime", tNow)
+						myWin.journal.step("end", tNow)
 						myWin.pastEnd = true
 						needTickMsg = true
 						myWin.captureActive = false
 
 						var sharpCapPath string
 						if connectToSharpCap() {
-							getResponse(myWin.SharpCapConn, "stop")
+							timedSharpCapCommand("stop")
 							sharpCapPath = getResponse(myWin.SharpCapConn, "lastfilepath")
 						} else {
 							clearSchedule(myWin)
@@ -185,60 +202,62 @@ func runApp(myWin *Config) {
 						dirPath, _ := filepath.Split(sharpCapPath)
 						if !myWin.shutdownCheckBox.Checked {
 							showMsg("Path to SharpCap capture folder:", dirPath, 200, 800)
-							log.Println(fmt.Sprint("Path to SharpCap capture folder:  ", dirPath))
+							sharpCapLog.Info("capture folder", "path", dirPath)
 						}
 
-						calcFlashEdgeTimes() // These get written to the flashEdgeLogfile
+						timedEdges := calcFlashEdgeTimes() // These get written to the flashEdgeLogfile
 						myWin.flashEdgeLogfile.Close()
 						flashEdges = []FlashEdge{}
 
-						clearSchedule(myWin)
+						validation := validateRecordingFlashEdges(timedEdges)
 
-						err := MoveFile(myWin.flashEdgeLogfilePath, dirPath+"FLASH_EDGE_TIMES.txt")
-						if err != nil {
-							log.Println(err)
-						}
+						clearSchedule(myWin)
 
 						_, _ = myWin.logFile.WriteString("Last line of the IotaGFTapp GPS sentence log file" + "\n")
 
-						myWin.logFile.Close()
-						err = MoveFile(myWin.logFilePath, dirPath+"IotaGFT_LOG.txt")
-						if err != nil {
-							log.Println(err)
+						// A plot that cannot be written must not stop the session being closed and delivered
+						if err := buildPlot(filepath.Join(myWin.sessionDir, ppsHistoryPlotFile)); err != nil {
+							filesLog.Error("1pps history plot not written", "err", err)
 						}
 
-						// We ignore the error here as it is standard to get a "file used elsewhere" error
-						_ = MoveFile(operationLog, dirPath+operationLog)
-						//if err != nil {
-						//	log.Println(err)
-						//}
-
-						// Create a new set of Log and FlashEdge files in our working directory
-						createLogAndFlashEdgeFiles(getWorkDir())
-
 						if showTickMsg && needTickMsg {
-							fmt.Println(tickMsg)
+							schedulerLog.Debug(strings.TrimSpace(tickMsg))
 							needTickMsg = false
 						}
 
-						if myWin.autoRunFitsReaderCheckBox.Checked {
-							go startFitsReader(dirPath, err)
+						if !myWin.shutdownCheckBox.Checked {
+							showMsg("Flash edge validation", "\n"+validation.summary(), 400, 800)
 						}
 
-						if myWin.shutdownCheckBox.Checked {
-							if err := exec.Command("cmd", "/C", "shutdown", "/s").Run(); err != nil {
-								log.Println("Failed to initiate shutdown:", err)
+						// Close the session, deliver its files to the capture folder and start a new session.
+						// What follows the transfer waits for the files to be delivered.
+						closeAndDeliverSession(dirPath, myWin.leaderStartTime, myWin.endOfRecording, func(sessionDir string,
+							transferResults []TransferResult, allDelivered bool) {
+							if !myWin.shutdownCheckBox.Checked && !allDelivered {
+								showTransferProblem(sessionDir, dirPath, transferResults)
 							}
-						}
+
+							if myWin.autoRunFitsReaderCheckBox.Checked {
+								go startFitsReader(dirPath, nil)
+							}
+
+							if myWin.shutdownCheckBox.Checked {
+								if err := exec.Command("cmd", "/C", "shutdown", "/s").Run(); err != nil {
+									appLog.Error("shutdown not initiated", "err", err)
+								} else {
+									appLog.Info("shutdown initiated")
+								}
+							}
+						})
 
 					}
 				endSchedule:
 				}
 				if showTickMsg && needTickMsg {
-					fmt.Println(tickMsg)
+					schedulerLog.Debug(strings.TrimSpace(tickMsg))
 				}
 			}
-			displayEnabledItems(ans, checksumString)
+			displayEnabledItems(parsed, actions, checksumString)
 			updateStatusLine(gpsData)
 
 			// Check for selected com port no longer available - an error will occur
@@ -261,12 +280,23 @@ func runApp(myWin *Config) {
 }
 
 func clearSchedule(myWin *Config) {
+	if myWin.utcStartArmed {
+		schedulerLog.Info("schedule cleared", "pastLeader", myWin.pastLeader, "pastFlashOne", myWin.pastFlashOne,
+			"pastFlashTwo", myWin.pastFlashTwo, "pastEnd", myWin.pastEnd)
+	}
+	if myWin.pastEnd {
+		closeJournal("ended")
+	} else {
+		closeJournal("cleared")
+	}
+
 	// Reset all scheduling flags
 	myWin.utcStartArmed = false
 	myWin.pastLeader = false
 	myWin.pastFlashOne = false
 	myWin.pastFlashTwo = false
 	myWin.pastEnd = false
+	goalpostCommands.reset()
 
 	// Reset the ARm UTC button color and label
 	myWin.armUTCbutton.Importance = widget.MediumImportance
@@ -277,21 +307,52 @@ func startFitsReader(dirPath string, err error) {
 	cmd := exec.Command("./FitsReader.exe", dirPath)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	appLog.Info("starting FitsReader", "dir", dirPath)
 	err = cmd.Run()
 	if err != nil {
-		log.Fatalf("cmd.Run() failed with %s\n", err)
+		fatal("FitsReader failed", err)
 	}
 }
 
-func sendSentenceToBeParsed(sentence string, ans []string, err error) ([]string, string, error) {
-	n := len(sentence)
-	checksum := sentence[n-3:]
-	ans, err = parseSentence(sentence[0:n-3], checksum, &gpsData)
+// sendSentenceToBeParsed parses a sentence and carries out what it calls for from the UI
+func sendSentenceToBeParsed(sentence string) (Sentence, SentenceActions, string, error) {
+	sentence, checksum, err := splitChecksum(sentence)
+	if err != nil {
+		parserLog.Warn("sentence not parsed", "err", err)
+		return nil, SentenceActions{}, "", err
+	}
+	parsed, actions, err := parseSentence(sentence, checksum, &gpsData)
+
+	// While a recording is armed, what the sentence added to the 1pps history is journaled
+	myWin.journal.recordTimingEvents(&onePPSdata, flashEdges, gpsData.unixTime)
 	if err != nil {
 		addToTextOutDisplay(fmt.Sprintf("%v", err))
-		log.Println(fmt.Sprintf("%v", err))
+		parserLog.Warn("sentence not parsed", "err", err)
+	}
+	if _, ok := parsed.(*PUBX04Sentence); ok {
+		showGpsUtcOffset(actions.gpsUtcOffset, actions.newGpsUtcOffset)
+	}
+	if actions.armRecording {
+		armUTCstart()
+	}
+	return parsed, actions, checksum, err
+}
+
+// showGpsUtcOffset shows the GpsUtcOffset reported by a PUBX,04 sentence: red until the receiver has
+// the almanac, and with a warning when the almanac gives a new one
+func showGpsUtcOffset(gpsUtcOffset string, newOffset bool) {
+	if strings.Contains(gpsUtcOffset, "D") {
+		myWin.gpsUtcOffsetInUse.Text = fmt.Sprintf("GpsUtcOffset: %s", getGpsUtcOffset())
+		myWin.gpsUtcOffsetInUse.Color = color.NRGBA{R: 180, A: 255}
+	} else {
+		if newOffset {
+			msg := fmt.Sprintf("\n\n\n\n\n\n\n\n\n\n\t\t!!!!! There is a NEW GpsUtcOffset of: %s  !!!!", gpsUtcOffset)
+			showMsg("GpsUtcOffset change", msg, 500, 600)
+		}
+		myWin.gpsUtcOffsetInUse.Text = fmt.Sprintf("GpsUtcOffset: %s", gpsUtcOffset)
+		myWin.gpsUtcOffsetInUse.Color = color.NRGBA{G: 180, A: 255}
 	}
-	return ans, checksum, err
+	myWin.gpsUtcOffsetInUse.Refresh()
 }
 
 func updateStatusLine(gpsInfo GPSdata) {
@@ -391,9 +452,45 @@ func updateStatusLine(gpsInfo GPSdata) {
 		myWin.altitudeStatus.Text = "Altitude: not available"
 		myWin.altitudeStatus.Refresh()
 	}
+	myWin.satellitesStatus.Text = satellitesText(gpsInfo)
+	myWin.satellitesStatus.Refresh()
+	refreshSkyPanel(gpsInfo)
+	refreshAlerts()
+}
+
+// satellitesText is the satellites item of the status line: satellites used and in view, fix type and DOPs
+func satellitesText(gpsInfo GPSdata) string {
+	// Each signal group of a constellation lists the same satellites
+	byTalker := make(map[string]int)
+	for group, n := range gpsInfo.satellitesInView {
+		byTalker[group.talker] = max(byTalker[group.talker], n)
+	}
+	inView := 0
+	for _, n := range byTalker {
+		inView += n
+	}
+	if gpsInfo.fixType == 0 && gpsInfo.satellitesUsed == 0 && inView == 0 {
+		return "Satellites: not available"
+	}
+	text := fmt.Sprintf("Satellites: %d used of %d in view", gpsInfo.satellitesUsed, inView)
+	switch gpsInfo.fixType {
+	case fixNone:
+		text += "  no fix"
+	case fix2D:
+		text += "  2D fix"
+	case fix3D:
+		text += "  3D fix"
+	}
+	if gpsInfo.hdop > 0 {
+		text += fmt.Sprintf("  HDOP %.1f", gpsInfo.hdop)
+	}
+	if gpsInfo.pdop > 0 {
+		text += fmt.Sprintf("  PDOP %.1f", gpsInfo.pdop)
+	}
+	return text
 }
 
-func getNextSentence(sc chan string) string {
+func getNextSentence(sc chan ReceivedSentence) string {
 	// A 'sentence' is everything that precedes a crlf sequence
 	started := false // remains false until Arduino emits "[STARTING!]"
 
@@ -429,36 +526,51 @@ func getNextSentence(sc chan string) string {
 			// Read a chunk of up to 200 bytes into buff
 			n, err := myWin.serialPort.Read(buff)
 			if err != nil {
-				//log.Print(err)
+				serialLog.Warn("serial port read failed", "port", myWin.comPortName, "err", err)
 				myWin.serialPort = nil
 			}
 
 			myWin.spMutex.Unlock()
 
 			if n == 0 {
-				sc <- "timeout"
+				sc <- ReceivedSentence{text: "timeout", hostTime: time.Now()}
 				break
 			}
 
 			chunk := string(buff[:n])
 			sumChunks = sumChunks + chunk
 
-			if strings.Contains(sumChunks, boundaryMarker) {
+			// UBX frames are binary: each is taken out whole before looking for the boundary marker
+			ubxWaiting := false
+			for {
+				var frame *UBXFrame
+				frame, sumChunks, ubxWaiting = nextUBXFrame(sumChunks, boundaryMarker)
+				if frame == nil {
+					break
+				}
+				if started {
+					sc <- ReceivedSentence{text: frame.text(), hostTime: time.Now()}
+				}
+			}
+
+			if !ubxWaiting && strings.Contains(sumChunks, boundaryMarker) {
 				sentence, sumChunks, _ = strings.Cut(sumChunks, boundaryMarker)
+				hostTime := time.Now() // the sentence is complete when its boundary marker is found
 				if started {
 					// Test code for nested P and E sentences
 					sentenceNumber += 0 // if 0, then test code is disabled
 					if sentenceNumber == 20 {
 						//sc <- "{002F{004D92C8 P}*76"
 						//sc <- "0AE7 P}*01"
-						sc <- "{0033C29E $GPDTM,W84,,{0050BD13 P}*77"
-						sc <- "0.0,N,0.0,E,0.0,W84*6F}*3A"
+						sc <- ReceivedSentence{text: "{0033C29E $GPDTM,W84,,{0050BD13 P}*77", hostTime: hostTime}
+						sc <- ReceivedSentence{text: "0.0,N,0.0,E,0.0,W84*6F}*3A", hostTime: hostTime}
 					}
-					sc <- sentence
+					sc <- ReceivedSentence{text: sentence, hostTime: hostTime}
 				} else {
 					if strings.Contains(sentence, "[STARTING!]") {
+						serialLog.Info("GFT started", "port", myWin.comPortName)
 						started = true
-						sc <- sentence
+						sc <- ReceivedSentence{text: sentence, hostTime: hostTime}
 					}
 				}
 			}
@@ -466,38 +578,58 @@ func getNextSentence(sc chan string) string {
 	} // infinite loop
 }
 
-func displayEnabledItems(ans []string, chkSumStr string) {
-	if ans[0] == "" {
+func displayEnabledItems(parsed Sentence, actions SentenceActions, chkSumStr string) {
+	if parsed == nil {
 		return
 	}
+	text := parsed.Text()
+	if _, ok := parsed.(*PulseSentence); ok {
+		text += fmt.Sprintf(" (deltaP is %d)", actions.deltaP)
+	}
 
-	switch ans[0] {
+	switch parsed.Kind() {
 	case "$GPGGA":
 		if myWin.gpggaCheckBox.Checked {
-			addToTextOutDisplay(ans[1] + chkSumStr)
+			addToTextOutDisplay(text + chkSumStr)
 		}
 	case "$GPRMC":
 		if myWin.gprmcCheckBox.Checked {
-			addToTextOutDisplay(ans[1] + chkSumStr)
+			addToTextOutDisplay(text + chkSumStr)
 		}
 	case "$GPDTM":
 		if myWin.gpdtmCheckBox.Checked {
-			addToTextOutDisplay(ans[1] + chkSumStr)
+			addToTextOutDisplay(text + chkSumStr)
 		}
 	case "$PUBX":
 		if myWin.pubxCheckBox.Checked {
-			addToTextOutDisplay(ans[1] + chkSumStr)
+			addToTextOutDisplay(text + chkSumStr)
 		}
 	case "P":
 		if myWin.pCheckBox.Checked {
-			addToTextOutDisplay(ans[1] + chkSumStr)
+			addToTextOutDisplay(text + chkSumStr)
 		}
 	case "MODE":
 		if myWin.modeCheckBox.Checked {
-			addToTextOutDisplay(ans[1] + chkSumStr)
+			addToTextOutDisplay(text + chkSumStr)
+		}
+	case "$GPZDA":
+		if myWin.gpzdaCheckBox.Checked {
+			addToTextOutDisplay(text + chkSumStr)
+		}
+	case "$GPGSA":
+		if myWin.gpgsaCheckBox.Checked {
+			addToTextOutDisplay(text + chkSumStr)
+		}
+	case "$GPGSV":
+		if myWin.gpgsvCheckBox.Checked {
+			addToTextOutDisplay(text + chkSumStr)
+		}
+	case "UBX":
+		if myWin.ubxCheckBox.Checked {
+			addToTextOutDisplay(text + chkSumStr)
 		}
 	default:
-		addToTextOutDisplay(ans[1] + chkSumStr)
+		addToTextOutDisplay(text + chkSumStr)
 	}
 }
 
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The binary sentence archive is optional (BinaryArchive preference). It holds every received sentence
+// with its host receive time and what parseSentence made of it. The index file has an entry for the
+// first record of every host clock second so that a time can be found without reading the archive.
+const (
+	sentenceArchiveFile      = "IotaGFT_ARCHIVE.bin"
+	sentenceArchiveIndexFile = "IotaGFT_ARCHIVE.idx"
+)
+
+const (
+	archiveMagic   = "IOTAGFTA"
+	archiveVersion = 2
+)
+
+// Record layout (little endian): sentence length uint32, host receive time int64 (unix ns), host
+// monotonic time int64 (ns since the app started), gpsData.unixTime int64, type uint8, flags uint8,
+// tick uint32, then the sentence bytes. Version 1 records have no host monotonic time.
+const (
+	archiveRecordHeaderSize   = 4 + 8 + 8 + 8 + 1 + 1 + 4
+	archiveV1RecordHeaderSize = archiveRecordHeaderSize - 8
+)
+
+// Index entry layout (little endian): host time int64 (unix ns), gpsData.unixTime int64, archive offset int64
+const archiveIndexEntrySize = 8 + 8 + 8
+
+const (
+	archiveChecksumOK = 1 << iota // the sentence checksum was valid
+	archiveHasTick                // the sentence began with a GFT tick count
+)
+
+// Sentence types are stored as their position in this list. New types are only ever appended.
+var archiveTypes = []string{"", "$GPGGA", "$GPRMC", "$GPDTM", "$PUBX", "P", "+", "E", "MODE", "other", "nest",
+	"$GPZDA", "$GPGSA", "$GPGSV", "UBX"}
+
+func archiveTypeCode(sentenceType string) uint8 {
+	for i, t := range archiveTypes {
+		if t == sentenceType {
+			return uint8(i)
+		}
+	}
+	return 0
+}
+
+func archiveTypeName(code uint8) string {
+	if int(code) < len(archiveTypes) {
+		return archiveTypes[code]
+	}
+	return "unknown-" + strconv.Itoa(int(code))
+}
+
+type ArchiveRecord struct {
+	hostTime      time.Time
+	hostMonotonic time.Duration // host receive time by the monotonic clock, since the app started (0 in version 1)
+	unixTime      int64         // gpsData.unixTime when the sentence was received
+	sentType      string
+	checksumOK    bool
+	hasTick       bool
+	tick          uint32 // GFT tick count at the start of the sentence
+	sentence      string
+}
+
+// sentenceTick returns the GFT tick count that starts a sentence such as {000C97C7 P}*xx
+func sentenceTick(sentence string) (uint32, bool) {
+	if len(sentence) < 10 || sentence[0] != '{' || (sentence[9] != ' ' && sentence[9] != '}') {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(sentence[1:9], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(value), true
+}
+
+func sentenceChecksumOK(sentence string) bool {
+	n := len(sentence)
+	if n < 4 {
+		return false
+	}
+	chkSum, _ := calcChecksum(sentence[:n-3])
+	return chkSum == sentence[n-3:]
+}
+
+// A SentenceArchive appends records to the archive and index files of a session
+type SentenceArchive struct {
+	file       *os.File
+	index      *os.File
+	offset     int64
+	lastSecond int64
+}
+
+func newSentenceArchive(dir string) (*SentenceArchive, error) {
+	file, err := os.Create(filepath.Join(dir, sentenceArchiveFile))
+	if err != nil {
+		return nil, fmt.Errorf("newSentenceArchive(): %w", err)
+	}
+	index, err := os.Create(filepath.Join(dir, sentenceArchiveIndexFile))
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("newSentenceArchive(): %w", err)
+	}
+
+	// Header: magic, format version, then the app version that wrote the archive
+	header := []byte(archiveMagic)
+	header = binary.LittleEndian.AppendUint16(header, archiveVersion)
+	header = binary.LittleEndian.AppendUint16(header, uint16(len(Version)))
+	header = append(header, Version...)
+	_, err = file.Write(header)
+	if err != nil {
+		file.Close()
+		index.Close()
+		return nil, fmt.Errorf("newSentenceArchive(): %w", err)
+	}
+	return &SentenceArchive{file: file, index: index, offset: int64(len(header)), lastSecond: -1}, nil
+}
+
+// WriteSentence archives a sentence as received, with the type that parseSentence gave it
+func (sa *SentenceArchive) WriteSentence(sentence, sentenceType string, unixTime int64, hostTime time.Time) error {
+	if sa == nil {
+		return nil
+	}
+	if second := hostTime.Unix(); second != sa.lastSecond {
+		entry := binary.LittleEndian.AppendUint64(nil, uint64(hostTime.UnixNano()))
+		entry = binary.LittleEndian.AppendUint64(entry, uint64(unixTime))
+		entry = binary.LittleEndian.AppendUint64(entry, uint64(sa.offset))
+		_, err := sa.index.Write(entry)
+		if err != nil {
+			return fmt.Errorf("SentenceArchive.WriteSentence(): %w", err)
+		}
+		sa.lastSecond = second
+	}
+
+	var flags uint8
+	if sentenceChecksumOK(sentence) {
+		flags |= archiveChecksumOK
+	}
+	tick, hasTick := sentenceTick(sentence)
+	if hasTick {
+		flags |= archiveHasTick
+	}
+	record := make([]byte, 0, archiveRecordHeaderSize+len(sentence))
+	record = binary.LittleEndian.AppendUint32(record, uint32(len(sentence)))
+	record = binary.LittleEndian.AppendUint64(record, uint64(hostTime.UnixNano()))
+	record = binary.LittleEndian.AppendUint64(record, uint64(hostMonotonic(hostTime)))
+	record = binary.LittleEndian.AppendUint64(record, uint64(unixTime))
+	record = append(record, archiveTypeCode(sentenceType), flags)
+	record = binary.LittleEndian.AppendUint32(record, tick)
+	record = append(record, sentence...)
+	n, err := sa.file.Write(record)
+	sa.offset += int64(n)
+	if err != nil {
+		return fmt.Errorf("SentenceArchive.WriteSentence(): %w", err)
+	}
+	return nil
+}
+
+func (sa *SentenceArchive) Close() error {
+	if sa == nil {
+		return nil
+	}
+	err := sa.file.Close()
+	indexErr := sa.index.Close()
+	if err == nil {
+		err = indexErr
+	}
+	return err
+}
+
+// An ArchiveReader reads the records of an archive in order
+type ArchiveReader struct {
+	file       *os.File
+	reader     *bufio.Reader
+	version    uint16
+	appVersion string
+}
+
+func openArchiveReader(path string) (*ArchiveReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+	header := make([]byte, len(archiveMagic)+4)
+	_, err = io.ReadFull(reader, header)
+	if err != nil || string(header[:len(archiveMagic)]) != archiveMagic {
+		file.Close()
+		return nil, fmt.Errorf("openArchiveReader(): %s is not a sentence archive", path)
+	}
+	version := binary.LittleEndian.Uint16(header[len(archiveMagic):])
+	if version != 1 && version != archiveVersion {
+		file.Close()
+		return nil, fmt.Errorf("openArchiveReader(): unsupported archive version %d", version)
+	}
+	appVersion := make([]byte, binary.LittleEndian.Uint16(header[len(archiveMagic)+2:]))
+	_, err = io.ReadFull(reader, appVersion)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("openArchiveReader(): %w", err)
+	}
+	return &ArchiveReader{file: file, reader: reader, version: version, appVersion: string(appVersion)}, nil
+}
+
+// SeekRecord moves to a record offset (from the index)
+func (ar *ArchiveReader) SeekRecord(offset int64) error {
+	_, err := ar.file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	ar.reader.Reset(ar.file)
+	return nil
+}
+
+// Next returns the next record, or io.EOF. A record cut short (the app stopped while writing it) is
+// treated as the end of the archive.
+func (ar *ArchiveReader) Next() (ArchiveRecord, error) {
+	headerSize := archiveRecordHeaderSize
+	if ar.version == 1 {
+		headerSize = archiveV1RecordHeaderSize
+	}
+	header := make([]byte, headerSize)
+	_, err := io.ReadFull(ar.reader, header)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return ArchiveRecord{}, io.EOF
+	}
+	if err != nil {
+		return ArchiveRecord{}, err
+	}
+	sentence := make([]byte, binary.LittleEndian.Uint32(header[0:]))
+	_, err = io.ReadFull(ar.reader, sentence)
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return ArchiveRecord{}, io.EOF
+	}
+	if err != nil {
+		return ArchiveRecord{}, err
+	}
+	record := ArchiveRecord{
+		hostTime: time.Unix(0, int64(binary.LittleEndian.Uint64(header[4:]))).UTC(),
+		sentence: string(sentence),
+	}
+	rest := header[12:]
+	if ar.version != 1 {
+		record.hostMonotonic = time.Duration(binary.LittleEndian.Uint64(rest))
+		rest = rest[8:]
+	}
+	flags := rest[9]
+	record.unixTime = int64(binary.LittleEndian.Uint64(rest))
+	record.sentType = archiveTypeName(rest[8])
+	record.checksumOK = flags&archiveChecksumOK != 0
+	record.hasTick = flags&archiveHasTick != 0
+	record.tick = binary.LittleEndian.Uint32(rest[10:])
+	return record, nil
+}
+
+func (ar *ArchiveReader) Close() error {
+	return ar.file.Close()
+}
+
+type ArchiveIndexEntry struct {
+	hostTime time.Time
+	unixTime int64
+	offset   int64
+}
+
+func readArchiveIndex(path string) ([]ArchiveIndexEntry, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []ArchiveIndexEntry
+	for i := 0; i+archiveIndexEntrySize <= len(contents); i += archiveIndexEntrySize {
+		entries = append(entries, ArchiveIndexEntry{
+			hostTime: time.Unix(0, int64(binary.LittleEndian.Uint64(contents[i:]))).UTC(),
+			unixTime: int64(binary.LittleEndian.Uint64(contents[i+8:])),
+			offset:   int64(binary.LittleEndian.Uint64(contents[i+16:])),
+		})
+	}
+	return entries, nil
+}
+
+// archiveOffsetAt returns the offset of a record at or shortly before host time t (0 if t precedes
+// the index), from which the archive can be read forward
+func archiveOffsetAt(entries []ArchiveIndexEntry, t time.Time) int64 {
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].hostTime.After(t) })
+	if i == 0 {
+		return 0
+	}
+	return entries[i-1].offset
+}
+
+// convertArchiveToText writes the sentences in the archive that were received between from and to
+// (zero: no limit) in the text format of IotaGFT_LOG.txt, with the host time column unless the archive
+// is of version 1, which has no host monotonic times
+func convertArchiveToText(archivePath, indexPath, outPath string, from, to time.Time) (int, error) {
+	reader, err := openArchiveReader(archivePath)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	if !from.IsZero() {
+		entries, err := readArchiveIndex(indexPath)
+		if err != nil {
+			return 0, fmt.Errorf("convertArchiveToText(): %w", err)
+		}
+		if offset := archiveOffsetAt(entries, from); offset > 0 {
+			err = reader.SeekRecord(offset)
+			if err != nil {
+				return 0, fmt.Errorf("convertArchiveToText(): %w", err)
+			}
+		}
+	}
+
+	outputFile, err := os.Create(outPath)
+	if err != nil {
+		return 0, err
+	}
+	defer outputFile.Close()
+	writer := bufio.NewWriter(outputFile)
+	_, _ = writer.WriteString(fmt.Sprintf("First line of the IotaGFTapp %s GPS sentence log file\n", reader.appVersion))
+
+	count := 0
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("convertArchiveToText(): %w", err)
+		}
+		if !from.IsZero() && record.hostTime.Before(from) {
+			continue
+		}
+		if !to.IsZero() && record.hostTime.After(to) {
+			break
+		}
+		line := record.sentence
+		if reader.version != 1 {
+			line += hostTimeColumn(record.hostTime, record.hostMonotonic)
+		}
+		_, _ = writer.WriteString(line + "\n")
+		count++
+	}
+	err = writer.Flush()
+	if err != nil {
+		return count, err
+	}
+	return count, outputFile.Sync()
+}
+
+// startSentenceArchive starts the binary archive of the session in dir
+func startSentenceArchive(dir string) {
+	archive, err := newSentenceArchive(dir)
+	if err != nil {
+		filesLog.Error("binary sentence archive not started", "err", err)
+		return
+	}
+	myWin.archive = archive
+	filesLog.Info("binary sentence archive started", "dir", dir)
+}
+
+func stopSentenceArchive() {
+	if myWin.archive == nil {
+		return
+	}
+	err := myWin.archive.Close()
+	if err != nil {
+		filesLog.Error("binary sentence archive not closed", "err", err)
+	}
+	myWin.archive = nil
+}
+
+// processBinaryArchiveCheck starts or stops the archive of the current session
+func processBinaryArchiveCheck(checked bool) {
+	myWin.App.Preferences().SetBool("BinaryArchive", checked)
+	if checked && myWin.archive == nil && myWin.sessionDir != "" {
+		startSentenceArchive(myWin.sessionDir)
+	}
+	if !checked {
+		stopSentenceArchive()
+	}
+}
+
+// archiveSentence archives a line received from the GFT with the type that parseSentence gave it
+func archiveSentence(line, sentenceType string, hostTime time.Time) {
+	if myWin.archive == nil {
+		return
+	}
+	err := myWin.archive.WriteSentence(line, sentenceType, gpsData.unixTime, hostTime)
+	if err != nil {
+		filesLog.Error("sentence not archived", "err", err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestArchive(t *testing.T, dir string) []string {
+	archive, err := newSentenceArchive(dir)
+	assert.Nil(t, err)
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	var sentences []string
+	for second := 0; second < 10; second++ {
+		for i, sentence := range []string{
+			nmeaLine(int64(second)*1_000_000, "$GPRMC,000000.00,A,4000.0000,N,10500.0000,W,0.0,0.0,010324,,,D"),
+			gftLine("{0000000G $GPGGA,x}"), // no valid tick count
+			gftLine("{00000001 P}"),
+		} {
+			hostTime := start.Add(time.Duration(second)*time.Second + time.Duration(i)*time.Millisecond)
+			sentType := []string{"$GPRMC", "other", "P"}[i]
+			assert.Nil(t, archive.WriteSentence(sentence, sentType, 1709251200+int64(second), hostTime))
+			sentences = append(sentences, sentence)
+		}
+	}
+	assert.Nil(t, archive.Close())
+	return sentences
+}
+
+func Test_sentenceArchiveRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	sentences := writeTestArchive(t, dir)
+
+	reader, err := openArchiveReader(filepath.Join(dir, sentenceArchiveFile))
+	assert.Nil(t, err)
+	defer reader.Close()
+	assert.Equal(t, Version, reader.appVersion)
+
+	record, err := reader.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, sentences[0], record.sentence)
+	assert.Equal(t, "$GPRMC", record.sentType)
+	assert.True(t, record.checksumOK)
+	assert.True(t, record.hasTick)
+	assert.Equal(t, uint32(0), record.tick)
+	assert.Equal(t, int64(1709251200), record.unixTime)
+
+	record, _ = reader.Next()
+	assert.Equal(t, "other", record.sentType)
+	assert.False(t, record.hasTick)
+
+	count := 2
+	last := record
+	for ; ; count++ {
+		record, err = reader.Next()
+		if err != nil {
+			break
+		}
+		last = record
+	}
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 30, count)
+	assert.Equal(t, "P", last.sentType)
+	assert.Equal(t, uint32(1), last.tick)
+}
+
+func Test_sentenceArchiveVersion1(t *testing.T) {
+	// Version 1 records have no host monotonic time
+	sentence := gftLine("{00000001 P}")
+	archive := []byte(archiveMagic)
+	archive = binary.LittleEndian.AppendUint16(archive, 1)
+	archive = binary.LittleEndian.AppendUint16(archive, 4)
+	archive = append(archive, "3.02"...)
+	archive = binary.LittleEndian.AppendUint32(archive, uint32(len(sentence)))
+	archive = binary.LittleEndian.AppendUint64(archive, uint64(time.Date(2024, 3, 1, 0, 0, 5, 0, time.UTC).UnixNano()))
+	archive = binary.LittleEndian.AppendUint64(archive, 1709251205)
+	archive = append(archive, archiveTypeCode("P"), archiveChecksumOK|archiveHasTick)
+	archive = binary.LittleEndian.AppendUint32(archive, 1)
+	archive = append(archive, sentence...)
+	path := filepath.Join(t.TempDir(), sentenceArchiveFile)
+	assert.Nil(t, os.WriteFile(path, archive, 0644))
+
+	reader, err := openArchiveReader(path)
+	assert.Nil(t, err)
+	defer reader.Close()
+	assert.Equal(t, "3.02", reader.appVersion)
+	record, err := reader.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, sentence, record.sentence)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 5, 0, time.UTC), record.hostTime)
+	assert.Equal(t, time.Duration(0), record.hostMonotonic)
+	assert.Equal(t, int64(1709251205), record.unixTime)
+	assert.Equal(t, "P", record.sentType)
+	assert.True(t, record.checksumOK)
+	assert.Equal(t, uint32(1), record.tick)
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+
+	outPath := filepath.Join(t.TempDir(), "out.txt")
+	count, err := convertArchiveToText(path, "", outPath, time.Time{}, time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	contents, _ := os.ReadFile(outPath)
+	assert.Equal(t, "First line of the IotaGFTapp 3.02 GPS sentence log file\n"+sentence+"\n", string(contents))
+}
+
+func Test_sentenceArchiveTruncated(t *testing.T) {
+	dir := t.TempDir()
+	writeTestArchive(t, dir)
+	path := filepath.Join(dir, sentenceArchiveFile)
+	info, _ := os.Stat(path)
+	assert.Nil(t, os.Truncate(path, info.Size()-3)) // the app stopped while writing the last record
+
+	reader, err := openArchiveReader(path)
+	assert.Nil(t, err)
+	defer reader.Close()
+	count := 0
+	for ; ; count++ {
+		if _, err = reader.Next(); err != nil {
+			break
+		}
+	}
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 29, count)
+}
+
+func Test_convertArchiveToText(t *testing.T) {
+	dir := t.TempDir()
+	sentences := writeTestArchive(t, dir)
+
+	entries, err := readArchiveIndex(filepath.Join(dir, sentenceArchiveIndexFile))
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(entries))
+	assert.Equal(t, int64(0), archiveOffsetAt(entries, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.Equal(t, entries[4].offset, archiveOffsetAt(entries, time.Date(2024, 3, 1, 0, 0, 4, 500_000_000, time.UTC)))
+
+	outPath := filepath.Join(dir, "out.txt")
+	from := time.Date(2024, 3, 1, 0, 0, 4, 1_000_000, time.UTC)
+	to := time.Date(2024, 3, 1, 0, 0, 6, 0, time.UTC)
+	count, err := convertArchiveToText(filepath.Join(dir, sentenceArchiveFile), filepath.Join(dir, sentenceArchiveIndexFile), outPath, from, to)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, count) // the limits are inclusive
+
+	contents, _ := os.ReadFile(outPath)
+	lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+	assert.Equal(t, "First line of the IotaGFTapp "+Version+" GPS sentence log file", lines[0])
+	for i, line := range lines[1:] {
+		assert.Equal(t, sentences[13+i], stripHostTimeColumn(line))
+	}
+	assert.Equal(t, 6, len(lines[1:]))
+	assert.Contains(t, lines[1], "\t2024-03-01T00:00:04.001000Z ")
+
+	count, err = convertArchiveToText(filepath.Join(dir, sentenceArchiveFile), "", outPath, time.Time{}, time.Time{})
+	assert.Nil(t, err)
+	assert.Equal(t, 30, count)
+}
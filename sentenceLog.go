@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The sentence log is rotated when its active segment reaches either of these limits (changeable
+// through the SentenceLogMaxMB and SentenceLogMaxMinutes preferences)
+const (
+	defaultSentenceLogMaxMB      = 5
+	defaultSentenceLogMaxMinutes = 60
+)
+
+// Sentence log segments that overlap the recording window extended by this many seconds at each
+// end are delivered to the capture folder
+const sentenceLogMargin = 120
+
+const sentenceLogIndexFile = "IotaGFT_LOG_SEGMENTS.txt"
+
+// errSentenceLogBroken is returned for sentences that cannot be logged because the active segment could
+// not be reopened after a rotation. The failure itself is reported once, as an alert.
+var errSentenceLogBroken = errors.New("the sentence log is not open")
+
+type LogSegment struct {
+	name          string
+	firstUnixTime int64 // gpsData.unixTime of the first sentence in the segment (0 if unknown)
+	lastUnixTime  int64 // gpsData.unixTime of the last sentence in the segment (0 if unknown)
+}
+
+// A SentenceLog writes every GPS sentence to IotaGFT_LOG.txt. Once that active segment gets too big
+// or too old it is gzipped to IotaGFT_LOG.NNNN.txt.gz and a new active segment is started. The index
+// file lists every segment in order with the range of GPS times that it covers.
+type SentenceLog struct {
+	dir       string
+	file      *os.File
+	active    LogSegment
+	opened    time.Time
+	size      int64
+	maxSize   int64
+	maxAge    time.Duration
+	hostTimes bool         // append the host time column to every sentence (HostTimeColumn preference)
+	broken    bool         // the active segment is not open: reopening it is tried at every write
+	segments  []LogSegment // rolled segments
+}
+
+func newSentenceLog(dir string, maxSize int64, maxAge time.Duration) (*SentenceLog, error) {
+	sl := &SentenceLog{dir: dir, maxSize: maxSize, maxAge: maxAge}
+	err := sl.openActive()
+	if err != nil {
+		return nil, err
+	}
+	return sl, nil
+}
+
+// openActive starts a new active segment
+func (sl *SentenceLog) openActive() error {
+	sl.active = LogSegment{name: sentenceLogFile}
+	sl.opened = time.Now()
+	sl.size = 0
+	return sl.openFile()
+}
+
+// openFile opens the file of the active segment, appending to what it already holds
+func (sl *SentenceLog) openFile() error {
+	file, err := os.OpenFile(filepath.Join(sl.dir, sentenceLogFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("SentenceLog: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("SentenceLog: %w", err)
+	}
+	sl.file = file
+	sl.size = info.Size()
+	return nil
+}
+
+// markBroken records that the active segment is not open and reports it
+func (sl *SentenceLog) markBroken(err error) error {
+	sl.file = nil
+	sl.broken = true
+	raiseAlert(alertCritical, "The sentence log could not be reopened: sentences are not logged until it can be",
+		time.Now(), 0)
+	return fmt.Errorf("%w: %w", errSentenceLogBroken, err)
+}
+
+// WriteString writes s to the active segment without rotating it
+func (sl *SentenceLog) WriteString(s string) (int, error) {
+	if sl.broken {
+		if sl.openFile() != nil {
+			return 0, errSentenceLogBroken
+		}
+		sl.broken = false
+		filesLog.Info("sentence log reopened", "dir", sl.dir)
+	}
+	n, err := sl.file.WriteString(s)
+	sl.size += int64(n)
+	return n, err
+}
+
+// WriteSentence writes a sentence received at GPS time unixTime and host time hostTime, rotating the
+// active segment if it is due
+func (sl *SentenceLog) WriteSentence(sentence string, unixTime int64, hostTime time.Time) error {
+	if unixTime != 0 {
+		if sl.active.firstUnixTime == 0 {
+			sl.active.firstUnixTime = unixTime
+		}
+		sl.active.lastUnixTime = unixTime
+	}
+	if sl.hostTimes {
+		sentence += hostTimeColumn(hostTime, hostMonotonic(hostTime))
+	}
+	_, err := sl.WriteString(sentence + "\n")
+	if err != nil {
+		return err
+	}
+	if sl.size >= sl.maxSize || time.Since(sl.opened) >= sl.maxAge {
+		return sl.rotate()
+	}
+	return nil
+}
+
+// rotate rolls the active segment and starts a new one. If the active segment cannot be reopened the log
+// is marked as broken.
+func (sl *SentenceLog) rotate() error {
+	err := sl.file.Close()
+	if err != nil {
+		return sl.markBroken(fmt.Errorf("SentenceLog.rotate(): %w", err))
+	}
+
+	rolled := sl.active
+	rolled.name = fmt.Sprintf("IotaGFT_LOG.%04d.txt.gz", len(sl.segments)+1)
+	err = gzipFile(filepath.Join(sl.dir, sentenceLogFile), filepath.Join(sl.dir, rolled.name))
+	if err != nil {
+		// Keep logging into the (uncompressed) active segment rather than lose sentences
+		openErr := sl.openFile()
+		if openErr != nil {
+			return sl.markBroken(fmt.Errorf("SentenceLog.rotate(): %w", errors.Join(err, openErr)))
+		}
+		return fmt.Errorf("SentenceLog.rotate(): %w", err)
+	}
+	sl.segments = append(sl.segments, rolled)
+	filesLog.Info("sentence log segment rolled", "segment", rolled.name,
+		"firstUnixTime", rolled.firstUnixTime, "lastUnixTime", rolled.lastUnixTime)
+
+	err = sl.openActive()
+	if err != nil {
+		return sl.markBroken(err)
+	}
+	return sl.writeIndex()
+}
+
+func (sl *SentenceLog) writeIndex() error {
+	var sb strings.Builder
+	sb.WriteString("# segments of IotaGFT_LOG in order: name firstUnixTime lastUnixTime\n")
+	for _, segment := range append(sl.segments, sl.active) {
+		sb.WriteString(fmt.Sprintf("%s %d %d\n", segment.name, segment.firstUnixTime, segment.lastUnixTime))
+	}
+	return os.WriteFile(filepath.Join(sl.dir, sentenceLogIndexFile), []byte(sb.String()), 0644)
+}
+
+func (sl *SentenceLog) Close() error {
+	var err error
+	if sl.file != nil && !sl.broken {
+		err = sl.file.Close()
+	}
+	indexErr := sl.writeIndex()
+	if err == nil {
+		err = indexErr
+	}
+	return err
+}
+
+func gzipFile(sourcePath, destPath string) error {
+	inputFile, err := os.Open(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer inputFile.Close()
+
+	outputFile, err := os.Create(destPath)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(outputFile)
+	_, err = io.Copy(zw, inputFile)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = outputFile.Sync()
+	}
+	closeErr := outputFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(destPath)
+		return err
+	}
+	inputFile.Close() // for Windows, close before trying to remove
+	return os.Remove(sourcePath)
+}
+
+func readSentenceLogIndex(dir string) ([]LogSegment, error) {
+	file, err := os.Open(filepath.Join(dir, sentenceLogIndexFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		// A log that was never rotated consists of just the active segment
+		return []LogSegment{{name: sentenceLogFile}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var segments []LogSegment
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("readSentenceLogIndex(): malformed line: %s", line)
+		}
+		first, err1 := strconv.ParseInt(fields[1], 10, 64)
+		last, err2 := strconv.ParseInt(fields[2], 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("readSentenceLogIndex(): malformed line: %s", line)
+		}
+		segments = append(segments, LogSegment{name: fields[0], firstUnixTime: first, lastUnixTime: last})
+	}
+	return segments, scanner.Err()
+}
+
+// segmentsForWindow returns the names of the segments that overlap the GPS unix time window from..to.
+// A segment with unknown times is always included.
+func segmentsForWindow(segments []LogSegment, from, to int64) map[string]bool {
+	selected := map[string]bool{}
+	for _, segment := range segments {
+		if segment.firstUnixTime == 0 || segment.lastUnixTime == 0 ||
+			(segment.lastUnixTime >= from && segment.firstUnixTime <= to) {
+			selected[segment.name] = true
+		}
+	}
+	return selected
+}
+
+func isRolledSentenceLogSegment(name string) bool {
+	return strings.HasPrefix(name, "IotaGFT_LOG.") && strings.HasSuffix(name, ".txt.gz")
+}
+
+// reassembleSentenceLog concatenates the segments of the sentence log in dir, in order, into outPath.
+// Segments that are not present (because they were outside the recording window) are noted in the
+// output. It returns the number of missing segments.
+func reassembleSentenceLog(dir, outPath string) (int, error) {
+	segments, err := readSentenceLogIndex(dir)
+	if err != nil {
+		return 0, err
+	}
+	outputFile, err := os.Create(outPath)
+	if err != nil {
+		return 0, err
+	}
+	defer outputFile.Close()
+	writer := bufio.NewWriter(outputFile)
+
+	missing := 0
+	for _, segment := range segments {
+		err = appendSegment(writer, filepath.Join(dir, segment.name))
+		if errors.Is(err, fs.ErrNotExist) {
+			missing++
+			_, _ = writer.WriteString(fmt.Sprintf("# missing segment %s (GPS unixTime %d to %d)\n",
+				segment.name, segment.firstUnixTime, segment.lastUnixTime))
+			continue
+		}
+		if err != nil {
+			return missing, fmt.Errorf("reassembleSentenceLog(): %s: %w", segment.name, err)
+		}
+	}
+	err = writer.Flush()
+	if err != nil {
+		return missing, err
+	}
+	return missing, outputFile.Sync()
+}
+
+func appendSegment(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		reader = zr
+	}
+	_, err = io.Copy(w, reader)
+	return err
+}
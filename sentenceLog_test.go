@@ -0,0 +1,86 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_sentenceLogRotationAndReassembly(t *testing.T) {
+	dir := t.TempDir()
+	sl, err := newSentenceLog(dir, 200, time.Hour)
+	assert.Nil(t, err)
+	sl.hostTimes = true
+
+	var expected string
+	for i := int64(0); i < 10; i++ {
+		sentence := "{0033C29E $GPRMC,123456.00,A,3400.0,N,11800.0,W,0.0,,010324,,,A*6F}*3A"
+		hostTime := appStartTime.Add(time.Duration(i) * time.Second)
+		assert.Nil(t, sl.WriteSentence(sentence, 1_709_280_000+i, hostTime))
+		expected += sentence + hostTimeColumn(hostTime, time.Duration(i)*time.Second) + "\n"
+	}
+	assert.Nil(t, sl.Close())
+
+	segments, err := readSentenceLogIndex(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(segments)) // 5 rolled segments (2 sentences each) plus the empty active segment
+	assert.Equal(t, "IotaGFT_LOG.0001.txt.gz", segments[0].name)
+	assert.Equal(t, int64(1_709_280_000), segments[0].firstUnixTime)
+	assert.Equal(t, int64(1_709_280_001), segments[0].lastUnixTime)
+	assert.True(t, isRolledSentenceLogSegment(segments[0].name))
+	assert.False(t, isRolledSentenceLogSegment(sentenceLogFile))
+
+	outPath := filepath.Join(t.TempDir(), "joined.txt")
+	missing, err := reassembleSentenceLog(dir, outPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, missing)
+	joined, _ := os.ReadFile(outPath)
+	assert.Equal(t, expected, string(joined))
+
+	// Only the segments that overlap the window are selected
+	wanted := segmentsForWindow(segments, 1_709_280_003, 1_709_280_004)
+	assert.Equal(t, map[string]bool{"IotaGFT_LOG.0002.txt.gz": true, "IotaGFT_LOG.0003.txt.gz": true, sentenceLogFile: true}, wanted)
+
+	assert.Nil(t, os.Remove(filepath.Join(dir, "IotaGFT_LOG.0001.txt.gz")))
+	missing, err = reassembleSentenceLog(dir, outPath)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, missing)
+}
+
+func Test_sentenceLogWithoutHostTimes(t *testing.T) {
+	dir := t.TempDir()
+	sl, err := newSentenceLog(dir, 1<<20, time.Hour)
+	assert.Nil(t, err)
+	assert.Nil(t, sl.WriteSentence("{00000001 P}*77", 1_709_280_000, appStartTime))
+	assert.Nil(t, sl.Close())
+
+	contents, _ := os.ReadFile(filepath.Join(dir, sentenceLogFile))
+	assert.Equal(t, "{00000001 P}*77\n", string(contents))
+}
+
+func Test_sentenceLogBrokenByRotation(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "session")
+	assert.Nil(t, os.Mkdir(dir, 0755))
+	sl, err := newSentenceLog(dir, 10, time.Hour)
+	assert.Nil(t, err)
+	savedAlerts := alerts.alerts
+	t.Cleanup(func() { alerts.alerts = savedAlerts })
+
+	// Neither the rotation nor reopening the active segment can be done
+	assert.Nil(t, os.RemoveAll(dir))
+	err = sl.WriteSentence("{00000001 P}*77", 1_709_280_000, appStartTime)
+	assert.ErrorIs(t, err, errSentenceLogBroken)
+	assert.Nil(t, sl.file)
+	assert.Equal(t, alertCritical, alerts.alerts[len(alerts.alerts)-1].severity)
+	assert.Equal(t, errSentenceLogBroken, sl.WriteSentence("{00000002 P}*74", 1_709_280_001, appStartTime))
+
+	// Logging resumes once the active segment can be reopened
+	assert.Nil(t, os.Mkdir(dir, 0755))
+	sl.maxSize = 1 << 20
+	assert.Nil(t, sl.WriteSentence("{00000003 P}*75", 1_709_280_002, appStartTime))
+	assert.Nil(t, sl.Close())
+	contents, _ := os.ReadFile(filepath.Join(dir, sentenceLogFile))
+	assert.Equal(t, "{00000003 P}*75\n", string(contents))
+}
@@ -0,0 +1,662 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Sentence is one sentence from the GFT as decoded by decodeSentence. Decoding has no side effects:
+// applySentence makes the changes to gpsData, onePPSdata and the schedule that a sentence calls for.
+type Sentence interface {
+	// Kind is the sentence type used for display selection and the archive ($GPRMC, P, MODE, other ...)
+	Kind() string
+	// Text is what is displayed for the sentence (without its checksum)
+	Text() string
+	base() *sentenceBase
+}
+
+// sentenceBase holds what every sentence has: its text and any command response that was embedded in it
+type sentenceBase struct {
+	text             string
+	embeddedResponse string
+}
+
+func (b *sentenceBase) Text() string { return b.text }
+
+func (b *sentenceBase) base() *sentenceBase { return b }
+
+// timeOfDay is the UTC date and time given by an RMC or ZDA sentence
+type timeOfDay struct {
+	timeUTC  string
+	date     string // ddmmyy, as in an RMC sentence
+	hour     int
+	minute   int
+	second   int
+	year     int
+	month    int
+	day      int
+	unixTime int64 // the time of the sentence (the 1pps that follows it is a second later)
+}
+
+type RMCSentence struct {
+	sentenceBase
+	timeOfDay
+	valid        bool // GPRMC data is valid only if the status field is an 'A'
+	latitude     string
+	latDirection string
+	longitude    string
+	lonDirection string
+}
+
+func (s *RMCSentence) Kind() string { return "$GPRMC" }
+
+type GGASentence struct {
+	sentenceBase
+	latitude        string
+	latDirection    string
+	longitude       string
+	lonDirection    string
+	altitude        string // above mean sea level
+	altitudeUnits   string
+	geoidSeparation string  // height of the geoid (mean sea level) above the WGS84 ellipsoid, in altitudeUnits
+	fixQuality      int     // 0 no fix, 1 GPS, 2 differential ...
+	satellitesUsed  int     // satellites used in the fix
+	hdop            float64 // 0 when not reported
+}
+
+func (s *GGASentence) Kind() string { return "$GPGGA" }
+
+type DTMSentence struct {
+	sentenceBase
+}
+
+func (s *DTMSentence) Kind() string { return "$GPDTM" }
+
+// A ZDASentence gives the UTC date and time. Receivers without a fix send it with empty fields.
+type ZDASentence struct {
+	sentenceBase
+	timeOfDay
+	valid bool
+}
+
+func (s *ZDASentence) Kind() string { return "$GPZDA" }
+
+// The fix types of a GSA sentence
+const (
+	fixNone = 1
+	fix2D   = 2
+	fix3D   = 3
+)
+
+// A GSASentence gives the fix type, the satellites used and the dilutions of precision. A multi-constellation
+// receiver sends one for each constellation.
+type GSASentence struct {
+	sentenceBase
+	talker     string
+	systemID   int   // NMEA 4.10 GNSS system ID (1 GPS, 2 GLONASS, 3 Galileo, 4 BeiDou), 0 when not sent
+	fixType    int   // fixNone, fix2D or fix3D
+	satellites []int // PRNs of the satellites used
+	pdop       float64
+	hdop       float64
+	vdop       float64
+}
+
+func (s *GSASentence) Kind() string { return "$GPGSA" }
+
+// SatelliteInView is one satellite of a GSV sentence
+type SatelliteInView struct {
+	prn       int
+	elevation int // degrees, -1 when not reported
+	azimuth   int // degrees, -1 when not reported
+	snr       int // dB-Hz, -1 when the satellite is not tracked
+}
+
+// A GSVSentence is one of a group of sentences that together list the satellites in view of a constellation
+type GSVSentence struct {
+	sentenceBase
+	talker     string // GP, GL, GA ... : the constellation
+	messages   int    // sentences in the group
+	message    int    // number of this sentence in the group, from 1
+	inView     int    // satellites in view of the constellation
+	signalID   int    // NMEA 4.10 signal ID, 0 when not sent
+	satellites []SatelliteInView
+}
+
+func (s *GSVSentence) Kind() string { return "$GPGSV" }
+
+// A GSVGroup identifies a group of GSV sentences: an NMEA 4.10 receiver sends a group for each signal
+// (L1, L2 ...) of each constellation, listing the same satellites
+type GSVGroup struct {
+	talker   string
+	signalID int
+}
+
+type PUBX04Sentence struct {
+	sentenceBase
+	gpsUtcOffset string // as reported: ends in D until the receiver has the almanac
+}
+
+func (s *PUBX04Sentence) Kind() string { return "$PUBX" }
+
+type ModeSentence struct {
+	sentenceBase
+	status string
+}
+
+func (s *ModeSentence) Kind() string { return "MODE" }
+
+// The kinds of PulseSentence
+const (
+	pulsePPS      = 'P' // 1pps
+	pulseFlashOn  = '+'
+	pulseFlashOff = '!'
+	pulseEvent    = 'E' // external event input
+)
+
+// A PulseSentence reports the GFT tick count at a 1pps, a flash edge or an event
+type PulseSentence struct {
+	sentenceBase
+	kind      byte
+	tickCount int64
+}
+
+func (s *PulseSentence) Kind() string {
+	switch s.kind {
+	case pulsePPS:
+		return "P"
+	case pulseEvent:
+		return "E"
+	default:
+		return "+" // flash on and flash off
+	}
+}
+
+// A CommandResponseSentence is the GFT's response to a command, such as [CMD ...] or [ ... ]
+type CommandResponseSentence struct {
+	sentenceBase
+}
+
+func (s *CommandResponseSentence) Kind() string { return "other" }
+
+// isStart tells whether the sentence is the [STARTING!] the GFT sends when it starts, rather than a response
+func (s *CommandResponseSentence) isStart() bool { return strings.Contains(s.text, "[STARTING!]") }
+
+type ErrorSentence struct {
+	sentenceBase
+}
+
+func (s *ErrorSentence) Kind() string { return "other" }
+
+// An UnknownSentence is any other sentence. It is displayed but not processed.
+type UnknownSentence struct {
+	sentenceBase
+}
+
+func (s *UnknownSentence) Kind() string { return "other" }
+
+// sentenceKind returns the Kind of s, or "" if no sentence was decoded
+func sentenceKind(s Sentence) string {
+	if s == nil {
+		return ""
+	}
+	return s.Kind()
+}
+
+// A FieldError reports a field of a sentence that is missing or cannot be decoded
+type FieldError struct {
+	Sentence string // sentence type, such as $GPRMC
+	Field    string
+	Value    string
+	Err      error // errFieldMissing or errFieldFormat
+}
+
+var (
+	errFieldMissing = errors.New("missing")
+	errFieldFormat  = errors.New("badly formed")
+	errNoDecoder    = errors.New("no decoder enabled")
+)
+
+func (e *FieldError) Error() string {
+	if errors.Is(e.Err, errFieldMissing) {
+		return fmt.Sprintf("decodeSentence(): %s %s field is missing", e.Sentence, e.Field)
+	}
+	return fmt.Sprintf("decodeSentence(): %s %s field %q is %v", e.Sentence, e.Field, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// field returns parts[i], the field called name of a sentence
+func field(parts []string, i int, sentence, name string) (string, error) {
+	if i >= len(parts) {
+		return "", &FieldError{Sentence: sentence, Field: name, Err: errFieldMissing}
+	}
+	return parts[i], nil
+}
+
+// digitsField returns value[from:to] as a number. It must be all decimal digits.
+func digitsField(value string, from, to int, sentence, name string) (int, error) {
+	if len(value) < to {
+		return 0, &FieldError{Sentence: sentence, Field: name, Value: value, Err: errFieldFormat}
+	}
+	number := 0
+	for _, c := range []byte(value[from:to]) {
+		if c < '0' || c > '9' {
+			return 0, &FieldError{Sentence: sentence, Field: name, Value: value, Err: errFieldFormat}
+		}
+		number = number*10 + int(c-'0')
+	}
+	return number, nil
+}
+
+// coordinateField checks a latitude (ddmm.mm, degreeDigits 2) or longitude (dddmm.mm, degreeDigits 3):
+// an empty field (no fix) is allowed, otherwise it must start with its degrees and whole minutes
+func coordinateField(value string, degreeDigits int, sentence, name string) error {
+	if value == "" {
+		return nil
+	}
+	_, err := digitsField(value, 0, degreeDigits+2, sentence, name)
+	return err
+}
+
+// optionalInt returns the number in parts[i], or missing if the field is empty
+func optionalInt(parts []string, i int, missing int, sentence, name string) (int, error) {
+	value, err := field(parts, i, sentence, name)
+	if err != nil || value == "" {
+		return missing, err
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, &FieldError{Sentence: sentence, Field: name, Value: value, Err: errFieldFormat}
+	}
+	return number, nil
+}
+
+// dopField returns the dilution of precision in parts[i], or 0 if the field is empty
+func dopField(parts []string, i int, sentence, name string) (float64, error) {
+	value, err := field(parts, i, sentence, name)
+	if err != nil || value == "" {
+		return 0, err
+	}
+	dop, err := strconv.ParseFloat(value, 64)
+	if err != nil || dop < 0 {
+		return 0, &FieldError{Sentence: sentence, Field: name, Value: value, Err: errFieldFormat}
+	}
+	return dop, nil
+}
+
+// nmeaTalkers are the talker IDs of the sentences decoded: GPS, any combination of constellations (GN),
+// GLONASS, Galileo and BeiDou
+var nmeaTalkers = []string{"GP", "GN", "GL", "GA", "GB", "BD"}
+
+// nmeaSentenceID splits an NMEA address field such as $GNRMC into its talker (GN) and the sentence ID
+// written with the GP talker ($GPRMC), which is how sentences are known whichever talker sent them.
+// An address with an unknown talker is returned unchanged.
+func nmeaSentenceID(address string) (string, string) {
+	if len(address) != 6 || address[0] != '$' {
+		return "", address
+	}
+	for _, talker := range nmeaTalkers {
+		if address[1:3] == talker {
+			return talker, "$GP" + address[3:]
+		}
+	}
+	return "", address
+}
+
+// splitChecksum splits a line as received into the sentence and its trailing checksum (*xx)
+func splitChecksum(line string) (string, string, error) {
+	n := len(line)
+	if n < 3 {
+		return "", "", fmt.Errorf("splitChecksum(): %q is too short to have a checksum", line)
+	}
+	return line[:n-3], line[n-3:], nil
+}
+
+// decodeSentence decodes a sentence (without its trailing checksum, which is given separately)
+func decodeSentence(sentence, checksum string) (Sentence, error) {
+	chkSum, _ := calcChecksum(sentence)
+	if chkSum != checksum {
+		return nil, fmt.Errorf("decodeSentence() found bad checksum %s (calculated %s) in %s", checksum, chkSum, sentence)
+	}
+
+	// Test for an embedded command response in the sentence (assumed to be an NMEA). It is removed.
+	base := sentenceBase{text: sentence}
+	parts := strings.Split(sentence, "[]")
+	if len(parts) == 3 {
+		sentence = parts[0] + parts[2]
+		base = sentenceBase{text: sentence, embeddedResponse: parts[1]}
+	}
+
+	if strings.HasPrefix(sentence, ubxTextPrefix) {
+		return decodeUBX(sentence, base)
+	}
+
+	if strings.Contains(sentence, "$") {
+		return decodeNMEA(sentence, base)
+	}
+
+	if strings.Contains(sentence, "MODE") {
+		parts := strings.Split(sentence, " ")
+		if len(parts) < 2 {
+			return nil, errors.New("decodeSentence(): split of MODE sentence on space did not give 2 parts")
+		}
+		if len(sentence) < len("{MODE }") {
+			return nil, &FieldError{Sentence: "MODE", Field: "status", Value: sentence, Err: errFieldMissing}
+		}
+		return &ModeSentence{sentenceBase: base, status: sentence[6 : len(sentence)-1]}, nil
+	}
+
+	var kind byte
+	switch {
+	case strings.Contains(sentence, "P}"):
+		kind = pulsePPS
+	case strings.Contains(sentence, "+}"):
+		kind = pulseFlashOn
+	case strings.Contains(sentence, "!}"):
+		kind = pulseFlashOff
+	case strings.Contains(sentence, "E}"):
+		kind = pulseEvent
+	}
+	if kind != 0 {
+		parts := strings.Split(sentence, " ")
+		if len(parts) < 2 {
+			return nil, errors.New("decodeSentence(): split of P sentence on space did not give 2 parts")
+		}
+		if len(parts[0]) < 2 || parts[0][0] != '{' {
+			return nil, &FieldError{Sentence: "P", Field: "tick count", Value: parts[0], Err: errFieldFormat}
+		}
+		value, err := strconv.ParseUint(parts[0][1:], 16, 32)
+		if err != nil {
+			return nil, &FieldError{Sentence: "P", Field: "tick count", Value: parts[0], Err: errFieldFormat}
+		}
+		return &PulseSentence{sentenceBase: base, kind: kind, tickCount: int64(value)}, nil
+	}
+
+	// {ERROR ...}  [CMD ...] and [ ... ] (command responses) are displayed but not processed
+	switch {
+	case strings.HasPrefix(sentence, "["):
+		return &CommandResponseSentence{sentenceBase: base}, nil
+	case strings.Contains(sentence, "ERROR"):
+		return &ErrorSentence{sentenceBase: base}, nil
+	}
+	return &UnknownSentence{sentenceBase: base}, nil
+}
+
+func decodeNMEA(sentence string, base sentenceBase) (Sentence, error) {
+	parts := strings.Split(sentence, " ")
+	if len(parts) < 2 {
+		return nil, errors.New("decodeSentence(): split of $ sentence on space did not give 2 parts")
+	}
+
+	// 'payload' removes the leading "{000C97C7 " and the trailing "}". What is left should be standard nmea frame
+	// with leading $ and trailing checksum
+	payload := removeTrailingCharacter(parts[1])
+	if !isChecksumValid(payload) {
+		return nil, errors.New("decodeSentence() found bad checksum in " + payload)
+	}
+
+	// The fields end at the checksum
+	parts = strings.Split(payload[:strings.LastIndexByte(payload, '*')], ",")
+	talker, id := nmeaSentenceID(parts[0])
+	switch id {
+	case "$GPGGA":
+		return decodeGGA(parts, base)
+	case "$GPRMC":
+		return decodeRMC(parts, base)
+	case "$GPDTM":
+		return &DTMSentence{sentenceBase: base}, nil
+	case "$GPZDA":
+		return decodeZDA(parts, base)
+	case "$GPGSA":
+		return decodeGSA(parts, base, talker)
+	case "$GPGSV":
+		return decodeGSV(parts, base, talker)
+	case "$PUBX":
+		if id, _ := field(parts, 1, "$PUBX", "message id"); id != "04" {
+			return nil, fmt.Errorf("decodeSentence(): %w for %s", errNoDecoder, payload)
+		}
+		offset, err := field(parts, 6, "$PUBX", "GpsUtcOffset")
+		if err != nil {
+			return nil, err
+		}
+		if _, err = parseGpsUtcOffset(offset); err != nil {
+			return nil, &FieldError{Sentence: "$PUBX", Field: "GpsUtcOffset", Value: offset, Err: errFieldFormat}
+		}
+		return &PUBX04Sentence{sentenceBase: base, gpsUtcOffset: offset}, nil
+	default:
+		return nil, fmt.Errorf("decodeSentence(): %w for %s", errNoDecoder, payload)
+	}
+}
+
+func decodeGGA(parts []string, base sentenceBase) (Sentence, error) {
+	altitude, err := field(parts, 9, "$GPGGA", "altitude")
+	if err != nil {
+		return nil, err
+	}
+	units, err := field(parts, 10, "$GPGGA", "altitude units")
+	if err != nil {
+		return nil, err
+	}
+	gga := &GGASentence{sentenceBase: base, altitude: altitude, altitudeUnits: units}
+	names := []string{"latitude", "N/S", "longitude", "E/W"}
+	for i, value := range []*string{&gga.latitude, &gga.latDirection, &gga.longitude, &gga.lonDirection} {
+		if *value, err = field(parts, i+2, "$GPGGA", names[i]); err != nil {
+			return nil, err
+		}
+	}
+	if err = coordinateField(gga.latitude, 2, "$GPGGA", "latitude"); err != nil {
+		return nil, err
+	}
+	if err = coordinateField(gga.longitude, 3, "$GPGGA", "longitude"); err != nil {
+		return nil, err
+	}
+	if len(parts) > 11 {
+		gga.geoidSeparation = parts[11]
+	}
+	if gga.fixQuality, err = optionalInt(parts, 6, 0, "$GPGGA", "fix quality"); err != nil {
+		return nil, err
+	}
+	if gga.satellitesUsed, err = optionalInt(parts, 7, 0, "$GPGGA", "satellites used"); err != nil {
+		return nil, err
+	}
+	if gga.hdop, err = dopField(parts, 8, "$GPGGA", "HDOP"); err != nil {
+		return nil, err
+	}
+	return gga, nil
+}
+
+func decodeRMC(parts []string, base sentenceBase) (Sentence, error) {
+	status, err := field(parts, 2, "$GPRMC", "status")
+	if err != nil {
+		return nil, err
+	}
+	rmc := &RMCSentence{sentenceBase: base, valid: status == "A"}
+	if !rmc.valid {
+		return rmc, nil
+	}
+
+	names := []string{"time", "status", "latitude", "N/S", "longitude", "E/W"}
+	values := []*string{&rmc.timeUTC, nil, &rmc.latitude, &rmc.latDirection, &rmc.longitude, &rmc.lonDirection}
+	for i, value := range values {
+		if value != nil {
+			if *value, err = field(parts, i+1, "$GPRMC", names[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err = coordinateField(rmc.latitude, 2, "$GPRMC", "latitude"); err != nil {
+		return nil, err
+	}
+	if err = coordinateField(rmc.longitude, 3, "$GPRMC", "longitude"); err != nil {
+		return nil, err
+	}
+	if rmc.date, err = field(parts, 9, "$GPRMC", "date"); err != nil {
+		return nil, err
+	}
+
+	for _, f := range []struct {
+		value    *int
+		from, to int
+		text     string
+		name     string
+	}{
+		{&rmc.day, 0, 2, rmc.date, "date"},
+		{&rmc.month, 2, 4, rmc.date, "date"},
+		{&rmc.year, 4, 6, rmc.date, "date"},
+	} {
+		if *f.value, err = digitsField(f.text, f.from, f.to, "$GPRMC", f.name); err != nil {
+			return nil, err
+		}
+	}
+	rmc.year += 2000
+	if err = rmc.timeOfDay.decodeTime("$GPRMC"); err != nil {
+		return nil, err
+	}
+	return rmc, nil
+}
+
+// decodeTime decodes timeUTC (hhmmss.ss) and sets unixTime from it and the date
+func (t *timeOfDay) decodeTime(sentence string) error {
+	var err error
+	for _, f := range []struct {
+		value    *int
+		from, to int
+	}{
+		{&t.hour, 0, 2},
+		{&t.minute, 2, 4},
+		{&t.second, 4, 6},
+	} {
+		if *f.value, err = digitsField(t.timeUTC, f.from, f.to, sentence, "time"); err != nil {
+			return err
+		}
+	}
+	t.unixTime = time.Date(t.year, time.Month(t.month), t.day, t.hour, t.minute, t.second, 0, time.UTC).Unix()
+	return nil
+}
+
+func decodeZDA(parts []string, base sentenceBase) (Sentence, error) {
+	zda := &ZDASentence{sentenceBase: base}
+	var err error
+	if zda.timeUTC, err = field(parts, 1, "$GPZDA", "time"); err != nil {
+		return nil, err
+	}
+	if zda.timeUTC == "" {
+		return zda, nil // no time yet
+	}
+	for _, f := range []struct {
+		value  *int
+		index  int
+		digits int
+		name   string
+	}{
+		{&zda.day, 2, 2, "day"},
+		{&zda.month, 3, 2, "month"},
+		{&zda.year, 4, 4, "year"},
+	} {
+		value, err := field(parts, f.index, "$GPZDA", f.name)
+		if err != nil {
+			return nil, err
+		}
+		if len(value) != f.digits {
+			return nil, &FieldError{Sentence: "$GPZDA", Field: f.name, Value: value, Err: errFieldFormat}
+		}
+		if *f.value, err = digitsField(value, 0, f.digits, "$GPZDA", f.name); err != nil {
+			return nil, err
+		}
+	}
+	if zda.month < 1 || zda.month > 12 || zda.day < 1 || zda.day > 31 {
+		return nil, &FieldError{Sentence: "$GPZDA", Field: "date", Value: strings.Join(parts[2:5], ","), Err: errFieldFormat}
+	}
+	zda.date = fmt.Sprintf("%02d%02d%02d", zda.day, zda.month, zda.year%100)
+	if err = zda.timeOfDay.decodeTime("$GPZDA"); err != nil {
+		return nil, err
+	}
+	zda.valid = true
+	return zda, nil
+}
+
+func decodeGSA(parts []string, base sentenceBase, talker string) (Sentence, error) {
+	gsa := &GSASentence{sentenceBase: base, talker: talker}
+	var err error
+	if gsa.fixType, err = optionalInt(parts, 2, fixNone, "$GPGSA", "fix type"); err != nil {
+		return nil, err
+	}
+	for i := 3; i < 15; i++ {
+		prn, err := optionalInt(parts, i, 0, "$GPGSA", "satellite")
+		if err != nil {
+			return nil, err
+		}
+		if prn != 0 {
+			gsa.satellites = append(gsa.satellites, prn)
+		}
+	}
+	for _, f := range []struct {
+		value *float64
+		index int
+		name  string
+	}{
+		{&gsa.pdop, 15, "PDOP"},
+		{&gsa.hdop, 16, "HDOP"},
+		{&gsa.vdop, 17, "VDOP"},
+	} {
+		if *f.value, err = dopField(parts, f.index, "$GPGSA", f.name); err != nil {
+			return nil, err
+		}
+	}
+	if len(parts) > 18 {
+		if gsa.systemID, err = optionalInt(parts, 18, 0, "$GPGSA", "system ID"); err != nil {
+			return nil, err
+		}
+	}
+	return gsa, nil
+}
+
+func decodeGSV(parts []string, base sentenceBase, talker string) (Sentence, error) {
+	gsv := &GSVSentence{sentenceBase: base, talker: talker}
+	var err error
+	for _, f := range []struct {
+		value *int
+		index int
+		name  string
+	}{
+		{&gsv.messages, 1, "number of messages"},
+		{&gsv.message, 2, "message number"},
+		{&gsv.inView, 3, "satellites in view"},
+	} {
+		if *f.value, err = optionalInt(parts, f.index, 0, "$GPGSV", f.name); err != nil {
+			return nil, err
+		}
+	}
+	// Up to four satellites of prn, elevation, azimuth and SNR. NMEA 4.10 adds a signal ID at the end.
+	for i := 4; i+3 < len(parts); i += 4 {
+		var sat SatelliteInView
+		for _, f := range []struct {
+			value  *int
+			offset int
+			name   string
+		}{
+			{&sat.prn, 0, "satellite"},
+			{&sat.elevation, 1, "elevation"},
+			{&sat.azimuth, 2, "azimuth"},
+			{&sat.snr, 3, "SNR"},
+		} {
+			if *f.value, err = optionalInt(parts, i+f.offset, -1, "$GPGSV", f.name); err != nil {
+				return nil, err
+			}
+		}
+		if sat.prn > 0 {
+			gsv.satellites = append(gsv.satellites, sat)
+		}
+	}
+	if signal := parts[len(parts)-1]; (len(parts)-4)%4 == 1 && signal != "" {
+		id, err := strconv.ParseUint(signal, 16, 8)
+		if err != nil {
+			return nil, &FieldError{Sentence: "$GPGSV", Field: "signal ID", Value: signal, Err: errFieldFormat}
+		}
+		gsv.signalID = int(id)
+	}
+	return gsv, nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// decodeLine decodes a line as received, checksum included
+func decodeLine(line string) (Sentence, error) {
+	sentence, checksum, err := splitChecksum(line)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSentence(sentence, checksum)
+}
+
+func Test_decodeSentence(t *testing.T) {
+	s, err := decodeLine(nmeaLine(0x1234, "$GPRMC,123456.00,A,4000.0000,N,10500.0000,W,0.0,0.0,010324,,,D"))
+	assert.Nil(t, err)
+	rmc, ok := s.(*RMCSentence)
+	assert.True(t, ok)
+	assert.Equal(t, "$GPRMC", rmc.Kind())
+	assert.True(t, rmc.valid)
+	assert.Equal(t, "4000.0000", rmc.latitude)
+	assert.Equal(t, "W", rmc.lonDirection)
+	assert.Equal(t, int64(1709296496), rmc.unixTime) // 2024-03-01 12:34:56
+
+	s, _ = decodeLine(nmeaLine(0x1234, "$GPRMC,123456.00,V,,,,,,,010324,,,N"))
+	assert.False(t, s.(*RMCSentence).valid)
+
+	s, err = decodeLine(nmeaLine(0x1234, "$GPGGA,123456.00,4000.0000,N,10500.0000,W,1,08,1.0,1609.3,M,-20.0,M,,"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1609.3", s.(*GGASentence).altitude)
+	assert.Equal(t, "M", s.(*GGASentence).altitudeUnits)
+
+	s, err = decodeLine(nmeaLine(0x1234, "$PUBX,04,123456.00,010324,0.00,2303,16D,0,0,"))
+	assert.Nil(t, err)
+	assert.Equal(t, "16D", s.(*PUBX04Sentence).gpsUtcOffset)
+
+	s, err = decodeLine(gftLine("{000C97C7 P}"))
+	assert.Nil(t, err)
+	pulse := s.(*PulseSentence)
+	assert.Equal(t, byte(pulsePPS), pulse.kind)
+	assert.Equal(t, int64(0x000C97C7), pulse.tickCount)
+	assert.Equal(t, "{000C97C7 P}", pulse.Text())
+
+	s, _ = decodeLine(gftLine("{000C97C7 !}"))
+	assert.Equal(t, byte(pulseFlashOff), s.(*PulseSentence).kind)
+	assert.Equal(t, "+", s.Kind())
+	s, _ = decodeLine(gftLine("{000C97C7 E}"))
+	assert.Equal(t, "E", s.Kind())
+
+	s, err = decodeLine(gftLine("{MODE 1pps}"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1pps", s.(*ModeSentence).status)
+
+	s, _ = decodeLine(gftLine("[CMD flash now]"))
+	assert.IsType(t, &CommandResponseSentence{}, s)
+	s, _ = decodeLine(gftLine("{ERROR no 1pps}"))
+	assert.IsType(t, &ErrorSentence{}, s)
+	s, _ = decodeLine(gftLine("[STARTING!]"))
+	assert.Equal(t, "other", s.Kind())
+
+	// An embedded command response is taken out of the NMEA sentence
+	line := nmeaLine(0x1234, "$GPDTM,W84,,0.0,N,0.0,E,0.0,W84")
+	inner := line[:len(line)-3]
+	embedded := gftLine(inner[:10] + "[][flash now][]" + inner[10:])
+	s, err = decodeLine(embedded)
+	assert.Nil(t, err)
+	assert.Equal(t, "$GPDTM", s.Kind())
+	assert.Equal(t, "[flash now]", s.base().embeddedResponse)
+	assert.Equal(t, inner, s.Text())
+
+	_, err = decodeSentence("{000C97C7 P}", "*00")
+	assert.NotNil(t, err)
+	_, err = decodeLine(nmeaLine(0x1234, "$GPZZZ,1"))
+	assert.NotNil(t, err)
+	assert.Equal(t, "", sentenceKind(nil))
+}
+
+func Test_applyPulseSentence(t *testing.T) {
+	savedData, savedEdges := onePPSdata, flashEdges
+	savedFirst, savedLast, savedLeader := myWin.gotFirst1PPS, myWin.lastPvalue, myWin.pastLeader
+	defer func() {
+		onePPSdata, flashEdges = savedData, savedEdges
+		myWin.gotFirst1PPS, myWin.lastPvalue, myWin.pastLeader = savedFirst, savedLast, savedLeader
+	}()
+	onePPSdata, flashEdges = OnePPSdata{}, nil
+	myWin.gotFirst1PPS, myWin.pastLeader = false, true
+
+	gpsInfo := GPSdata{utcTimestamp: "2024-03-01T00:00:05.000000"}
+	for _, line := range []string{"{FFFFFF00 P}", "{000F4100 +}", "{000F4140 P}"} {
+		s, err := decodeLine(gftLine(line))
+		assert.Nil(t, err)
+		applySentence(s, &gpsInfo)
+	}
+	assert.Equal(t, 2, len(onePPSdata.tickStamp))
+	assert.Equal(t, int64(0xFFFFFF00+1_000_000), onePPSdata.tickStamp[1].runningTickTime) // the tick count wrapped
+	assert.Equal(t, []FlashEdge{{edgeTime: 0xFFFFFF00 + 999_936, on: true}}, flashEdges)
+}
+
+func Test_decodeMalformedSentences(t *testing.T) {
+	for _, line := range []string{
+		nmeaLine(1, "$GPGGA,123456.00,4000.0000,N"),
+		nmeaLine(1, "$GPRMC,12,A,4000.0000,N,10500.0000,W,0.0,0.0,010324,,,D"),
+		nmeaLine(1, "$GPRMC,123456.00,A,4000.0000,N,10500.0000,W,0.0,0.0,0103,,,D"),
+		nmeaLine(1, "$GPRMC,1234x6.00,A,4000.0000,N,10500.0000,W,0.0,0.0,010324,,,D"),
+		nmeaLine(1, "$GPRMC,123456.00,A"),
+		nmeaLine(1, "$GPRMC,123456.00,A,4,N,10500.0000,W,0.0,0.0,010324,,,D"),
+		nmeaLine(1, "$GPRMC,123456.00,A,4000.0000,N,105,W,0.0,0.0,010324,,,D"),
+		nmeaLine(1, "$GPGGA,123456.00,40,N,10500.0000,W,1,08,1.0,1609.3,M,-20.0,M,,"),
+		nmeaLine(1, "$GPGGA,123456.00,4000.0000,N,1050,W,1,08,1.0,1609.3,M,-20.0,M,,"),
+		nmeaLine(1, "$PUBX,04,123456.00"),
+		nmeaLine(1, "$PUBX,04,123456.00,010324,0.00,2303,xx,0,0,"),
+	} {
+		_, err := decodeLine(line)
+		var fieldErr *FieldError
+		assert.ErrorAs(t, err, &fieldErr, line)
+	}
+
+	_, err := decodeLine(gftLine("{MODE"))
+	assert.NotNil(t, err)
+	_, err = decodeLine(gftLine(" P}"))
+	assert.NotNil(t, err)
+	_, err = decodeLine(gftLine("{123456789 P}"))
+	assert.NotNil(t, err)
+	_, err = decodeLine(gftLine("{0 $"))
+	assert.NotNil(t, err)
+	_, err = decodeLine("*0")
+	assert.NotNil(t, err)
+}
+
+var sentenceSeeds = []string{
+	nmeaLine(0x1234, "$GPRMC,123456.00,A,4000.0000,N,10500.0000,W,0.0,0.0,010324,,,D"),
+	nmeaLine(0x1234, "$GPGGA,123456.00,4000.0000,N,10500.0000,W,1,08,1.0,1609.3,M,-20.0,M,,"),
+	nmeaLine(0x1234, "$PUBX,04,123456.00,010324,0.00,2303,18,0,0,"),
+	nmeaLine(0x1234, "$PUBX,04,123456.00,010324,0.00,2303,16D,0,0,"),
+	nmeaLine(0x1234, "$PUBX,04,123456.00,010324,0.00,2303,19,0,0,"),
+	nmeaLine(0x1234, "$GPDTM,W84,,0.0,N,0.0,E,0.0,W84"),
+	nmeaLine(0x1234, "$GPRMC,123456.00,A,4,N,1,W,0.0,0.0,010324,,,D"),
+	nmeaLine(0x1234, "$GPGGA,123456.00,40,N,105,W,1,08,1.0,1609.3,M,-20.0,M,,"),
+	nmeaLine(0x1234, "$GPGGA,123456.00,,,,,0,00,,,M,,M,,"),
+	gftLine("{000C97C7 P}"),
+	gftLine("{000C97C7 +}"),
+	gftLine("{MODE 1pps}"),
+	gftLine("[CMD flash now]"),
+	UBXFrame{class: ubxClassTIM, id: ubxIDTimTP, payload: make([]byte, 16)}.text(),
+	UBXFrame{class: ubxClassNAV, id: ubxIDNavTimeUTC, payload: make([]byte, 20)}.text(),
+	"",
+}
+
+// FuzzParseSentence checks that no line, however garbled, makes decoding or applying it panic
+func FuzzParseSentence(f *testing.F) {
+	for _, seed := range sentenceSeeds {
+		f.Add(seed)
+	}
+	savedData, savedEdges, savedGpsData := onePPSdata, flashEdges, gpsData
+	savedFirst, savedLast, savedSave := myWin.gotFirst1PPS, myWin.lastPvalue, saveGpsUtcOffset
+	defer func() {
+		onePPSdata, flashEdges, gpsData = savedData, savedEdges, savedGpsData
+		myWin.gotFirst1PPS, myWin.lastPvalue, saveGpsUtcOffset = savedFirst, savedLast, savedSave
+	}()
+	// A new GpsUtcOffset would be saved in the preferences, which the fuzz workers share
+	saveGpsUtcOffset = func(string) {}
+
+	f.Fuzz(func(t *testing.T, line string) {
+		onePPSdata, flashEdges = OnePPSdata{}, nil
+		myWin.gotFirst1PPS, myWin.lastPvalue = false, 0
+		gpsInfo := GPSdata{unixTime: 1709251200, utcTimestamp: "2024-03-01T00:00:00.000000",
+			date: "010324", year: 2024, month: 3, day: 1} // so that a PUBX,04 recalculates the UTC time
+
+		sentence, checksum, err := splitChecksum(line)
+		if err != nil {
+			return
+		}
+		s, err := decodeSentence(sentence, checksum)
+		if err != nil {
+			assert.Nil(t, s)
+			return
+		}
+		applySentence(s, &gpsInfo)
+		assert.NotEqual(t, "", s.Kind())
+		_ = s.Text()
+	})
+}
+
+func Test_decodeMultiConstellation(t *testing.T) {
+	// Other talkers decode as the GP sentences
+	s, err := decodeLine(nmeaLine(0x1234, "$GNRMC,123456.00,A,4000.0000,N,10500.0000,W,0.0,0.0,010324,,,D,V"))
+	assert.Nil(t, err)
+	assert.Equal(t, "$GPRMC", s.Kind())
+	assert.Equal(t, int64(1709296496), s.(*RMCSentence).unixTime)
+
+	s, err = decodeLine(nmeaLine(0x1234, "$GNGGA,123456.00,4000.0000,N,10500.0000,W,1,12,0.87,1609.3,M,-20.0,M,,"))
+	assert.Nil(t, err)
+	gga := s.(*GGASentence)
+	assert.Equal(t, 1, gga.fixQuality)
+	assert.Equal(t, 12, gga.satellitesUsed)
+	assert.Equal(t, 0.87, gga.hdop)
+
+	s, err = decodeLine(nmeaLine(0x1234, "$GNZDA,123456.00,01,03,2024,00,00"))
+	assert.Nil(t, err)
+	zda := s.(*ZDASentence)
+	assert.Equal(t, "$GPZDA", zda.Kind())
+	assert.True(t, zda.valid)
+	assert.Equal(t, "010324", zda.date)
+	assert.Equal(t, int64(1709296496), zda.unixTime)
+
+	s, err = decodeLine(nmeaLine(0x1234, "$GPZDA,,,,,00,00"))
+	assert.Nil(t, err)
+	assert.False(t, s.(*ZDASentence).valid)
+	_, err = decodeLine(nmeaLine(0x1234, "$GPZDA,123456.00,01,13,2024,00,00"))
+	assert.NotNil(t, err)
+
+	s, err = decodeLine(nmeaLine(0x1234, "$GNGSA,A,3,10,12,15,24,25,,,,,,,,1.52,0.87,1.25,1"))
+	assert.Nil(t, err)
+	gsa := s.(*GSASentence)
+	assert.Equal(t, fix3D, gsa.fixType)
+	assert.Equal(t, []int{10, 12, 15, 24, 25}, gsa.satellites)
+	assert.Equal(t, 1.52, gsa.pdop)
+	assert.Equal(t, 1.25, gsa.vdop)
+
+	s, err = decodeLine(nmeaLine(0x1234, "$GLGSV,2,1,07,65,34,051,28,66,72,310,,72,11,125,31,74,05,020,"))
+	assert.Nil(t, err)
+	gsv := s.(*GSVSentence)
+	assert.Equal(t, "GL", gsv.talker)
+	assert.Equal(t, 2, gsv.messages)
+	assert.Equal(t, 7, gsv.inView)
+	assert.Equal(t, 4, len(gsv.satellites))
+	assert.Equal(t, SatelliteInView{prn: 66, elevation: 72, azimuth: 310, snr: -1}, gsv.satellites[1])
+
+	// NMEA 4.10 adds a signal ID after the satellites
+	s, err = decodeLine(nmeaLine(0x1234, "$GPGSV,3,3,09,32,40,282,44,1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []SatelliteInView{{prn: 32, elevation: 40, azimuth: 282, snr: 44}}, s.(*GSVSentence).satellites)
+
+	_, err = decodeLine(nmeaLine(0x1234, "$GNGSA,A,x,,,,,,,,,,,,,,,"))
+	assert.ErrorIs(t, err, errFieldFormat)
+	_, err = decodeLine(nmeaLine(0x1234, "$GXRMC,123456.00,A"))
+	assert.NotNil(t, err)
+}
+
+func Test_applySatellites(t *testing.T) {
+	gpsInfo := GPSdata{unixTime: 1} // past the first time of day
+	for _, line := range []string{
+		"$GNGGA,123456.00,4000.0000,N,10500.0000,W,1,09,0.9,1609.3,M,-20.0,M,,",
+		"$GNGSA,A,3,10,12,15,24,25,,,,,,,,1.5,0.9,1.2,1",
+		"$GPGSV,3,1,10,10,34,051,28,12,72,310,40,15,11,125,31,24,05,020,",
+		"$GLGSV,1,1,04,65,34,051,28,66,72,310,,72,11,125,31,74,05,020,",
+		"$GPGSV,3,1,10,10,34,051,28,12,72,310,40,15,11,125,31,24,05,020,,1", // L1 signal group
+		"$GPGSV,2,1,07,10,34,051,22,12,72,310,35,15,11,125,,24,05,020,,6",   // L2 signal group
+		"$GNZDA,123456.00,01,03,2024,00,00",
+	} {
+		s, err := decodeLine(nmeaLine(0x1234, line))
+		assert.Nil(t, err)
+		applySentence(s, &gpsInfo)
+	}
+	assert.Equal(t, fix3D, gpsInfo.fixType)
+	assert.Equal(t, 9, gpsInfo.satellitesUsed)
+	assert.Equal(t, map[GSVGroup]int{{"GP", 0}: 10, {"GL", 0}: 4, {"GP", 1}: 10, {"GP", 6}: 7},
+		gpsInfo.satellitesInView)
+	assert.Equal(t, "010324", gpsInfo.date)
+	assert.Equal(t, int64(1709296497), gpsInfo.unixTime)
+	assert.Equal(t, "Satellites: 9 used of 14 in view  3D fix  HDOP 0.9  PDOP 1.5", satellitesText(gpsInfo))
+	assert.Equal(t, "Satellites: not available", satellitesText(GPSdata{}))
+}
+
+func Test_applyZDAWithoutFix(t *testing.T) {
+	// The receiver's clock time, before it has a fix, is not taken
+	gpsInfo := GPSdata{}
+	for _, line := range []string{
+		"$GPRMC,123456.00,V,,,,,,,010324,,,N",
+		"$GNGSA,A,1,,,,,,,,,,,,,,,,1",
+		"$GNZDA,123456.00,01,03,2024,00,00",
+	} {
+		s, err := decodeLine(nmeaLine(0x1234, line))
+		assert.Nil(t, err)
+		applySentence(s, &gpsInfo)
+	}
+	assert.Equal(t, int64(0), gpsInfo.unixTime)
+	assert.Equal(t, "", gpsInfo.date)
+
+	s, _ := decodeLine(nmeaLine(0x1234, "$GNGSA,A,2,10,12,15,,,,,,,,,,1.5,0.9,1.2,1"))
+	applySentence(s, &gpsInfo)
+	s, _ = decodeLine(nmeaLine(0x1234, "$GNZDA,123456.00,01,03,2024,00,00"))
+	applySentence(s, &gpsInfo)
+	assert.Equal(t, int64(1709296497), gpsInfo.unixTime)
+}
+
+func Test_applySentenceActions(t *testing.T) {
+	prefs := myWin.App.Preferences()
+	saved := prefs.BoolWithFallback("ArmUTCstartTime", false)
+	savedData := onePPSdata
+	t.Cleanup(func() {
+		prefs.SetBool("ArmUTCstartTime", saved)
+		onePPSdata = savedData
+	})
+
+	// The first time of the session asks for the recording to be armed, rather than arming it
+	prefs.SetBool("ArmUTCstartTime", true)
+	gpsInfo := GPSdata{}
+	s, _ := decodeLine(nmeaLine(0x1234, "$GPRMC,123456.00,A,4000.0000,N,10500.0000,W,0.0,0.0,010324,,,D"))
+	actions := applySentence(s, &gpsInfo)
+	assert.True(t, actions.armRecording)
+	assert.False(t, myWin.utcStartArmed)
+	actions = applySentence(s, &gpsInfo)
+	assert.False(t, actions.armRecording)
+
+	// The decoded sentence is left as reported
+	gpsInfo.utcValidKnown = true
+	s, _ = decodeLine(nmeaLine(0x1234, "$PUBX,04,123456.00,010324,0.00,2303,18,0,0,"))
+	actions = applySentence(s, &gpsInfo)
+	assert.Equal(t, "18D", actions.gpsUtcOffset)
+	assert.Equal(t, "18", s.(*PUBX04Sentence).gpsUtcOffset)
+}
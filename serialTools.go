@@ -2,7 +2,6 @@ package main
 
 import (
 	"go.bug.st/serial"
-	"log"
 	"time"
 )
 
@@ -23,19 +22,19 @@ func openSerialPort(portName string, baudrate int) (serial.Port, error) {
 
 	err2 := port.ResetInputBuffer()
 	if err2 != nil {
-		log.Println(err2.Error())
+		serialLog.Error("input buffer not reset", "port", portName, "err", err2)
 		return port, err2
 	}
 
 	err3 := port.ResetOutputBuffer()
 	if err3 != nil {
-		log.Println(err3.Error())
+		serialLog.Error("output buffer not reset", "port", portName, "err", err3)
 		return port, err3
 	}
 
 	err4 := port.SetReadTimeout(2 * time.Second)
 	if err4 != nil {
-		log.Println(err4.Error())
+		serialLog.Error("read timeout not set", "port", portName, "err", err4)
 		return port, err4
 	}
 
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Every armed recording (and the idle time between recordings) gets its own directory under this one
+const sessionsDir = "IotaGFT_sessions"
+
+// A session in which no recording was started is removed when the app starts, once it is this old
+const idleSessionMaxAge = 7 * 24 * time.Hour
+
+const (
+	sentenceLogFile    = "IotaGFT_LOG.txt"
+	flashEdgeTimesFile = "FLASH_EDGE_TIMES.txt"
+	ppsHistoryPlotFile = "ppsHistory.png"
+	manifestFile       = "MANIFEST.txt"
+)
+
+type ManifestEntry struct {
+	name   string
+	size   int64
+	sha256 string
+}
+
+// newSessionDir creates a directory named from the UTC time t. A suffix is added if a session
+// was already started in the same second.
+func newSessionDir(workDir string, t time.Time) (string, error) {
+	base := filepath.Join(workDir, sessionsDir, "session_"+t.UTC().Format("20060102_150405"))
+	dir := base
+	for n := 2; ; n++ {
+		_, err := os.Stat(dir)
+		if os.IsNotExist(err) {
+			break
+		}
+		dir = fmt.Sprintf("%s_%d", base, n)
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", fmt.Errorf("newSessionDir(): %w", err)
+	}
+	return dir, nil
+}
+
+func fileSHA256(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// buildManifest lists every regular file in dir (except the manifest itself) with its size and checksum
+func buildManifest(dir string) ([]ManifestEntry, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("buildManifest(): %w", err)
+	}
+	var entries []ManifestEntry
+	for _, dirEntry := range dirEntries {
+		if !dirEntry.Type().IsRegular() || dirEntry.Name() == manifestFile {
+			continue
+		}
+		sum, size, err := fileSHA256(filepath.Join(dir, dirEntry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("buildManifest(): %w", err)
+		}
+		entries = append(entries, ManifestEntry{name: dirEntry.Name(), size: size, sha256: sum})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	return entries, nil
+}
+
+// writeManifest lists the files of the session in dir. recorded tells whether a recording was started in it:
+// removeIdleSessions removes the sessions whose manifest says none was.
+func writeManifest(dir string, recorded bool) ([]ManifestEntry, error) {
+	entries, err := buildManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# IotaGFTapp %s session manifest\n", Version))
+	sb.WriteString(fmt.Sprintf("# session: %s\n", filepath.Base(dir)))
+	sb.WriteString(fmt.Sprintf("# written: %s UTC\n", time.Now().UTC().Format(time.DateTime)))
+	if !recorded {
+		sb.WriteString(idleManifestLine + "\n")
+	}
+	sb.WriteString("# sha256 bytes file\n")
+	for _, entry := range entries {
+		sb.WriteString(fmt.Sprintf("%s %d %s\n", entry.sha256, entry.size, entry.name))
+	}
+	err = os.WriteFile(filepath.Join(dir, manifestFile), []byte(sb.String()), 0644)
+	if err != nil {
+		return nil, fmt.Errorf("writeManifest(): %w", err)
+	}
+	return entries, nil
+}
+
+// readManifest returns the files listed in the manifest of the session in dir, with the size and
+// checksum they had when it was written
+func readManifest(dir string) ([]ManifestEntry, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("readManifest(): %w", err)
+	}
+	var entries []ManifestEntry
+	for _, line := range strings.Split(string(contents), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("readManifest(): malformed line: %s", line)
+		}
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("readManifest(): malformed line: %s", line)
+		}
+		entries = append(entries, ManifestEntry{name: fields[2], size: size, sha256: fields[0]})
+	}
+	return entries, nil
+}
+
+// finishSession closes the files of the current session, keeps a snapshot of the operation log
+// with it and writes its manifest.
+func finishSession() string {
+	dir := myWin.sessionDir
+	if dir == "" {
+		return ""
+	}
+	myWin.sessionDir = ""
+
+	if myWin.logFile != nil {
+		err := myWin.logFile.Close()
+		if err != nil {
+			filesLog.Error("sentence log not closed", "err", err)
+		}
+	}
+	if myWin.flashEdgeLogfile != nil {
+		_ = myWin.flashEdgeLogfile.Close()
+	}
+	stopSentenceArchive()
+	saveHostLatencyReport(dir)
+	myWin.hostEvents = nil
+	saveSiteRecord(dir, myWin.sitePosition)
+	myWin.sitePosition = PositionAverage{}
+
+	// The operation log stays open for the life of the app, so the session gets a copy of it
+	err := copyFile(operationLog, filepath.Join(dir, operationLog))
+	if err != nil {
+		filesLog.Error("operation log not copied to the session", "err", err)
+	}
+
+	_, err = writeManifest(dir, myWin.sessionRecorded)
+	if err != nil {
+		filesLog.Error("manifest not written", "err", err)
+	}
+	filesLog.Info("session closed", "dir", dir)
+	return dir
+}
+
+const idleManifestLine = "# recording: none"
+
+// removeIdleSessions removes the session directories under workDir in which no recording was started and
+// that were started more than maxAge before now. A session without a manifest (the app did not close it)
+// is kept. It returns the directories removed.
+func removeIdleSessions(workDir string, now time.Time, maxAge time.Duration) []string {
+	root := filepath.Join(workDir, sessionsDir)
+	dirEntries, err := os.ReadDir(root)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			filesLog.Error("sessions not listed", "err", err)
+		}
+		return nil
+	}
+	var removed []string
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if !dirEntry.IsDir() || !strings.HasPrefix(name, "session_") || len(name) < len("session_20060102_150405") {
+			continue
+		}
+		started, err := time.Parse("20060102_150405", name[len("session_"):len("session_20060102_150405")])
+		if err != nil || now.Sub(started) < maxAge {
+			continue
+		}
+		manifest, err := os.ReadFile(filepath.Join(root, name, manifestFile))
+		if err != nil || !strings.Contains(string(manifest), "\n"+idleManifestLine+"\n") {
+			continue
+		}
+		dir := filepath.Join(root, name)
+		if err = os.RemoveAll(dir); err != nil {
+			filesLog.Error("idle session not removed", "dir", dir, "err", err)
+			continue
+		}
+		filesLog.Info("idle session removed", "dir", dir)
+		removed = append(removed, dir)
+	}
+	return removed
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_newSessionDir(t *testing.T) {
+	workDir := t.TempDir()
+	now := time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC)
+	first, err := newSessionDir(workDir, now)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(workDir, sessionsDir, "session_20240301_102030"), first)
+
+	// A second session started in the same second must not reuse the directory
+	second, err := newSessionDir(workDir, now)
+	assert.Nil(t, err)
+	assert.Equal(t, first+"_2", second)
+}
+
+func Test_writeManifest(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, flashEdgeTimesFile), []byte("abc"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, sentenceLogFile), []byte(""), 0644))
+
+	entries, err := writeManifest(dir, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, flashEdgeTimesFile, entries[0].name)
+	assert.Equal(t, int64(3), entries[0].size)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", entries[0].sha256)
+
+	manifest, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(manifest), entries[0].sha256+" 3 "+flashEdgeTimesFile))
+
+	// Rewriting the manifest does not list the manifest itself
+	entries, err = writeManifest(dir, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+}
+
+func Test_removeIdleSessions(t *testing.T) {
+	workDir := t.TempDir()
+	started := time.Date(2024, 3, 1, 10, 20, 30, 0, time.UTC)
+	idle, err := newSessionDir(workDir, started)
+	assert.Nil(t, err)
+	_, err = writeManifest(idle, false)
+	assert.Nil(t, err)
+	recorded, err := newSessionDir(workDir, started)
+	assert.Nil(t, err)
+	_, err = writeManifest(recorded, true)
+	assert.Nil(t, err)
+	unclosed, err := newSessionDir(workDir, started)
+	assert.Nil(t, err)
+
+	// Not old enough yet
+	assert.Empty(t, removeIdleSessions(workDir, started.Add(time.Hour), idleSessionMaxAge))
+
+	assert.Equal(t, []string{idle}, removeIdleSessions(workDir, started.Add(8*24*time.Hour), idleSessionMaxAge))
+	for _, dir := range []string{recorded, unclosed} {
+		_, err = os.Stat(dir)
+		assert.Nil(t, err, dir)
+	}
+	assert.Empty(t, removeIdleSessions(filepath.Join(workDir, "missing"), started, idleSessionMaxAge))
+}
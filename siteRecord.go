@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The GGA fixes of a session are averaged into the observer's site, which is written to the session
+// directory (next to FLASH_EDGE_TIMES.txt) in the forms an occultation report needs.
+const (
+	siteRecordFile = "IotaGFT_SITE.txt"
+	wgs84A         = 6378137.0        // semi-major axis (m)
+	wgs84E2        = 6.69437999014e-3 // first eccentricity squared
+	siteMinFixes   = 60               // fewer fixes than this are flagged in the site record
+)
+
+// RunningStats is a running mean and standard deviation (Welford's method)
+type RunningStats struct {
+	n    int
+	mean float64
+	m2   float64 // sum of squared differences from the mean
+}
+
+func (r *RunningStats) add(x float64) {
+	r.n++
+	delta := x - r.mean
+	r.mean += delta / float64(r.n)
+	r.m2 += delta * (x - r.mean)
+}
+
+// stdDev is the sample standard deviation, 0 until there are 2 values
+func (r RunningStats) stdDev() float64 {
+	if r.n < 2 {
+		return 0
+	}
+	return math.Sqrt(r.m2 / float64(r.n-1))
+}
+
+// PositionAverage is the average of the GGA fixes of a session
+type PositionAverage struct {
+	latitude RunningStats // degrees, north positive
+	lonSin   RunningStats // sine and cosine of the longitude: averaged as unit vectors so that fixes
+	lonCos   RunningStats // either side of 180 degrees average correctly
+	altitude RunningStats // above mean sea level (m)
+	height   RunningStats // above the WGS84 ellipsoid (m): only fixes that give the geoid separation
+	first    int64        // unixTime of the first fix
+	last     int64
+}
+
+// nmeaDegrees converts an NMEA latitude (ddmm.mmmm) or longitude (dddmm.mmmm) and its N/S or E/W to
+// decimal degrees, north and east positive
+func nmeaDegrees(value, direction string) (float64, error) {
+	dot := strings.IndexByte(value, '.')
+	if dot < 0 {
+		dot = len(value)
+	}
+	if dot < 3 {
+		return 0, fmt.Errorf("nmeaDegrees(): %q is not ddmm.mmmm", value)
+	}
+	degrees, err := strconv.Atoi(value[:dot-2])
+	if err != nil {
+		return 0, fmt.Errorf("nmeaDegrees(): %w", err)
+	}
+	minutes, err := strconv.ParseFloat(value[dot-2:], 64)
+	if err != nil || minutes < 0 || minutes >= 60 {
+		return 0, fmt.Errorf("nmeaDegrees(): %q has bad minutes", value)
+	}
+	result := float64(degrees) + minutes/60
+	switch direction {
+	case "N", "E":
+		return result, nil
+	case "S", "W":
+		return -result, nil
+	}
+	return 0, fmt.Errorf("nmeaDegrees(): %q is not N, S, E or W", direction)
+}
+
+// ggaMeters converts a GGA altitude or geoid separation to meters
+func ggaMeters(value, units string) (float64, error) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("ggaMeters(): %w", err)
+	}
+	switch units {
+	case "M", "":
+		return number, nil
+	case "F":
+		return number * 0.3048, nil
+	}
+	return 0, fmt.Errorf("ggaMeters(): unknown units %q", units)
+}
+
+// addFix adds the position of a GGA sentence received at unixTime. Sentences without a fix are ignored.
+func (avg *PositionAverage) addFix(s *GGASentence, unixTime int64) {
+	if s.fixQuality == 0 {
+		return
+	}
+	latitude, err := nmeaDegrees(s.latitude, s.latDirection)
+	if err != nil {
+		parserLog.Debug("GGA position not averaged", "err", err)
+		return
+	}
+	longitude, err := nmeaDegrees(s.longitude, s.lonDirection)
+	if err != nil {
+		parserLog.Debug("GGA position not averaged", "err", err)
+		return
+	}
+	altitude, err := ggaMeters(s.altitude, s.altitudeUnits)
+	if err != nil {
+		parserLog.Debug("GGA position not averaged", "err", err)
+		return
+	}
+	if avg.latitude.n == 0 {
+		avg.first = unixTime
+	}
+	avg.last = unixTime
+	avg.latitude.add(latitude)
+	sin, cos := math.Sincos(longitude * math.Pi / 180)
+	avg.lonSin.add(sin)
+	avg.lonCos.add(cos)
+	avg.altitude.add(altitude)
+	if separation, err := ggaMeters(s.geoidSeparation, s.altitudeUnits); err == nil {
+		avg.height.add(altitude + separation)
+	}
+}
+
+// longitude returns the mean longitude (degrees, east positive) and its circular standard deviation (degrees)
+func (avg PositionAverage) longitude() (float64, float64) {
+	mean := math.Atan2(avg.lonSin.mean, avg.lonCos.mean) * 180 / math.Pi
+	r := math.Hypot(avg.lonSin.mean, avg.lonCos.mean)
+	if r >= 1 {
+		return mean, 0
+	}
+	return mean, math.Sqrt(-2*math.Log(r)) * 180 / math.Pi
+}
+
+// metersPerDegree returns the length of a degree of latitude and of longitude at latitude (degrees)
+func metersPerDegree(latitude float64) (float64, float64) {
+	sin, cos := math.Sincos(latitude * math.Pi / 180)
+	w := 1 - wgs84E2*sin*sin
+	meridian := wgs84A * (1 - wgs84E2) / math.Pow(w, 1.5)
+	primeVertical := wgs84A / math.Sqrt(w)
+	return meridian * math.Pi / 180, primeVertical * cos * math.Pi / 180
+}
+
+// formatDMS formats decimal degrees as degrees, minutes and seconds (to 0.01") after the sign given by
+// positive or negative ("N" or "S" and a space for an IOTA report, "+" or "-" for Occult)
+func formatDMS(degrees float64, positive, negative string, degreeDigits int) string {
+	sign := positive
+	if degrees < 0 {
+		sign = negative
+	}
+	hundredths := int64(math.Round(math.Abs(degrees) * 360_000))
+	d := hundredths / 360_000
+	m := hundredths / 6000 % 60
+	sec := float64(hundredths%6000) / 100
+	return fmt.Sprintf("%s%0*d %02d %05.2f", sign, degreeDigits, d, m, sec)
+}
+
+// writeSiteRecord writes the averaged site in decimal degrees, for an IOTA report and for Occult
+func writeSiteRecord(w io.Writer, avg PositionAverage) error {
+	bw := bufio.NewWriter(w)
+	latitude := avg.latitude.mean
+	longitude, lonStdDev := avg.longitude()
+	latMeters, lonMeters := metersPerDegree(latitude)
+	fmt.Fprintf(bw, "# IotaGFTapp %s observer site, the average of %d GPS fixes from %s to %s UTC\n", Version,
+		avg.latitude.n, time.Unix(avg.first, 0).UTC().Format(time.DateTime),
+		time.Unix(avg.last, 0).UTC().Format(time.DateTime))
+	fmt.Fprintf(bw, "# Datum WGS84. Uncertainties are the standard deviation of the fixes (1 sigma).\n")
+	if avg.latitude.n < siteMinFixes {
+		fmt.Fprintf(bw, "# WARNING: fewer than %d fixes - the position may be off by several meters\n", siteMinFixes)
+	}
+
+	fmt.Fprintf(bw, "\nDecimal degrees\n")
+	fmt.Fprintf(bw, "  Latitude   %+.7f  +/- %.1f m\n", latitude, avg.latitude.stdDev()*latMeters)
+	fmt.Fprintf(bw, "  Longitude  %+.7f  +/- %.1f m\n", longitude, lonStdDev*lonMeters)
+	fmt.Fprintf(bw, "  Altitude   %.1f m above mean sea level  +/- %.1f m\n", avg.altitude.mean,
+		avg.altitude.stdDev())
+	height := "not available (the receiver did not give the geoid separation)"
+	if avg.height.n > 0 {
+		height = fmt.Sprintf("%.1f m  +/- %.1f m", avg.height.mean, avg.height.stdDev())
+	}
+	fmt.Fprintf(bw, "  Height     %s above the WGS84 ellipsoid\n", height)
+
+	fmt.Fprintf(bw, "\nIOTA report\n")
+	fmt.Fprintf(bw, "  Longitude  %s\n", formatDMS(longitude, "E ", "W ", 3))
+	fmt.Fprintf(bw, "  Latitude   %s\n", formatDMS(latitude, "N ", "S ", 2))
+	fmt.Fprintf(bw, "  Altitude   %.0f m\n", avg.altitude.mean)
+	fmt.Fprintf(bw, "  Datum      WGS84   Altitude datum  MSL\n")
+
+	fmt.Fprintf(bw, "\nOccult (longitude, latitude, altitude, datum, height datum)\n")
+	fmt.Fprintf(bw, "  %s, %s, %.0f, WGS84, MSL\n", formatDMS(longitude, "+", "-", 3),
+		formatDMS(latitude, "+", "-", 2), avg.altitude.mean)
+	return bw.Flush()
+}
+
+// saveSiteRecord writes the site record of the session to dir, if there were any fixes
+func saveSiteRecord(dir string, avg PositionAverage) {
+	if avg.latitude.n == 0 {
+		return
+	}
+	file, err := os.Create(filepath.Join(dir, siteRecordFile))
+	if err != nil {
+		filesLog.Error("site record not written", "err", err)
+		return
+	}
+	defer file.Close()
+	err = writeSiteRecord(file, avg)
+	if err != nil {
+		filesLog.Error("site record not written", "err", err)
+		return
+	}
+	longitude, _ := avg.longitude()
+	filesLog.Info("site record written", "fixes", avg.latitude.n, "latitude", avg.latitude.mean,
+		"longitude", longitude)
+}
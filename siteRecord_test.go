@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func Test_runningStats(t *testing.T) {
+	var r RunningStats
+	assert.Equal(t, 0.0, r.stdDev())
+	for _, x := range []float64{2, 4, 4, 4, 5, 5, 7, 9} {
+		r.add(x)
+	}
+	assert.Equal(t, 5.0, r.mean)
+	assert.InDelta(t, math.Sqrt(32.0/7), r.stdDev(), 1e-12)
+}
+
+func Test_nmeaDegrees(t *testing.T) {
+	degrees, err := nmeaDegrees("4807.038", "N")
+	assert.Nil(t, err)
+	assert.InDelta(t, 48.1173, degrees, 1e-9)
+	degrees, err = nmeaDegrees("01131.000", "W")
+	assert.Nil(t, err)
+	assert.InDelta(t, -11.516666667, degrees, 1e-9)
+
+	for _, value := range [][2]string{{"", "N"}, {"48", "N"}, {"4860.000", "N"}, {"4807.038", "X"}} {
+		_, err = nmeaDegrees(value[0], value[1])
+		assert.NotNil(t, err, value)
+	}
+
+	meters, err := ggaMeters("100", "F")
+	assert.Nil(t, err)
+	assert.InDelta(t, 30.48, meters, 1e-9)
+	_, err = ggaMeters("100", "Y")
+	assert.NotNil(t, err)
+}
+
+func Test_formatDMS(t *testing.T) {
+	assert.Equal(t, "N 48 07 02.28", formatDMS(48.1173, "N ", "S ", 2))
+	assert.Equal(t, "-011 31 00.00", formatDMS(-11.516666667, "+", "-", 3))
+	// 59.999" rounds up to the next minute
+	assert.Equal(t, "+10 01 00.00", formatDMS(10+59.999/3600, "+", "-", 2))
+}
+
+func Test_siteRecord(t *testing.T) {
+	var avg PositionAverage
+	for i, line := range []string{
+		"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,",
+		"$GPGGA,123520,4807.040,N,01131.000,E,1,08,0.9,545.6,M,46.9,M,,",
+		"$GPGGA,123521,,,,,0,00,,,M,,M,,", // no fix
+	} {
+		s, err := decodeLine(nmeaLine(0x1234, line))
+		assert.Nil(t, err)
+		avg.addFix(s.(*GGASentence), 1_700_000_000+int64(i))
+	}
+	assert.Equal(t, 2, avg.latitude.n)
+	assert.Equal(t, int64(1_700_000_001), avg.last)
+	assert.InDelta(t, 545.5, avg.altitude.mean, 1e-9)
+	assert.InDelta(t, 592.4, avg.height.mean, 1e-9)
+
+	var buf bytes.Buffer
+	assert.Nil(t, writeSiteRecord(&buf, avg))
+	record := buf.String()
+	assert.Contains(t, record, "the average of 2 GPS fixes from 2023-11-14 22:13:20 to 2023-11-14 22:13:21 UTC")
+	assert.Contains(t, record, "WARNING: fewer than 60 fixes")
+	assert.Contains(t, record, "Latitude   +48.1173167  +/- 2.6 m")
+	assert.Contains(t, record, "Height     592.4 m  +/- 0.1 m above the WGS84 ellipsoid")
+	assert.Contains(t, record, "Longitude  E 011 31 00.00")
+	assert.Contains(t, record, "+011 31 00.00, +48 07 02.34, 546, WGS84, MSL")
+}
+
+func Test_siteRecordLongitudeAcross180(t *testing.T) {
+	var avg PositionAverage
+	for i, line := range []string{
+		"$GPGGA,123519,1800.000,S,17959.994,E,1,08,0.9,10.0,M,,M,,",
+		"$GPGGA,123520,1800.000,S,17959.994,W,1,08,0.9,10.0,M,,M,,",
+	} {
+		s, err := decodeLine(nmeaLine(0x1234, line))
+		assert.Nil(t, err)
+		avg.addFix(s.(*GGASentence), 1_700_000_000+int64(i))
+	}
+	// The fixes are 0.0002 degrees apart across 180 degrees, not on opposite sides of the earth
+	longitude, stdDev := avg.longitude()
+	assert.InDelta(t, 180, math.Abs(longitude), 1e-9)
+	assert.InDelta(t, 0.0001, stdDev, 1e-6)
+}
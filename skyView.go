@@ -0,0 +1,379 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"gonum.org/v1/plot/vg/draw"
+	"gonum.org/v1/plot/vg/vgimg"
+)
+
+// The satellites panel shows where the satellites in view are (a polar sky plot), the strength of their
+// signals and an estimate of how long it will be before the GFT reaches TimeValid. It is built from the
+// GSV and GSA sentences and refreshed by updateStatusLine.
+const (
+	usableSNR          = 30                              // dB-Hz: strong enough to decode the navigation message reliably
+	satellitesForFix   = 4                               // usable satellites needed for a 3D fix
+	ephemerisTime      = 30 * time.Second                // to decode the ephemeris of a satellite with a usable signal
+	utcParametersCycle = 12*time.Minute + 30*time.Second // the UTC parameters (leap seconds) are broadcast once in this cycle
+	skyPanelRefresh    = time.Second                     // the panel is redrawn at most this often
+	skyPlotSize        = 450                             // pixels
+	snrChartWidth      = 550                             // pixels
+)
+
+// gsaSystemTalkers gives the talker of the constellation of an NMEA 4.10 GSA system ID
+var gsaSystemTalkers = map[int]string{1: "GP", 2: "GL", 3: "GA", 4: "GB"}
+
+// satellitePrefixes are the letters that satellite names start with, by talker
+var satellitePrefixes = map[string]string{"GP": "G", "GL": "R", "GA": "E", "GB": "C", "BD": "C"}
+
+// SkyView is the satellites in view, assembled from groups of GSV sentences, and the satellites used in
+// the fix, from GSA sentences
+type SkyView struct {
+	groups  map[string][]SatelliteInView // complete GSV groups by talker and signal ID
+	pending map[string][]SatelliteInView // GSV groups still being received
+	used    map[string][]int             // PRNs used in the fix by talker (GN: the constellation is not known)
+	usedAt  int64                        // unixTime of the GN GSA sentences in used
+}
+
+// A SkySatellite is one satellite of a SkyView
+type SkySatellite struct {
+	SatelliteInView
+	talker string
+	used   bool
+}
+
+func (sat SkySatellite) name() string {
+	prefix, ok := satellitePrefixes[sat.talker]
+	if !ok {
+		prefix = sat.talker
+	}
+	return fmt.Sprintf("%s%02d", prefix, sat.prn)
+}
+
+func (sky *SkyView) addGSV(s *GSVSentence) {
+	if sky.groups == nil {
+		sky.groups = make(map[string][]SatelliteInView)
+		sky.pending = make(map[string][]SatelliteInView)
+	}
+	key := fmt.Sprintf("%s/%d", s.talker, s.signalID)
+	if s.message == 1 {
+		sky.pending[key] = nil
+	}
+	sky.pending[key] = append(sky.pending[key], s.satellites...)
+	if s.message >= s.messages {
+		sky.groups[key] = sky.pending[key]
+		delete(sky.pending, key)
+	}
+}
+
+// addGSA records the satellites used by a GSA sentence received at unixTime. A receiver that does not send
+// the system ID sends a GN GSA for each constellation: those of one second are put together.
+func (sky *SkyView) addGSA(s *GSASentence, unixTime int64) {
+	if sky.used == nil {
+		sky.used = make(map[string][]int)
+	}
+	talker, ok := gsaSystemTalkers[s.systemID]
+	if !ok {
+		talker = s.talker
+	}
+	if talker != "GN" {
+		sky.used[talker] = s.satellites
+		return
+	}
+	if unixTime != sky.usedAt {
+		sky.used["GN"] = nil
+		sky.usedAt = unixTime
+	}
+	sky.used["GN"] = append(sky.used["GN"], s.satellites...)
+}
+
+func (sky *SkyView) isUsed(talker string, prn int) bool {
+	return slices.Contains(sky.used[talker], prn) || slices.Contains(sky.used["GN"], prn)
+}
+
+// satellites returns the satellites in view in talker and PRN order. A satellite reported for more than
+// one signal is given the strongest.
+func (sky *SkyView) satellites() []SkySatellite {
+	merged := make(map[string]SkySatellite)
+	for key, group := range sky.groups {
+		talker, _, _ := strings.Cut(key, "/")
+		for _, sat := range group {
+			id := fmt.Sprintf("%s/%d", talker, sat.prn)
+			previous, seen := merged[id]
+			if seen && previous.snr >= sat.snr {
+				continue
+			}
+			if seen && sat.elevation < 0 {
+				sat.elevation, sat.azimuth = previous.elevation, previous.azimuth
+			}
+			merged[id] = SkySatellite{SatelliteInView: sat, talker: talker, used: sky.isUsed(talker, sat.prn)}
+		}
+	}
+
+	sats := make([]SkySatellite, 0, len(merged))
+	for _, sat := range merged {
+		sats = append(sats, sat)
+	}
+	slices.SortFunc(sats, func(a, b SkySatellite) int {
+		if a.talker != b.talker {
+			return slices.Index(nmeaTalkers, a.talker) - slices.Index(nmeaTalkers, b.talker)
+		}
+		return a.prn - b.prn
+	})
+	return sats
+}
+
+func usableSatellites(sats []SkySatellite) int {
+	n := 0
+	for _, sat := range sats {
+		if sat.snr >= usableSNR {
+			n++
+		}
+	}
+	return n
+}
+
+// noteTimeValidProgress records (at the host time of the sentence) when enough satellites first had a
+// usable signal and when the receiver first had a 3D fix. Losing either starts the wait again.
+func noteTimeValidProgress(gpsInfo *GPSdata) {
+	if usableSatellites(gpsInfo.sky.satellites()) < satellitesForFix {
+		gpsInfo.usableSince = time.Time{}
+	} else if gpsInfo.usableSince.IsZero() {
+		gpsInfo.usableSince = gpsInfo.hostTime
+	}
+	if gpsInfo.fixType != fix3D {
+		gpsInfo.fixSince = time.Time{}
+	} else if gpsInfo.fixSince.IsZero() {
+		gpsInfo.fixSince = gpsInfo.hostTime
+	}
+}
+
+// timeValidEstimate estimates how long it will be at host time now before the GFT reaches TimeValid. The
+// receiver needs a 3D fix (the ephemerides of 4 satellites) and then the UTC parameters, which are
+// broadcast only once every 12.5 minutes and are lost if a signal drops out while they are sent.
+func timeValidEstimate(gpsInfo GPSdata, now time.Time) string {
+	if strings.Contains(gpsInfo.status, "TimeValid") {
+		return "TimeValid reached"
+	}
+	sats := gpsInfo.sky.satellites()
+	if len(sats) == 0 {
+		return "Time to TimeValid: no satellite data yet (GSV sentences are needed)"
+	}
+	usable := usableSatellites(sats)
+	if usable < satellitesForFix {
+		return fmt.Sprintf("TimeValid is not expected: only %d satellites have a signal of %d dB-Hz or more "+
+			"(%d are needed). The antenna needs a clearer view of the sky.", usable, usableSNR, satellitesForFix)
+	}
+	if gpsInfo.fixType != fix3D {
+		wait := max(0, ephemerisTime-now.Sub(gpsInfo.usableSince)).Round(time.Second)
+		return fmt.Sprintf("Time to TimeValid: about %v to a 3D fix, then up to %v for the UTC parameters",
+			wait, utcParametersCycle)
+	}
+	if gpsInfo.gpsUtcOffset == "" || strings.Contains(gpsInfo.gpsUtcOffset, "D") {
+		waited := now.Sub(gpsInfo.fixSince).Round(time.Second)
+		if waited > utcParametersCycle {
+			return fmt.Sprintf("TimeValid is overdue: no UTC parameters %v after the 3D fix. Signals that drop "+
+				"out (an obstructed sky) interrupt them.", waited)
+		}
+		return fmt.Sprintf("Time to TimeValid: at most %v while the receiver waits for the UTC parameters "+
+			"(leap seconds)", utcParametersCycle-waited)
+	}
+	return "Time to TimeValid: any moment now (3D fix and UTC parameters received)"
+}
+
+// skyPosition is where a satellite is drawn on the sky plot: the zenith at the centre, the horizon at
+// radius 1, north up and east to the right
+func skyPosition(elevation, azimuth int) plotter.XY {
+	r := float64(90-elevation) / 90
+	a := float64(azimuth) * math.Pi / 180
+	return plotter.XY{X: r * math.Sin(a), Y: r * math.Cos(a)}
+}
+
+var (
+	usedColor      = color.NRGBA{G: 160, A: 255}
+	trackedColor   = color.NRGBA{R: 230, G: 140, A: 255}
+	untrackedColor = color.NRGBA{R: 150, G: 150, B: 150, A: 255}
+)
+
+func satelliteColor(sat SkySatellite) color.Color {
+	switch {
+	case sat.used:
+		return usedColor
+	case sat.snr >= 0:
+		return trackedColor
+	default:
+		return untrackedColor
+	}
+}
+
+func renderPlot(plt *plot.Plot, width, height vg.Length) image.Image {
+	img := vgimg.NewWith(vgimg.UseWH(width, height), vgimg.UseDPI(72)) // a point is a pixel
+	plt.Draw(draw.New(img))
+	return img.Image()
+}
+
+// skyPlotImage draws the satellites with a known position on a polar plot of the sky
+func skyPlotImage(sats []SkySatellite) (image.Image, error) {
+	plt := plot.New()
+	plt.Title.Text = "Sky view"
+	plt.HideAxes()
+	plt.X.Min, plt.X.Max, plt.Y.Min, plt.Y.Max = -1.15, 1.15, -1.15, 1.15
+
+	// Elevation circles at 0, 30 and 60 degrees
+	for _, elevation := range []int{0, 30, 60} {
+		circle := make(plotter.XYs, 73)
+		for i := range circle {
+			circle[i] = skyPosition(elevation, i*5)
+		}
+		line, err := plotter.NewLine(circle)
+		if err != nil {
+			return nil, fmt.Errorf("skyPlotImage(): %w", err)
+		}
+		line.Color = untrackedColor
+		plt.Add(line)
+	}
+	directions, err := plotter.NewLabels(plotter.XYLabels{
+		XYs:    plotter.XYs{{X: 0, Y: 1.05}, {X: 1.05, Y: 0}, {X: 0, Y: -1.1}, {X: -1.1, Y: 0}},
+		Labels: []string{"N", "E", "S", "W"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("skyPlotImage(): %w", err)
+	}
+	plt.Add(directions)
+
+	var positions plotter.XYs
+	var names []string
+	var colors []color.Color
+	for _, sat := range sats {
+		if sat.elevation < 0 || sat.azimuth < 0 {
+			continue
+		}
+		positions = append(positions, skyPosition(sat.elevation, sat.azimuth))
+		names = append(names, sat.name())
+		colors = append(colors, satelliteColor(sat))
+	}
+	if len(positions) > 0 {
+		scatter, err := plotter.NewScatter(positions)
+		if err != nil {
+			return nil, fmt.Errorf("skyPlotImage(): %w", err)
+		}
+		scatter.GlyphStyleFunc = func(i int) draw.GlyphStyle {
+			return draw.GlyphStyle{Color: colors[i], Radius: vg.Points(7), Shape: draw.CircleGlyph{}}
+		}
+		plt.Add(scatter)
+
+		labels, err := plotter.NewLabels(plotter.XYLabels{XYs: positions, Labels: names})
+		if err != nil {
+			return nil, fmt.Errorf("skyPlotImage(): %w", err)
+		}
+		labels.Offset = vg.Point{X: vg.Points(8), Y: vg.Points(4)}
+		plt.Add(labels)
+	}
+	return renderPlot(plt, skyPlotSize, skyPlotSize), nil
+}
+
+// snrChartImage draws a bar of the signal strength of each satellite in view, with the level needed for a
+// usable signal
+func snrChartImage(sats []SkySatellite) (image.Image, error) {
+	plt := plot.New()
+	plt.Title.Text = "Signal strength"
+	plt.Y.Label.Text = "SNR (dB-Hz)"
+	plt.Y.Min, plt.Y.Max = 0, 55
+	plt.Y.Tick.Marker = plot.ConstantTicks([]plot.Tick{{Value: 0, Label: "0"}, {Value: 10, Label: "10"},
+		{Value: 20, Label: "20"}, {Value: usableSNR, Label: "30"}, {Value: 40, Label: "40"}, {Value: 50, Label: "50"}})
+
+	names := make([]string, len(sats))
+	for i, sat := range sats {
+		names[i] = sat.name()
+		bar, err := plotter.NewBarChart(plotter.Values{float64(max(sat.snr, 0))}, vg.Points(12))
+		if err != nil {
+			return nil, fmt.Errorf("snrChartImage(): %w", err)
+		}
+		bar.XMin = float64(i)
+		bar.Color = satelliteColor(sat)
+		bar.LineStyle.Width = 0
+		plt.Add(bar)
+	}
+	if len(sats) > 0 {
+		plt.NominalX(names...)
+		threshold, err := plotter.NewLine(plotter.XYs{{X: -0.5, Y: usableSNR}, {X: float64(len(sats)) - 0.5, Y: usableSNR}})
+		if err != nil {
+			return nil, fmt.Errorf("snrChartImage(): %w", err)
+		}
+		threshold.Dashes = []vg.Length{vg.Points(4), vg.Points(4)}
+		plt.Add(threshold)
+	}
+	return renderPlot(plt, snrChartWidth, skyPlotSize), nil
+}
+
+// SkyPanel is the open satellites panel
+type SkyPanel struct {
+	window    fyne.Window
+	skyPlot   *canvas.Image
+	snrChart  *canvas.Image
+	estimate  *widget.Label
+	refreshed time.Time
+}
+
+func showSkyPanel() {
+	if myWin.skyPanel != nil {
+		myWin.skyPanel.window.RequestFocus()
+		return
+	}
+	panel := &SkyPanel{
+		window:   myWin.App.NewWindow("Satellites"),
+		skyPlot:  canvas.NewImageFromImage(nil),
+		snrChart: canvas.NewImageFromImage(nil),
+		estimate: widget.NewLabel(""),
+	}
+	panel.skyPlot.FillMode = canvas.ImageFillContain
+	panel.snrChart.FillMode = canvas.ImageFillContain
+	panel.estimate.Wrapping = fyne.TextWrapWord
+	panel.window.SetContent(container.NewBorder(panel.estimate, nil, nil, nil,
+		container.NewGridWithColumns(2, panel.skyPlot, panel.snrChart)))
+	panel.window.Resize(fyne.Size{Height: 560, Width: 1000})
+	panel.window.SetOnClosed(func() { myWin.skyPanel = nil })
+	myWin.skyPanel = panel
+	refreshSkyPanel(gpsData)
+	panel.window.CenterOnScreen()
+	panel.window.Show()
+}
+
+// refreshSkyPanel redraws the satellites panel, if it is open
+func refreshSkyPanel(gpsInfo GPSdata) {
+	panel := myWin.skyPanel
+	if panel == nil || time.Since(panel.refreshed) < skyPanelRefresh {
+		return
+	}
+	panel.refreshed = time.Now()
+
+	sats := gpsInfo.sky.satellites()
+	panel.estimate.SetText(timeValidEstimate(gpsInfo, time.Now()))
+	img, err := skyPlotImage(sats)
+	if err != nil {
+		appLog.Warn("sky plot not drawn", "err", err)
+	} else {
+		panel.skyPlot.Image = img
+		panel.skyPlot.Refresh()
+	}
+	img, err = snrChartImage(sats)
+	if err != nil {
+		appLog.Warn("signal strength chart not drawn", "err", err)
+	} else {
+		panel.snrChart.Image = img
+		panel.snrChart.Refresh()
+	}
+}
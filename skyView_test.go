@@ -0,0 +1,103 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// applyLines decodes and applies NMEA sentences
+func applyLines(t *testing.T, gpsInfo *GPSdata, lines ...string) {
+	for _, line := range lines {
+		s, err := decodeLine(nmeaLine(0x1234, line))
+		assert.Nil(t, err, line)
+		if err == nil {
+			applySentence(s, gpsInfo)
+		}
+	}
+}
+
+func Test_skyView(t *testing.T) {
+	gpsInfo := GPSdata{unixTime: 100}
+	applyLines(t, &gpsInfo,
+		"$GPGSV,2,1,05,10,34,051,28,12,72,310,40,15,11,125,31,24,05,020,",
+		"$GLGSV,1,1,01,65,45,180,35",
+	)
+	// The GPS group is not complete yet
+	assert.Equal(t, []SkySatellite{{SatelliteInView{65, 45, 180, 35}, "GL", false}}, gpsInfo.sky.satellites())
+
+	applyLines(t, &gpsInfo,
+		"$GPGSV,2,2,05,32,40,282,44",
+		"$GNGSA,A,3,10,12,,,,,,,,,,,1.5,0.9,1.2",
+		"$GNGSA,A,3,65,,,,,,,,,,,,1.5,0.9,1.2",
+	)
+	sats := gpsInfo.sky.satellites()
+	assert.Equal(t, 6, len(sats))
+	assert.Equal(t, "G10", sats[0].name())
+	assert.True(t, sats[0].used)
+	assert.False(t, sats[2].used) // G15
+	assert.Equal(t, "R65", sats[5].name())
+	assert.True(t, sats[5].used)
+	assert.Equal(t, 4, usableSatellites(sats))
+
+	// The GN GSA sentences of the next second replace those of the last
+	gpsInfo.unixTime++
+	applyLines(t, &gpsInfo, "$GNGSA,A,3,15,,,,,,,,,,,,1.5,0.9,1.2")
+	sats = gpsInfo.sky.satellites()
+	assert.False(t, sats[0].used)
+	assert.True(t, sats[2].used)
+
+	// A satellite sent for two signals is given the stronger
+	applyLines(t, &gpsInfo,
+		"$GPGSV,1,1,01,10,34,051,28,1",
+		"$GPGSV,1,1,01,10,34,051,39,6",
+	)
+	assert.Equal(t, 39, gpsInfo.sky.satellites()[0].snr)
+}
+
+func Test_timeValidEstimate(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	gpsInfo := GPSdata{unixTime: 100, hostTime: start}
+	assert.Equal(t, "Time to TimeValid: no satellite data yet (GSV sentences are needed)",
+		timeValidEstimate(gpsInfo, start))
+
+	// Only 3 usable satellites: an obstructed sky
+	applyLines(t, &gpsInfo, "$GPGSV,1,1,04,10,34,051,28,12,72,310,40,15,11,125,31,24,05,020,33")
+	assert.True(t, gpsInfo.usableSince.IsZero())
+	assert.Contains(t, timeValidEstimate(gpsInfo, start), "not expected: only 3 satellites")
+
+	applyLines(t, &gpsInfo, "$GPGSV,1,1,04,10,34,051,30,12,72,310,40,15,11,125,31,24,05,020,33")
+	assert.Equal(t, start, gpsInfo.usableSince)
+	assert.Equal(t, "Time to TimeValid: about 20s to a 3D fix, then up to 12m30s for the UTC parameters",
+		timeValidEstimate(gpsInfo, start.Add(10*time.Second)))
+
+	gpsInfo.hostTime = start.Add(40 * time.Second)
+	applyLines(t, &gpsInfo, "$GPGSA,A,3,10,12,15,24,,,,,,,,,1.5,0.9,1.2")
+	assert.Equal(t, gpsInfo.hostTime, gpsInfo.fixSince)
+	gpsInfo.gpsUtcOffset = "16D"
+	assert.Equal(t, "Time to TimeValid: at most 7m30s while the receiver waits for the UTC parameters (leap seconds)",
+		timeValidEstimate(gpsInfo, gpsInfo.fixSince.Add(5*time.Minute)))
+	assert.Contains(t, timeValidEstimate(gpsInfo, gpsInfo.fixSince.Add(20*time.Minute)), "overdue")
+
+	gpsInfo.gpsUtcOffset = "18"
+	assert.Contains(t, timeValidEstimate(gpsInfo, gpsInfo.fixSince.Add(time.Minute)), "any moment now")
+	gpsInfo.status = "TimeValid PPS"
+	assert.Equal(t, "TimeValid reached", timeValidEstimate(gpsInfo, start))
+}
+
+func Test_skyPanelImages(t *testing.T) {
+	gpsInfo := GPSdata{}
+	applyLines(t, &gpsInfo,
+		"$GPGSV,1,1,03,10,34,051,28,12,72,310,,15,,,31",
+		"$GPGSA,A,3,10,,,,,,,,,,,,1.5,0.9,1.2",
+	)
+	sats := gpsInfo.sky.satellites()
+	for _, images := range [][]SkySatellite{nil, sats} {
+		img, err := skyPlotImage(images)
+		assert.Nil(t, err)
+		assert.Equal(t, skyPlotSize, img.Bounds().Dx())
+		img, err = snrChartImage(images)
+		assert.Nil(t, err)
+		assert.Equal(t, snrChartWidth, img.Bounds().Dx())
+	}
+}
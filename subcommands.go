@@ -0,0 +1,162 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const subcommandUsage = `IotaGFTapp [baudrate]                      run the app (the default baudrate is 250000)
+IotaGFTapp reassemble <folder> [output]    join the IotaGFT_LOG segments in folder into one file
+IotaGFTapp regenerate [options] <log>      time the flash edges in an IotaGFT_LOG (or a folder of its segments) again
+    -model bracket|fit    bracket: between the 1pps either side of the edge (as done live)
+                          fit: least squares line through the 1pps around the edge
+    -offset N             correct GPRMC times to GpsUtcOffset N (default: the almanac value in the log)
+    -from "YYYY-MM-DD hh:mm:ss"  -to "YYYY-MM-DD hh:mm:ss"   only time flash edges in this UTC window
+    -o <file>             output file (default: FLASH_EDGE_TIMES_regenerated.txt next to the log)
+IotaGFTapp archive2text [options] <archive> [output]   write a binary sentence archive as an IotaGFT_LOG text file
+    -from "YYYY-MM-DD hh:mm:ss"  -to "YYYY-MM-DD hh:mm:ss"   only sentences received in this UTC (computer clock) window`
+
+// runSubcommand runs the offline tool named by args[0]. It returns false if args[0] does not name a tool,
+// in which case it is the optional baudrate.
+func runSubcommand(args []string) bool {
+	switch args[0] {
+	case "reassemble":
+		os.Exit(reassembleCommand(args[1:]))
+	case "regenerate":
+		os.Exit(regenerateCommand(args[1:]))
+	case "archive2text":
+		os.Exit(archiveToTextCommand(args[1:]))
+	case "help", "-h", "--help":
+		fmt.Println(subcommandUsage)
+		os.Exit(0)
+	}
+	return false
+}
+
+func reassembleCommand(args []string) int {
+	if len(args) < 1 || len(args) > 2 {
+		fmt.Println(subcommandUsage)
+		return 2
+	}
+	dir := args[0]
+	outPath := filepath.Join(dir, "IotaGFT_LOG_reassembled.txt")
+	if len(args) == 2 {
+		outPath = args[1]
+	}
+	missing, err := reassembleSentenceLog(dir, outPath)
+	if err != nil {
+		fmt.Println("reassemble failed:", err)
+		return 1
+	}
+	fmt.Println("Sentence log written to", outPath)
+	if missing > 0 {
+		fmt.Printf("%d segment(s) outside the recording window were not in %s - see the '# missing segment' lines\n",
+			missing, dir)
+	}
+	return 0
+}
+
+func regenerateCommand(args []string) int {
+	flags := flag.NewFlagSet("regenerate", flag.ContinueOnError)
+	model := flags.String("model", edgeModelBracket, "")
+	offset := flags.Int("offset", 0, "")
+	from := flags.String("from", "", "")
+	to := flags.String("to", "", "")
+	outPath := flags.String("o", "", "")
+	flags.Usage = func() { fmt.Println(subcommandUsage) }
+	if flags.Parse(args) != nil || flags.NArg() != 1 {
+		fmt.Println(subcommandUsage)
+		return 2
+	}
+
+	opts := RegenerateOptions{model: *model, gpsUtcOffset: *offset}
+	var err error
+	if *from != "" {
+		if opts.from, err = time.Parse(time.DateTime, *from); err != nil {
+			fmt.Println("-from is not a valid UTC time:", err)
+			return 2
+		}
+	}
+	if *to != "" {
+		if opts.to, err = time.Parse(time.DateTime, *to); err != nil {
+			fmt.Println("-to is not a valid UTC time:", err)
+			return 2
+		}
+	}
+
+	// A folder holds the segments of a rotated log, which are joined first
+	logPath := flags.Arg(0)
+	info, err := os.Stat(logPath)
+	if err != nil {
+		fmt.Println("regenerate failed:", err)
+		return 1
+	}
+	logDir := filepath.Dir(logPath)
+	if info.IsDir() {
+		logDir = logPath
+		logPath = filepath.Join(logDir, "IotaGFT_LOG_reassembled.txt")
+		if _, err = reassembleSentenceLog(logDir, logPath); err != nil {
+			fmt.Println("regenerate failed:", err)
+			return 1
+		}
+	}
+	if *outPath == "" {
+		*outPath = filepath.Join(logDir, regeneratedFlashEdgeTimesFile)
+	}
+
+	leapTable, err := loadLeapSecondTable(filepath.Join(getWorkDir(), leapSecondFile))
+	if err != nil {
+		fmt.Println("leap second file not loaded:", err)
+	}
+	replay, timedEdges, err := regenerateFlashEdgeTimes(logPath, *outPath, opts, leapTable)
+	if err != nil {
+		fmt.Println("regenerate failed:", err)
+		return 1
+	}
+	fmt.Printf("%d of %d flash edges timed from %d 1pps (%d lost) and written to %s\n",
+		len(timedEdges), len(replay.edges), len(replay.data.tickStamp), len(replay.data.gaps), *outPath)
+	return 0
+}
+
+func archiveToTextCommand(args []string) int {
+	flags := flag.NewFlagSet("archive2text", flag.ContinueOnError)
+	from := flags.String("from", "", "")
+	to := flags.String("to", "", "")
+	flags.Usage = func() { fmt.Println(subcommandUsage) }
+	if flags.Parse(args) != nil || flags.NArg() < 1 || flags.NArg() > 2 {
+		fmt.Println(subcommandUsage)
+		return 2
+	}
+
+	var fromTime, toTime time.Time
+	var err error
+	if *from != "" {
+		if fromTime, err = time.Parse(time.DateTime, *from); err != nil {
+			fmt.Println("-from is not a valid UTC time:", err)
+			return 2
+		}
+	}
+	if *to != "" {
+		if toTime, err = time.Parse(time.DateTime, *to); err != nil {
+			fmt.Println("-to is not a valid UTC time:", err)
+			return 2
+		}
+	}
+
+	archivePath := flags.Arg(0)
+	dir := filepath.Dir(archivePath)
+	outPath := filepath.Join(dir, "IotaGFT_LOG_from_archive.txt")
+	if flags.NArg() == 2 {
+		outPath = flags.Arg(1)
+	}
+	count, err := convertArchiveToText(archivePath, filepath.Join(dir, sentenceArchiveIndexFile), outPath, fromTime, toTime)
+	if err != nil {
+		fmt.Println("archive2text failed:", err)
+		return 1
+	}
+	fmt.Printf("%d sentences written to %s\n", count, outPath)
+	return 0
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The optional time server answers SNTP (RFC 4330) requests on localhost with the UTC of the GFT, so
+// that other software on the observing computer (or an NTP daemon configured with it as a server) can
+// use GPS time. Its time is the computer clock disciplined to the 1pps (see PPSClock). It listens on an
+// unprivileged port unless the standard NTP port (which may need administrator rights) is chosen.
+const (
+	defaultTimeServerPort = 12300
+	ntpStandardPort       = 123
+	ntpPacketSize         = 48
+	ntpEpochOffset        = 2208988800 // seconds from 1900-01-01 (the NTP epoch) to 1970-01-01
+	ntpModeClient         = 3
+	ntpModeServer         = 4
+	ntpUnsynchronized     = 3               // leap indicator: the clock is not synchronized
+	ntpStratumUnsynced    = 16              // stratum of a server without a usable reference
+	ntpPrecision          = 0xF6            // -10 as a signed byte: about a millisecond, the USB delay jitter
+	timeServiceTicks      = 61              // the latest 1pps used to discipline the clock
+	timeServiceStaleAfter = 3 * time.Second // the clock is no longer synchronized this long after the last 1pps
+	timeServiceDrift      = 50e-6           // assumed worst rate error of the computer clock between 1pps
+	ntpMaxShort           = 0xFFFFFFFF      // the largest root dispersion that can be given
+)
+
+// TimeServiceState is what the time server knows of GPS time, published by runApp after every 1pps
+type TimeServiceState struct {
+	clock       PPSClock
+	valid       bool      // the clock has been fitted
+	lastPPSHost time.Time // host time of the latest P sentence
+	lastPPSUTC  time.Time // its GPS second
+	almanac     bool      // the GpsUtcOffset has been confirmed by the almanac
+	leap        uint8     // leap indicator: 1 if a leap second will be inserted within 24 hours, 2 if deleted
+}
+
+type TimeService struct {
+	mu    sync.Mutex
+	state TimeServiceState
+	conn  *net.UDPConn
+}
+
+var timeService TimeService
+
+func (ts *TimeService) publish(state TimeServiceState) {
+	ts.mu.Lock()
+	ts.state = state
+	ts.mu.Unlock()
+}
+
+func (ts *TimeService) snapshot() TimeServiceState {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.state
+}
+
+func (ts *TimeService) running() bool {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.conn != nil
+}
+
+// synchronized reports whether the state can be served as a stratum 1 clock at host time now
+func (state TimeServiceState) synchronized(now time.Time) bool {
+	return state.valid && state.almanac && now.Sub(state.lastPPSHost) < timeServiceStaleAfter
+}
+
+// publishTimeService is called after each 1pps to update what the time server serves
+func publishTimeService(data *OnePPSdata, gpsInfo GPSdata) {
+	if !timeService.running() || gpsInfo.hostTime.IsZero() || len(data.tickStamp) == 0 {
+		return
+	}
+	recent := OnePPSdata{tickStamp: data.tickStamp[max(0, len(data.tickStamp)-timeServiceTicks):]}
+	clock, err := fitPPSClock(&recent, gpsInfo.hostTime, ppsClockHalfWindow)
+	state := TimeServiceState{clock: clock, valid: err == nil, lastPPSHost: gpsInfo.hostTime}
+
+	latest := data.tickStamp[len(data.tickStamp)-1]
+	state.lastPPSUTC, _ = convertTimestampToTimeObject(latest.utcTimestamp)
+	if n := len(data.offsetEpochs); n > 0 {
+		state.almanac = data.offsetEpochs[n-1].source == offsetSourceAlmanac
+	}
+	if pending, ok := pendingLeapSecond(leapSecondTable, state.lastPPSUTC); ok &&
+		pending.effective.Sub(state.lastPPSUTC) <= 24*time.Hour {
+		state.leap = 1
+		if pending.gpsUtcOffset < leapSecondOffsetAt(leapSecondTable, state.lastPPSUTC) {
+			state.leap = 2
+		}
+	}
+	timeService.publish(state)
+}
+
+func ntpTimestamp(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + ntpEpochOffset)
+	fraction := uint64(t.Nanosecond()) << 32 / 1_000_000_000
+	return seconds<<32 | fraction
+}
+
+// ntpShort converts seconds to the NTP short format (16.16 fixed point) used for root delay and dispersion.
+// Values beyond its range are clamped.
+func ntpShort(seconds float64) uint32 {
+	value := seconds * 65536
+	if value >= ntpMaxShort {
+		return ntpMaxShort
+	}
+	return uint32(max(0, value))
+}
+
+// ntpResponse builds the reply to an SNTP client request received at host time received, to be sent at
+// host time transmit
+func ntpResponse(request []byte, received, transmit time.Time, state TimeServiceState) ([]byte, error) {
+	if len(request) < ntpPacketSize {
+		return nil, errors.New("ntpResponse(): request too short")
+	}
+	if request[0]&0x7 != ntpModeClient {
+		return nil, fmt.Errorf("ntpResponse(): mode %d is not a client request", request[0]&0x7)
+	}
+	version := request[0] >> 3 & 0x7
+
+	response := make([]byte, ntpPacketSize)
+	leap, stratum := uint8(ntpUnsynchronized), uint8(ntpStratumUnsynced)
+	if state.synchronized(transmit) {
+		leap, stratum = state.leap, 1
+	}
+	response[0] = leap<<6 | version<<3 | ntpModeServer
+	response[1] = stratum
+	response[2] = request[2] // poll
+	response[3] = ntpPrecision
+	// root delay (bytes 4-7) is zero: the reference clock is attached to this computer. Without a 1pps
+	// the dispersion is unknown and given as the largest there is.
+	dispersion := uint32(ntpMaxShort)
+	if state.valid {
+		dispersion = ntpShort(state.clock.jitter + transmit.Sub(state.lastPPSHost).Seconds()*timeServiceDrift)
+	}
+	binary.BigEndian.PutUint32(response[8:], dispersion)
+	copy(response[12:16], "GPS")
+	copy(response[24:32], request[40:48]) // originate timestamp: the client's transmit timestamp
+
+	if state.valid {
+		binary.BigEndian.PutUint64(response[16:], ntpTimestamp(state.lastPPSUTC))
+		binary.BigEndian.PutUint64(response[32:], ntpTimestamp(state.clock.utc(received)))
+		binary.BigEndian.PutUint64(response[40:], ntpTimestamp(state.clock.utc(transmit)))
+	} else {
+		// Nothing to discipline the clock with yet: serve the computer clock as unsynchronized
+		binary.BigEndian.PutUint64(response[32:], ntpTimestamp(received))
+		binary.BigEndian.PutUint64(response[40:], ntpTimestamp(transmit))
+	}
+	return response, nil
+}
+
+// startTimeServer starts answering SNTP requests on localhost at port (0: any free port). It returns the
+// address listened on.
+func startTimeServer(port int) (string, error) {
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return "", fmt.Errorf("startTimeServer(): %w", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return "", fmt.Errorf("startTimeServer(): %w", err)
+	}
+	timeService.mu.Lock()
+	timeService.conn = conn
+	timeService.mu.Unlock()
+	go serveTime(conn)
+	serverLog.Info("time server started", "address", conn.LocalAddr().String())
+	return conn.LocalAddr().String(), nil
+}
+
+func serveTime(conn *net.UDPConn) {
+	buffer := make([]byte, 512)
+	for {
+		n, client, err := conn.ReadFromUDP(buffer)
+		received := time.Now()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			serverLog.Warn("time server read failed", "err", err)
+			continue
+		}
+		response, err := ntpResponse(buffer[:n], received, time.Now(), timeService.snapshot())
+		if err != nil {
+			serverLog.Debug("time request ignored", "client", client.String(), "err", err)
+			continue
+		}
+		_, err = conn.WriteToUDP(response, client)
+		if err != nil {
+			serverLog.Warn("time server reply failed", "client", client.String(), "err", err)
+		}
+	}
+}
+
+func stopTimeServer() {
+	timeService.mu.Lock()
+	conn := timeService.conn
+	timeService.conn = nil
+	timeService.mu.Unlock()
+	if conn != nil {
+		_ = conn.Close()
+		serverLog.Info("time server stopped")
+	}
+}
+
+// processTimeServerCheck starts or stops the time server
+func processTimeServerCheck(checked bool) {
+	myWin.App.Preferences().SetBool("TimeServer", checked)
+	if !checked {
+		stopTimeServer()
+		return
+	}
+	if timeService.running() {
+		return
+	}
+	_, err := startTimeServer(timeServerPort())
+	if err != nil {
+		serverLog.Error("time server not started", "err", err)
+		showMsg("Time server", fmt.Sprintf("\nThe time server could not be started:\n\n%v\n", err), 200, 600)
+	}
+}
+
+// timeServerPort returns the port to serve time on: the standard NTP port if chosen, otherwise the
+// TimeServerPort preference
+func timeServerPort() int {
+	if myWin.App.Preferences().BoolWithFallback("TimeServerStandardPort", false) {
+		return ntpStandardPort
+	}
+	return myWin.App.Preferences().IntWithFallback("TimeServerPort", defaultTimeServerPort)
+}
+
+// processTimeServerStandardPortCheck chooses whether the time server uses the standard NTP port, and
+// restarts it on the chosen port if it is running
+func processTimeServerStandardPortCheck(checked bool) {
+	myWin.App.Preferences().SetBool("TimeServerStandardPort", checked)
+	if timeService.running() {
+		stopTimeServer()
+		processTimeServerCheck(true)
+	}
+}
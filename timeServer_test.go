@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+)
+
+func ntpRequest(transmit uint64) []byte {
+	request := make([]byte, ntpPacketSize)
+	request[0] = 4<<3 | ntpModeClient
+	request[2] = 6
+	binary.BigEndian.PutUint64(request[40:], transmit)
+	return request
+}
+
+func ntpTime(packet []byte, at int) time.Time {
+	value := binary.BigEndian.Uint64(packet[at:])
+	seconds := int64(value>>32) - ntpEpochOffset
+	return time.Unix(seconds, int64((value&0xFFFFFFFF)*1_000_000_000>>32)).UTC()
+}
+
+func Test_ntpResponse(t *testing.T) {
+	now := time.Now()
+	gpsSecond := time.Date(2024, 3, 1, 0, 0, 5, 0, time.UTC)
+	state := TimeServiceState{
+		clock:       PPSClock{refHost: now, refUTC: gpsSecond, rate: 1, jitter: 0.002},
+		valid:       true,
+		lastPPSHost: now,
+		lastPPSUTC:  gpsSecond,
+		almanac:     true,
+	}
+
+	response, err := ntpResponse(ntpRequest(0x1122334455667788), now.Add(250*time.Millisecond), now.Add(251*time.Millisecond), state)
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(4<<3|ntpModeServer), response[0]) // no leap second warning, version 4
+	assert.Equal(t, uint8(1), response[1])
+	assert.Equal(t, uint8(6), response[2])
+	assert.Equal(t, "GPS", string(response[12:15]))
+	assert.Equal(t, uint64(0x1122334455667788), binary.BigEndian.Uint64(response[24:]))
+	assert.Equal(t, gpsSecond, ntpTime(response, 16))
+	assert.InDelta(t, 0, ntpTime(response, 32).Sub(gpsSecond.Add(250*time.Millisecond)), float64(time.Microsecond))
+	assert.InDelta(t, 0, ntpTime(response, 40).Sub(gpsSecond.Add(251*time.Millisecond)), float64(time.Microsecond))
+	assert.InDelta(t, 0.002, float64(binary.BigEndian.Uint32(response[8:]))/65536, 0.0001)
+
+	// Until the almanac has confirmed the GpsUtcOffset, or once the 1pps stops, the time is unsynchronized
+	state.almanac = false
+	response, _ = ntpResponse(ntpRequest(0), now, now, state)
+	assert.Equal(t, uint8(ntpUnsynchronized), response[0]>>6)
+	assert.Equal(t, uint8(ntpStratumUnsynced), response[1])
+	state.almanac = true
+	response, _ = ntpResponse(ntpRequest(0), now, now.Add(timeServiceStaleAfter), state)
+	assert.Equal(t, uint8(ntpStratumUnsynced), response[1])
+
+	state.leap = 1
+	response, _ = ntpResponse(ntpRequest(0), now, now, state)
+	assert.Equal(t, uint8(1), response[0]>>6)
+
+	// Before the clock has been fitted the dispersion is the largest there is
+	response, _ = ntpResponse(ntpRequest(0), now, now, TimeServiceState{})
+	assert.Equal(t, uint32(ntpMaxShort), binary.BigEndian.Uint32(response[8:]))
+	assert.Equal(t, uint32(ntpMaxShort), ntpShort(now.Sub(time.Time{}).Seconds()*timeServiceDrift))
+	assert.Equal(t, uint32(0), ntpShort(-1))
+
+	_, err = ntpResponse(make([]byte, 20), now, now, state)
+	assert.NotNil(t, err)
+	serverPacket := ntpRequest(0)
+	serverPacket[0] = 4<<3 | ntpModeServer
+	_, err = ntpResponse(serverPacket, now, now, state)
+	assert.NotNil(t, err)
+}
+
+func Test_timeServer(t *testing.T) {
+	address, err := startTimeServer(0)
+	assert.Nil(t, err)
+	defer stopTimeServer()
+
+	now := time.Now()
+	gpsSecond := time.Date(2024, 3, 1, 0, 0, 5, 0, time.UTC)
+	timeService.publish(TimeServiceState{
+		clock:       PPSClock{refHost: now, refUTC: gpsSecond, rate: 1},
+		valid:       true,
+		lastPPSHost: now,
+		lastPPSUTC:  gpsSecond,
+		almanac:     true,
+	})
+
+	conn, err := net.Dial("udp", address)
+	assert.Nil(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Write(ntpRequest(0))
+	assert.Nil(t, err)
+	response := make([]byte, 100)
+	n, err := conn.Read(response)
+	assert.Nil(t, err)
+	assert.Equal(t, ntpPacketSize, n)
+	assert.Equal(t, uint8(1), response[1])
+	assert.InDelta(t, 0, ntpTime(response, 40).Sub(gpsSecond.Add(time.Since(now))), float64(100*time.Millisecond))
+}
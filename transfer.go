@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const transferStatusFile = "TRANSFER_STATUS.txt"
+
+const transferAttempts = 3
+
+var transferRetryDelay = 2 * time.Second
+
+type TransferResult struct {
+	name      string
+	delivered bool  // the copy in the capture folder has been verified
+	attempts  int   // number of copy attempts made
+	localKept bool  // the session directory still holds the file
+	skipped   bool  // the file was deliberately not delivered
+	err       error // the reason the file was not delivered (or its local copy not removed)
+}
+
+// copyFileSynced copies sourcePath to destPath through a temporary file that is flushed to disk
+// before being renamed into place, so destPath never holds a partial copy.
+func copyFileSynced(sourcePath, destPath string) error {
+	inputFile, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("couldn't open source file: %w", err)
+	}
+	defer inputFile.Close()
+
+	tempPath := destPath + ".partial"
+	outputFile, err := os.Create(tempPath)
+	if err != nil {
+		return fmt.Errorf("couldn't open dest file: %w", err)
+	}
+
+	_, err = io.Copy(outputFile, inputFile)
+	if err == nil {
+		err = outputFile.Sync()
+	}
+	closeErr := outputFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("couldn't copy to dest from source: %w", err)
+	}
+
+	err = os.Rename(tempPath, destPath)
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("couldn't rename %s: %w", tempPath, err)
+	}
+	return nil
+}
+
+// transferFile copies sourcePath to destPath and verifies the copy against expectedSHA (the checksum
+// recorded in the session manifest). A copy that cannot be verified is removed and the copy retried.
+// The source is removed only once its copy has been verified, and never if keepSource is set.
+func transferFile(sourcePath, destPath, expectedSHA string, keepSource bool) TransferResult {
+	result := TransferResult{name: filepath.Base(sourcePath), localKept: true}
+
+	for result.attempts < transferAttempts {
+		if result.attempts > 0 {
+			time.Sleep(transferRetryDelay)
+		}
+		result.attempts++
+
+		result.err = copyFileSynced(sourcePath, destPath)
+		if result.err != nil {
+			continue
+		}
+
+		sum, _, err := fileSHA256(destPath)
+		if err != nil || sum != expectedSHA {
+			result.err = fmt.Errorf("copy of %s failed verification (sha256 %s, expected %s): %v",
+				result.name, sum, expectedSHA, err)
+			_ = os.Remove(destPath) // A half copied file is worse than none
+			continue
+		}
+		result.delivered = true
+		result.err = nil
+		break
+	}
+
+	if result.delivered && !keepSource {
+		err := os.Remove(sourcePath)
+		if err != nil {
+			result.err = fmt.Errorf("delivered, but couldn't remove local copy: %w", err)
+		} else {
+			result.localKept = false
+		}
+	}
+	return result
+}
+
+func transferStatusText(captureDir string, results []TransferResult) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# IotaGFTapp %s transfer status\n", Version))
+	sb.WriteString(fmt.Sprintf("# to: %s\n", captureDir))
+	sb.WriteString(fmt.Sprintf("# written: %s UTC\n", time.Now().UTC().Format(time.DateTime)))
+	for _, r := range results {
+		status := "NOT DELIVERED"
+		if r.delivered {
+			status = "delivered"
+		} else if r.skipped {
+			status = "not needed"
+		}
+		line := fmt.Sprintf("%-13s %s (attempts: %d, local copy kept: %v)", status, r.name, r.attempts, r.localKept)
+		if r.err != nil {
+			line += " - " + r.err.Error()
+		}
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+// deliverSessionFiles transfers the files listed in the manifest of a finished session to the SharpCap
+// capture folder, verifying each copy against the checksum in the manifest, then writes a status record
+// of what was and wasn't delivered to both folders. Files for which include returns false stay in the
+// session directory. It returns false if any other file was not delivered.
+func deliverSessionFiles(sessionDir, captureDir string, include func(name string) bool) ([]TransferResult, bool) {
+	entries, err := readManifest(sessionDir)
+	if err != nil {
+		filesLog.Error("session files not delivered", "err", err)
+		return nil, false
+	}
+
+	allDelivered := true
+	var results []TransferResult
+	for _, entry := range entries {
+		if include != nil && !include(entry.name) {
+			results = append(results, TransferResult{name: entry.name, localKept: true, skipped: true})
+			continue
+		}
+		result := transferFile(filepath.Join(sessionDir, entry.name), filepath.Join(captureDir, entry.name),
+			entry.sha256, false)
+		if !result.delivered {
+			allDelivered = false
+		}
+		if result.err != nil {
+			filesLog.Warn("transfer problem", "file", entry.name, "attempts", result.attempts,
+				"delivered", result.delivered, "err", result.err)
+		}
+		results = append(results, result)
+	}
+
+	// The manifest always stays with the session as the record of what was produced
+	manifestSHA, _, err := fileSHA256(filepath.Join(sessionDir, manifestFile))
+	if err == nil {
+		results = append(results, transferFile(filepath.Join(sessionDir, manifestFile),
+			filepath.Join(captureDir, manifestFile), manifestSHA, true))
+	} else {
+		results = append(results, TransferResult{name: manifestFile, localKept: true, err: err})
+	}
+	if !results[len(results)-1].delivered {
+		allDelivered = false
+	}
+
+	status := transferStatusText(captureDir, results)
+	statusPath := filepath.Join(sessionDir, transferStatusFile)
+	err = os.WriteFile(statusPath, []byte(status), 0644)
+	if err != nil {
+		filesLog.Error("transfer status not written", "err", err)
+	} else {
+		err = copyFileSynced(statusPath, filepath.Join(captureDir, transferStatusFile))
+		if err != nil {
+			filesLog.Error("transfer status not copied to the capture folder", "err", err)
+		}
+	}
+	filesLog.Info("session files transferred", "to", captureDir, "allDelivered", allDelivered, "status", status)
+	return results, allDelivered
+}
+
+// closeAndDeliverSession closes the current session (this writes its manifest), starts a new one and
+// transfers the files of the closed session to captureDir. The transfer (with its retries) runs in the
+// background so that it does not hold up the 1pps processing; done, if not nil, is called once it is
+// over. Only the sentence log segments that cover the GPS unix times from..to are delivered.
+func closeAndDeliverSession(captureDir string, from, to int64,
+	done func(sessionDir string, results []TransferResult, allDelivered bool)) {
+	sessionDir := finishSession()
+
+	segments, err := readSentenceLogIndex(sessionDir)
+	if err != nil {
+		filesLog.Error("sentence log index not read", "err", err)
+	}
+	wanted := segmentsForWindow(segments, from-sentenceLogMargin, to+sentenceLogMargin)
+
+	// Create a new session with a new set of Log and FlashEdge files
+	createLogAndFlashEdgeFiles(getWorkDir())
+
+	go func() {
+		results, allDelivered := deliverSessionFiles(sessionDir, captureDir, func(name string) bool {
+			return !isRolledSentenceLogSegment(name) || wanted[name]
+		})
+		if done != nil {
+			done(sessionDir, results, allDelivered)
+		}
+	}()
+}
+
+func showTransferProblem(sessionDir, captureDir string, results []TransferResult) {
+	showMsg("File transfer problem",
+		fmt.Sprintf("\nNot all files reached the capture folder. Anything not delivered is still in:\n\n%s\n\n%s",
+			sessionDir, transferStatusText(captureDir, results)), 400, 900)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_transferFile(t *testing.T) {
+	sessionDir, captureDir := t.TempDir(), t.TempDir()
+	source := filepath.Join(sessionDir, flashEdgeTimesFile)
+	assert.Nil(t, os.WriteFile(source, []byte("1 on  2024-03-01T10:00:00.000000Z|18\n"), 0644))
+	sum, _, err := fileSHA256(source)
+	assert.Nil(t, err)
+
+	result := transferFile(source, filepath.Join(captureDir, flashEdgeTimesFile), sum, false)
+	assert.True(t, result.delivered)
+	assert.False(t, result.localKept)
+	assert.Equal(t, 1, result.attempts)
+	_, err = os.Stat(source)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_transferFileFailsVerification(t *testing.T) {
+	saved := transferRetryDelay
+	t.Cleanup(func() { transferRetryDelay = saved })
+	transferRetryDelay = 0
+	sessionDir, captureDir := t.TempDir(), t.TempDir()
+	source := filepath.Join(sessionDir, sentenceLogFile)
+	assert.Nil(t, os.WriteFile(source, []byte("some sentences\n"), 0644))
+
+	dest := filepath.Join(captureDir, sentenceLogFile)
+	result := transferFile(source, dest, "not the right checksum", false)
+	assert.False(t, result.delivered)
+	assert.True(t, result.localKept)
+	assert.Equal(t, transferAttempts, result.attempts)
+
+	// Neither a bad copy nor a partial copy may be left in the capture folder
+	files, _ := os.ReadDir(captureDir)
+	assert.Equal(t, 0, len(files))
+	_, err := os.Stat(source)
+	assert.Nil(t, err)
+}
+
+func Test_deliverSessionFiles(t *testing.T) {
+	sessionDir, captureDir := t.TempDir(), t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(sessionDir, flashEdgeTimesFile), []byte("edges"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(sessionDir, sentenceLogFile), []byte("sentences"), 0644))
+	_, err := writeManifest(sessionDir, true)
+	assert.Nil(t, err)
+
+	results, allDelivered := deliverSessionFiles(sessionDir, captureDir, nil)
+	assert.True(t, allDelivered)
+	assert.Equal(t, 3, len(results))
+
+	for _, name := range []string{flashEdgeTimesFile, sentenceLogFile, manifestFile, transferStatusFile} {
+		_, err = os.Stat(filepath.Join(captureDir, name))
+		assert.Nil(t, err, name)
+	}
+	// Only the manifest and the transfer status remain with the session
+	files, _ := os.ReadDir(sessionDir)
+	assert.Equal(t, 2, len(files))
+}
+
+func Test_deliverSessionFilesVerifiesAgainstManifest(t *testing.T) {
+	saved := transferRetryDelay
+	t.Cleanup(func() { transferRetryDelay = saved })
+	transferRetryDelay = 0
+	sessionDir, captureDir := t.TempDir(), t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(sessionDir, flashEdgeTimesFile), []byte("edges"), 0644))
+	_, err := writeManifest(sessionDir, true)
+	assert.Nil(t, err)
+
+	// A file changed after the manifest was written is not delivered, and one it does not list is left alone
+	assert.Nil(t, os.WriteFile(filepath.Join(sessionDir, flashEdgeTimesFile), []byte("changed edges"), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(sessionDir, sentenceLogFile), []byte("sentences"), 0644))
+
+	results, allDelivered := deliverSessionFiles(sessionDir, captureDir, nil)
+	assert.False(t, allDelivered)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, flashEdgeTimesFile, results[0].name)
+	assert.False(t, results[0].delivered)
+	assert.True(t, results[0].localKept)
+	_, err = os.Stat(filepath.Join(captureDir, flashEdgeTimesFile))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(sessionDir, sentenceLogFile))
+	assert.Nil(t, err)
+}
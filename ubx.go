@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The receiver of the GFT is a u-blox. Besides NMEA it speaks UBX, a binary protocol: a frame is
+//
+//	0xB5 0x62 class id length(2 bytes, little endian) payload checksum(2 bytes)
+//
+// Firmware that passes UBX frames through sends them between the sentences. getNextSentence takes each
+// frame out of the serial data whole (its payload may contain a CR LF) and turns it into a text
+// sentence "UBX cc ii payload" (class, id and payload in hex) with the usual *xx checksum, so that it
+// is logged, archived and parsed like any other sentence.
+const (
+	ubxSync1         = 0xB5
+	ubxSync2         = 0x62
+	ubxHeaderSize    = 6 // sync, class, id and length
+	ubxMaxPayload    = 1024
+	ubxTextPrefix    = "UBX "
+	ubxClassNAV      = 0x01
+	ubxClassTIM      = 0x0D
+	ubxIDNavTimeUTC  = 0x21
+	ubxIDNavClock    = 0x22
+	ubxIDTimTP       = 0x01
+	timTPQErrInvalid = 0x10 // TIM-TP flags: the quantization error is not valid
+	navTimeUTCValid  = 0x04 // NAV-TIMEUTC valid: UTC is valid (the leap seconds are known)
+)
+
+// ubxMessageNames are the names of the UBX messages that are decoded, by class and id
+var ubxMessageNames = map[[2]byte]string{
+	{ubxClassTIM, ubxIDTimTP}:      "TIM-TP",
+	{ubxClassNAV, ubxIDNavTimeUTC}: "NAV-TIMEUTC",
+	{ubxClassNAV, ubxIDNavClock}:   "NAV-CLOCK",
+}
+
+type UBXFrame struct {
+	class   byte
+	id      byte
+	payload []byte
+}
+
+func (f UBXFrame) name() string {
+	if name, ok := ubxMessageNames[[2]byte{f.class, f.id}]; ok {
+		return name
+	}
+	return fmt.Sprintf("%02X-%02X", f.class, f.id)
+}
+
+// text is the frame as a sentence, checksum included
+func (f UBXFrame) text() string {
+	sentence := fmt.Sprintf("%s%02X %02X", ubxTextPrefix, f.class, f.id)
+	if len(f.payload) > 0 {
+		sentence += fmt.Sprintf(" %X", f.payload)
+	}
+	checksum, _ := calcChecksum(sentence)
+	return sentence + checksum
+}
+
+// ubxChecksum is the 8-bit Fletcher checksum of the class, id, length and payload of a frame
+func ubxChecksum(data []byte) (byte, byte) {
+	var a, b byte
+	for _, c := range data {
+		a += c
+		b += a
+	}
+	return a, b
+}
+
+// encodeUBX returns the frame of a UBX message
+func encodeUBX(class, id byte, payload []byte) []byte {
+	frame := make([]byte, ubxHeaderSize, ubxHeaderSize+len(payload)+2)
+	frame[0], frame[1], frame[2], frame[3] = ubxSync1, ubxSync2, class, id
+	binary.LittleEndian.PutUint16(frame[4:], uint16(len(payload)))
+	frame = append(frame, payload...)
+	a, b := ubxChecksum(frame[2:])
+	return append(frame, a, b)
+}
+
+// nextUBXFrame takes the first UBX frame out of the serial data in buffer, if it starts before the first
+// boundary marker. It returns the frame (nil if there is none), the rest of the data and whether a frame
+// has started that has not been received in full, in which case nothing is to be taken out of the data
+// until it has. A frame with a bad checksum or length is dropped, as is a partial frame once a whole sentence
+// has arrived after its start: the sync characters were in a sentence, and the frame would hold back the
+// sentences until its length had been received.
+func nextUBXFrame(buffer, boundaryMarker string) (*UBXFrame, string, bool) {
+	sync := strings.Index(buffer, string([]byte{ubxSync1, ubxSync2}))
+	if sync < 0 {
+		return nil, buffer, false
+	}
+	if marker := strings.Index(buffer, boundaryMarker); marker >= 0 && marker < sync {
+		return nil, buffer, false // a sentence comes first
+	}
+	data := buffer[sync:]
+	if len(data) < ubxHeaderSize {
+		return nil, buffer, true
+	}
+	length := int(binary.LittleEndian.Uint16([]byte(data[4:6])))
+	if length > ubxMaxPayload {
+		serialLog.Warn("UBX frame dropped", "reason", "length", "length", length)
+		return nil, buffer[:sync] + data[2:], false
+	}
+	end := ubxHeaderSize + length + 2
+	if len(data) < end {
+		if holdsSentence(data[ubxHeaderSize:], boundaryMarker) {
+			serialLog.Warn("UBX frame dropped", "reason", "sentence received", "class", data[2], "id", data[3])
+			return nil, buffer[:sync] + data[2:], false
+		}
+		return nil, buffer, true
+	}
+	a, b := ubxChecksum([]byte(data[2 : end-2]))
+	if a != data[end-2] || b != data[end-1] {
+		serialLog.Warn("UBX frame dropped", "reason", "checksum", "class", data[2], "id", data[3])
+		return nil, buffer[:sync] + data[2:], false
+	}
+	frame := &UBXFrame{class: data[2], id: data[3], payload: []byte(data[ubxHeaderSize : end-2])}
+	return frame, buffer[:sync] + data[end:], false
+}
+
+// holdsSentence tells whether data has a whole sentence with a good checksum between two boundary markers.
+// A UBX payload may contain a boundary marker, but not such a sentence.
+func holdsSentence(data, boundaryMarker string) bool {
+	parts := strings.Split(data, boundaryMarker)
+	if len(parts) < 3 {
+		return false
+	}
+	for _, part := range parts[1 : len(parts)-1] {
+		if sentence, checksum, err := splitChecksum(part); err == nil {
+			if chkSum, _ := calcChecksum(sentence); chkSum == checksum {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// A TIMTPSentence (UBX TIM-TP) describes the next 1pps
+type TIMTPSentence struct {
+	sentenceBase
+	towMS    uint32 // GPS time of week of the next 1pps (ms)
+	towSubMS uint32 // its fraction of a ms (ms * 2^-32)
+	qErr     int32  // quantization error of the next 1pps (ps): it is that much later than the GPS second
+	week     uint16
+	flags    uint8
+	refInfo  uint8
+}
+
+func (s *TIMTPSentence) Kind() string { return "UBX" }
+
+func (s *TIMTPSentence) qErrValid() bool { return s.flags&timTPQErrInvalid == 0 }
+
+func (s *TIMTPSentence) Text() string {
+	return fmt.Sprintf("%s (TIM-TP week %d tow %d ms qErr %d ps)", s.text, s.week, s.towMS, s.qErr)
+}
+
+// A NAVTimeUTCSentence (UBX NAV-TIMEUTC) gives UTC and whether the receiver knows the leap seconds
+type NAVTimeUTCSentence struct {
+	sentenceBase
+	iTOW   uint32
+	tAcc   uint32 // ns
+	nano   int32
+	year   uint16
+	month  uint8
+	day    uint8
+	hour   uint8
+	minute uint8
+	second uint8
+	valid  uint8
+}
+
+func (s *NAVTimeUTCSentence) Kind() string { return "UBX" }
+
+func (s *NAVTimeUTCSentence) utcValid() bool { return s.valid&navTimeUTCValid != 0 }
+
+func (s *NAVTimeUTCSentence) Text() string {
+	return fmt.Sprintf("%s (NAV-TIMEUTC %04d-%02d-%02d %02d:%02d:%02d tAcc %d ns validUTC %t)", s.text,
+		s.year, s.month, s.day, s.hour, s.minute, s.second, s.tAcc, s.utcValid())
+}
+
+// A NAVClockSentence (UBX NAV-CLOCK) gives the receiver clock solution
+type NAVClockSentence struct {
+	sentenceBase
+	iTOW uint32
+	clkB int32  // clock bias (ns)
+	clkD int32  // clock drift (ns/s)
+	tAcc uint32 // time accuracy estimate (ns)
+	fAcc uint32 // frequency accuracy estimate (ps/s)
+}
+
+func (s *NAVClockSentence) Kind() string { return "UBX" }
+
+func (s *NAVClockSentence) Text() string {
+	return fmt.Sprintf("%s (NAV-CLOCK bias %d ns drift %d ns/s tAcc %d ns)", s.text, s.clkB, s.clkD, s.tAcc)
+}
+
+// A UBXSentence is any other UBX message. It is displayed but not processed.
+type UBXSentence struct {
+	sentenceBase
+	frame UBXFrame
+}
+
+func (s *UBXSentence) Kind() string { return "UBX" }
+
+// parseUBXFields parses the class, id and (optional) payload of a UBX frame, in hex
+func parseUBXFields(fields []string) (UBXFrame, error) {
+	var frame UBXFrame
+	if len(fields) < 2 || len(fields) > 3 {
+		return frame, fmt.Errorf("parseUBXFields(): %q is not a UBX class, id and payload", strings.Join(fields, " "))
+	}
+	for i, value := range []*byte{&frame.class, &frame.id} {
+		number, err := strconv.ParseUint(fields[i], 16, 8)
+		if err != nil {
+			return frame, &FieldError{Sentence: "UBX", Field: "class and id", Value: fields[i], Err: errFieldFormat}
+		}
+		*value = byte(number)
+	}
+	if len(fields) == 3 {
+		payload, err := hex.DecodeString(fields[2])
+		if err != nil {
+			return frame, &FieldError{Sentence: "UBX", Field: "payload", Value: fields[2], Err: errFieldFormat}
+		}
+		frame.payload = payload
+	}
+	return frame, nil
+}
+
+// decodeUBX decodes the text form of a UBX frame
+func decodeUBX(sentence string, base sentenceBase) (Sentence, error) {
+	frame, err := parseUBXFields(strings.Fields(strings.TrimPrefix(sentence, ubxTextPrefix)))
+	if err != nil {
+		return nil, err
+	}
+
+	p := frame.payload
+	size := map[string]int{"TIM-TP": 16, "NAV-TIMEUTC": 20, "NAV-CLOCK": 20}[frame.name()]
+	if len(p) < size {
+		return nil, &FieldError{Sentence: "UBX " + frame.name(), Field: "payload", Value: hex.EncodeToString(p),
+			Err: errFieldMissing}
+	}
+	le := binary.LittleEndian
+	switch frame.name() {
+	case "TIM-TP":
+		return &TIMTPSentence{sentenceBase: base, towMS: le.Uint32(p), towSubMS: le.Uint32(p[4:]),
+			qErr: int32(le.Uint32(p[8:])), week: le.Uint16(p[12:]), flags: p[14], refInfo: p[15]}, nil
+	case "NAV-TIMEUTC":
+		return &NAVTimeUTCSentence{sentenceBase: base, iTOW: le.Uint32(p), tAcc: le.Uint32(p[4:]),
+			nano: int32(le.Uint32(p[8:])), year: le.Uint16(p[12:]), month: p[14], day: p[15], hour: p[16],
+			minute: p[17], second: p[18], valid: p[19]}, nil
+	case "NAV-CLOCK":
+		return &NAVClockSentence{sentenceBase: base, iTOW: le.Uint32(p), clkB: int32(le.Uint32(p[4:])),
+			clkD: int32(le.Uint32(p[8:])), tAcc: le.Uint32(p[12:]), fAcc: le.Uint32(p[16:])}, nil
+	}
+	return &UBXSentence{sentenceBase: base, frame: frame}, nil
+}
+
+// parseUBXCommand builds the frame asked for by a ubx command typed in the command entry:
+//
+//	ubx poll TIM-TP       (or NAV-TIMEUTC, NAV-CLOCK)
+//	ubx cc ii [payload]   (class, id and payload in hex)
+func parseUBXCommand(cmd string) ([]byte, error) {
+	fields := strings.Fields(cmd)
+	if len(fields) == 3 && fields[1] == "poll" {
+		for classID, name := range ubxMessageNames {
+			if strings.EqualFold(name, fields[2]) {
+				return encodeUBX(classID[0], classID[1], nil), nil
+			}
+		}
+		return nil, fmt.Errorf("parseUBXCommand(): %s is not a known message", fields[2])
+	}
+	frame, err := parseUBXFields(fields[1:])
+	if err != nil {
+		return nil, fmt.Errorf("parseUBXCommand(): expected ubx poll <message> or ubx <class> <id> [payload]: %w", err)
+	}
+	return encodeUBX(frame.class, frame.id, frame.payload), nil
+}
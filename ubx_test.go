@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func timTPPayload(qErr int32, flags byte) []byte {
+	payload := make([]byte, 16)
+	binary.LittleEndian.PutUint32(payload, 345_600_000)
+	binary.LittleEndian.PutUint32(payload[8:], uint32(qErr))
+	binary.LittleEndian.PutUint16(payload[12:], 2303)
+	payload[14] = flags
+	return payload
+}
+
+func navTimeUTCPayload(valid byte) []byte {
+	payload := make([]byte, 20)
+	binary.LittleEndian.PutUint32(payload[4:], 25) // tAcc
+	binary.LittleEndian.PutUint16(payload[12:], 2024)
+	copy(payload[14:], []byte{3, 1, 12, 34, 56, valid})
+	return payload
+}
+
+func Test_nextUBXFrame(t *testing.T) {
+	// The payload contains the boundary marker
+	frame := string(encodeUBX(ubxClassTIM, ubxIDTimTP, timTPPayload(0x0A0D, 0)))
+	assert.Equal(t, "\r\n", frame[14:16])
+
+	got, rest, waiting := nextUBXFrame("{000C97C7 P}*76\r\n"+frame, "\r\n")
+	assert.Nil(t, got) // the sentence comes first
+	assert.False(t, waiting)
+
+	got, rest, waiting = nextUBXFrame(frame[:10], "\r\n")
+	assert.Nil(t, got)
+	assert.True(t, waiting)
+	assert.Equal(t, frame[:10], rest)
+	_, _, waiting = nextUBXFrame(frame[:len(frame)-1], "\r\n")
+	assert.True(t, waiting)
+
+	got, rest, waiting = nextUBXFrame(frame+"{000C97C7 P}*76\r\n", "\r\n")
+	assert.False(t, waiting)
+	assert.Equal(t, "{000C97C7 P}*76\r\n", rest)
+	assert.Equal(t, UBXFrame{class: ubxClassTIM, id: ubxIDTimTP, payload: timTPPayload(0x0A0D, 0)}, *got)
+
+	// A frame with a bad checksum is dropped
+	corrupt := frame[:len(frame)-1] + "\x00"
+	got, rest, _ = nextUBXFrame(corrupt, "\r\n")
+	assert.Nil(t, got)
+	assert.Equal(t, corrupt[2:], rest)
+	got, _, waiting = nextUBXFrame(rest, "\r\n")
+	assert.Nil(t, got)
+	assert.False(t, waiting)
+}
+
+func Test_nextUBXFrameFalseSync(t *testing.T) {
+	// The sync characters in a garbled sentence, followed by a plausible length (0x0200 bytes)
+	garbled := "{000C97C7 $GPDTM,\xb5\x62\x01\x03\x00\x02,0.0*11}*22\r\n"
+	got, rest, waiting := nextUBXFrame(garbled, "\r\n")
+	assert.Nil(t, got)
+	assert.True(t, waiting)
+	assert.Equal(t, garbled, rest)
+
+	// The next sentence is not held back
+	sentence := gftLine("{000C97C8 P}") + "\r\n"
+	got, rest, waiting = nextUBXFrame(garbled+sentence, "\r\n")
+	assert.Nil(t, got)
+	assert.False(t, waiting)
+	_, rest, found := strings.Cut(rest, "\r\n")
+	assert.True(t, found)
+	assert.Equal(t, sentence, rest)
+}
+
+func Test_decodeUBX(t *testing.T) {
+	frame := UBXFrame{class: ubxClassTIM, id: ubxIDTimTP, payload: timTPPayload(-1234, 0)}
+	s, err := decodeLine(frame.text())
+	assert.Nil(t, err)
+	tp := s.(*TIMTPSentence)
+	assert.Equal(t, "UBX", tp.Kind())
+	assert.Equal(t, int32(-1234), tp.qErr)
+	assert.Equal(t, uint16(2303), tp.week)
+	assert.True(t, tp.qErrValid())
+	assert.Contains(t, tp.Text(), "qErr -1234 ps")
+
+	s, _ = decodeLine(UBXFrame{class: ubxClassTIM, id: ubxIDTimTP, payload: timTPPayload(0, timTPQErrInvalid)}.text())
+	assert.False(t, s.(*TIMTPSentence).qErrValid())
+
+	s, err = decodeLine(UBXFrame{class: ubxClassNAV, id: ubxIDNavTimeUTC, payload: navTimeUTCPayload(0x07)}.text())
+	assert.Nil(t, err)
+	utc := s.(*NAVTimeUTCSentence)
+	assert.True(t, utc.utcValid())
+	assert.Equal(t, uint8(56), utc.second)
+	assert.Equal(t, uint32(25), utc.tAcc)
+
+	clock := make([]byte, 20)
+	binary.LittleEndian.PutUint32(clock[4:], uint32(0xFFFFFF9C)) // -100 ns
+	binary.LittleEndian.PutUint32(clock[12:], 15)
+	s, err = decodeLine(UBXFrame{class: ubxClassNAV, id: ubxIDNavClock, payload: clock}.text())
+	assert.Nil(t, err)
+	assert.Equal(t, int32(-100), s.(*NAVClockSentence).clkB)
+	assert.Equal(t, uint32(15), s.(*NAVClockSentence).tAcc)
+
+	s, err = decodeLine(UBXFrame{class: 0x0A, id: 0x04}.text())
+	assert.Nil(t, err)
+	assert.IsType(t, &UBXSentence{}, s)
+
+	_, err = decodeLine(UBXFrame{class: ubxClassTIM, id: ubxIDTimTP, payload: []byte{1, 2}}.text())
+	assert.ErrorIs(t, err, errFieldMissing)
+	_, err = decodeLine(gftLine("UBX 0D 01 XYZ"))
+	assert.ErrorIs(t, err, errFieldFormat)
+}
+
+func Test_parseUBXCommand(t *testing.T) {
+	frame, err := parseUBXCommand("ubx poll nav-timeutc")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xB5, 0x62, 0x01, 0x21, 0x00, 0x00, 0x22, 0x67}, frame)
+
+	frame, err = parseUBXCommand("ubx 06 01 F01A01")
+	assert.Nil(t, err)
+	assert.Equal(t, encodeUBX(0x06, 0x01, []byte{0xF0, 0x1A, 0x01}), frame)
+
+	_, err = parseUBXCommand("ubx poll NAV-PVT")
+	assert.NotNil(t, err)
+	_, err = parseUBXCommand("ubx 06")
+	assert.NotNil(t, err)
+}
+
+func Test_applyUBX(t *testing.T) {
+	savedData, savedFirst, savedLast := onePPSdata, myWin.gotFirst1PPS, myWin.lastPvalue
+	defer func() { onePPSdata, myWin.gotFirst1PPS, myWin.lastPvalue = savedData, savedFirst, savedLast }()
+	onePPSdata, myWin.gotFirst1PPS = OnePPSdata{}, false
+
+	// The quantization error of a TIM-TP goes with the 1pps that follows it, and only that one
+	gpsInfo := GPSdata{utcTimestamp: "2024-03-01T00:00:05.000000"}
+	for _, line := range []string{
+		UBXFrame{class: ubxClassTIM, id: ubxIDTimTP, payload: timTPPayload(-1234, 0)}.text(),
+		gftLine("{00000100 P}"),
+		gftLine("{000F4340 P}"),
+	} {
+		s, err := decodeLine(line)
+		assert.Nil(t, err)
+		applySentence(s, &gpsInfo)
+	}
+	assert.Equal(t, int32(-1234), onePPSdata.tickStamp[0].qErr)
+	assert.Equal(t, int32(0), onePPSdata.tickStamp[1].qErr)
+
+	// NAV-TIMEUTC validity decides whether a PUBX04 offset is the receiver's default
+	assert.Equal(t, "16D", offsetWithUTCValidity("16D", &gpsInfo))
+	s, _ := decodeLine(UBXFrame{class: ubxClassNAV, id: ubxIDNavTimeUTC, payload: navTimeUTCPayload(0x03)}.text())
+	applySentence(s, &gpsInfo)
+	assert.Equal(t, "18D", offsetWithUTCValidity("18", &gpsInfo))
+	s, _ = decodeLine(UBXFrame{class: ubxClassNAV, id: ubxIDNavTimeUTC, payload: navTimeUTCPayload(0x07)}.text())
+	applySentence(s, &gpsInfo)
+	assert.Equal(t, "18", offsetWithUTCValidity("18D", &gpsInfo))
+}
+
+func Test_interpolateWithQErr(t *testing.T) {
+	left := TickStamp{runningTickTime: 0, utcTimestamp: "2024-03-01T00:00:05.000000"}
+	right := TickStamp{runningTickTime: 1_000_000, utcTimestamp: "2024-03-01T00:00:06.000000"}
+	// (the interpolated time is a second later: the GPS time recorded for a 1pps is that of the sentence before it)
+	assert.Equal(t, "2024-03-01T00:00:06.500000", interpolateCorrectedTimestamp(500_000, left, right))
+
+	left.qErr, right.qErr = 3_000_000, 3_000_000 // 3 us late
+	assert.Equal(t, "2024-03-01T00:00:06.500003", interpolateCorrectedTimestamp(500_000, left, right))
+	left.qErr = -1_000_000
+	assert.Equal(t, "2024-03-01T00:00:06.500001", interpolateCorrectedTimestamp(500_000, left, right))
+}